@@ -0,0 +1,71 @@
+package api
+
+import (
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/ical"
+)
+
+// Event is the JSON representation of a calendar.Event
+type Event struct {
+	ID           string     `json:"id"`
+	UID          string     `json:"uid"`
+	Type         string     `json:"type"`
+	Calendar     string     `json:"calendar,omitempty"`
+	Category     string     `json:"category,omitempty"`
+	Stage        string     `json:"stage,omitempty"`
+	Content      string     `json:"content,omitempty"`
+	Start        time.Time  `json:"start"`
+	End          time.Time  `json:"end"`
+	Duration     int64      `json:"duration"`
+	MatchCount   int        `json:"match_count"`
+	Tournament   bool       `json:"tournament"`
+	Canceled     bool       `json:"canceled"`
+	Participants []string   `json:"participants"`
+	Tags         []string   `json:"tags"`
+	Links        []string   `json:"links"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// Calendar is the JSON representation of one of the calendar types
+type Calendar struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	ICal   string `json:"ical"`
+	Events string `json:"events"`
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// NewEvent builds the JSON representation of the event, with the times in the loc location
+func NewEvent(ev calendar.Event, loc *time.Location) Event {
+	e := Event{
+		ID:           calendar.EventID(ev),
+		UID:          ical.EventUID(ev),
+		Type:         ev.Type,
+		Calendar:     calendar.Labels[ev.Type],
+		Category:     ev.Category,
+		Stage:        ev.Stage,
+		Content:      ev.Content,
+		Start:        ev.StartTime.In(loc),
+		End:          ev.StartTime.Add(ev.Duration).In(loc),
+		Duration:     int64(ev.Duration / time.Second),
+		MatchCount:   ev.MatchCount,
+		Tournament:   ev.IsTournament(),
+		Canceled:     ev.Canceled,
+		Participants: ev.Participants(),
+		Tags:         nonNil(ev.TagNames),
+		Links:        nonNil(ev.Links),
+	}
+	if !ev.LastModified.IsZero() {
+		modified := ev.LastModified.In(loc)
+		e.LastModified = &modified
+	}
+	return e
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/filter"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	// Prefix is the path under which the current version of the API is served
+	Prefix = "/api/v1"
+
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+type handler struct {
+	UpcomingPast   time.Duration
+	UpcomingFuture time.Duration
+	st             storage.Loader
+}
+
+type OptionFn func(*handler)
+
+// WithUpcomingWindow sets the window used by requests with the "upcoming" parameter, relative to the time of the request
+func WithUpcomingWindow(past, future time.Duration) OptionFn {
+	return func(h *handler) {
+		if past >= 0 {
+			h.UpcomingPast = past
+		}
+		if future > 0 {
+			h.UpcomingFuture = future
+		}
+	}
+}
+
+func newHandler(st storage.Loader, opts ...OptionFn) *handler {
+	h := new(handler)
+	h.st = st
+	h.UpcomingPast = ical.DefaultUpcomingPast
+	h.UpcomingFuture = ical.DefaultUpcomingFuture
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+// Error is the body of all the error responses of the API
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error Error `json:"error"`
+	}{Error{Status: status, Message: err.Error()}})
+}
+
+// getOnly wraps fn to respond with a JSON error body to requests with methods other than GET and HEAD
+func getOnly(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		fn(w, r)
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+}
+
+func loadLocation(q url.Values) (*time.Location, error) {
+	tz := q.Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	return loc, nil
+}
+
+// icalPath builds the equivalent iCal route path for the query parameters of an events request:
+//
+//	calendar: the calendar types, can be repeated or joined with "+", eg: calendar=sc2+qch
+//	year: a single year, or a range of years, eg: year=2023-2025
+//	upcoming: "true" selects the upcoming window instead of calendar years
+func icalPath(q url.Values) (string, error) {
+	pieces := make([]string, 0, 2)
+	if y := q.Get("year"); y != "" {
+		if _, _, ok := ical.ParseYears(y); !ok {
+			return "", fmt.Errorf("invalid year value %q", y)
+		}
+		pieces = append(pieces, y)
+	}
+	if u := q.Get("upcoming"); u != "" {
+		upcoming, err := strconv.ParseBool(u)
+		if err != nil {
+			return "", fmt.Errorf("invalid upcoming value %q", u)
+		}
+		if upcoming && len(pieces) > 0 {
+			return "", errors.New("year and upcoming can not be used together")
+		}
+		if upcoming {
+			pieces = append(pieces, ical.UpcomingPath)
+		}
+	}
+	types := make([]string, 0)
+	for _, c := range q["calendar"] {
+		for _, typ := range strings.Split(c, "+") {
+			if typ = strings.TrimSpace(typ); typ == "" {
+				continue
+			}
+			if len(calendar.GetTypes([]string{typ})) == 0 {
+				return "", fmt.Errorf("invalid calendar value %q", typ)
+			}
+			types = append(types, typ)
+		}
+	}
+	if len(types) > 0 {
+		pieces = append(pieces, strings.Join(types, "+"))
+	}
+	return "/" + path.Join(pieces...), nil
+}
+
+func parseLimit(q url.Values) (int, error) {
+	l := q.Get("limit")
+	if l == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit <= 0 || limit > MaxLimit {
+		return 0, fmt.Errorf("invalid limit value %q, it needs to be between 1 and %d", l, MaxLimit)
+	}
+	return limit, nil
+}
+
+// pageCursor marks the position of the last event of a page, the next page starts with the events after it
+type pageCursor struct {
+	start time.Time
+	typ   string
+	id    int64
+}
+
+func cursorOf(ev calendar.Event) pageCursor {
+	return pageCursor{start: ev.StartTime, typ: ev.Type, id: ev.CalID}
+}
+
+func (c pageCursor) String() string {
+	raw := fmt.Sprintf("%d/%s/%d", c.start.Unix(), c.typ, c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseCursor(s string) (pageCursor, error) {
+	c := pageCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor value %q", s)
+	}
+	pieces := strings.Split(string(raw), "/")
+	if len(pieces) != 3 {
+		return c, fmt.Errorf("invalid cursor value %q", s)
+	}
+	start, err := strconv.ParseInt(pieces[0], 10, 64)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor value %q", s)
+	}
+	if c.id, err = strconv.ParseInt(pieces[2], 10, 64); err != nil {
+		return c, fmt.Errorf("invalid cursor value %q", s)
+	}
+	c.start = time.Unix(start, 0).UTC()
+	c.typ = pieces[1]
+	return c, nil
+}
+
+// less defines the order of the events in the API responses: by start time, type and CalID
+func (c pageCursor) less(o pageCursor) bool {
+	if !c.start.Equal(o.start) {
+		return c.start.Before(o.start)
+	}
+	if c.typ != o.typ {
+		return c.typ < o.typ
+	}
+	return c.id < o.id
+}
+
+// paginate returns the page of at most limit events that come after the after cursor,
+// and the cursor for the next page if there are more events.
+func paginate(events calendar.Events, after *pageCursor, limit int) (calendar.Events, *pageCursor) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return cursorOf(events[i]).less(cursorOf(events[j]))
+	})
+	start := 0
+	if after != nil {
+		start = sort.Search(len(events), func(i int) bool {
+			return after.less(cursorOf(events[i]))
+		})
+	}
+	events = events[start:]
+	if len(events) <= limit {
+		return events, nil
+	}
+	next := cursorOf(events[limit-1])
+	return events[:limit], &next
+}
+
+// EventsPage is the body of the responses for the events collection
+type EventsPage struct {
+	Events []Event `json:"events"`
+	Next   string  `json:"next,omitempty"`
+}
+
+func (h *handler) events(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, err := icalPath(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	f, err := filter.FromValues(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	loc, err := loadLocation(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := parseLimit(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var after *pageCursor
+	if c := q.Get("cursor"); c != "" {
+		pc, err := parseCursor(c)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		after = &pc
+	}
+
+	types, in := ical.ParsePath(&url.URL{Path: p})
+	cursor := in.Cursor(time.Now().UTC(), filter.Filters{Past: h.UpcomingPast, Future: h.UpcomingFuture}, f)
+	events, err := storage.Search(h.st, f.Text, cursor, types...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	filtered := make(calendar.Events, 0, len(events))
+	for _, ev := range events {
+		if cursor.Contains(ev.StartTime) && f.Match(ev) {
+			filtered = append(filtered, ev)
+		}
+	}
+
+	page, next := paginate(filtered, after, limit)
+	result := EventsPage{Events: make([]Event, 0, len(page))}
+	for _, ev := range page {
+		result.Events = append(result.Events, NewEvent(ev, loc))
+	}
+	if next != nil {
+		result.Next = next.String()
+		nextURL := *r.URL
+		q.Set("cursor", result.Next)
+		nextURL.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+	}
+	metrics.CountEvents(r, len(result.Events))
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *handler) event(w http.ResponseWriter, r *http.Request) {
+	typ, id, err := calendar.ParseEventID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	loc, err := loadLocation(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	ev, err := storage.FindEvent(h.st, typ, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("event %s not found", r.PathValue("id")))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	metrics.CountEvents(r, 1)
+	writeJSON(w, http.StatusOK, NewEvent(ev, loc))
+}
+
+func (h *handler) calendars(w http.ResponseWriter, r *http.Request) {
+	result := struct {
+		Calendars []Calendar `json:"calendars"`
+	}{Calendars: make([]Calendar, 0)}
+	for _, typ := range calendar.GetTypes(nil) {
+		result.Calendars = append(result.Calendars, Calendar{
+			ID:     typ,
+			Label:  calendar.Labels[typ],
+			ICal:   "/" + typ,
+			Events: Prefix + "/events?calendar=" + url.QueryEscape(typ),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
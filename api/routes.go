@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+func Routes(st storage.Loader, opts ...OptionFn) http.Handler {
+	h := newHandler(st, opts...)
+
+	r := http.NewServeMux()
+	r.HandleFunc(Prefix+"/events", getOnly(h.events))
+	r.HandleFunc(Prefix+"/events/{id}", getOnly(h.event))
+	r.HandleFunc(Prefix+"/calendars", getOnly(h.calendars))
+	r.HandleFunc("/", notFound)
+	return r
+}
@@ -0,0 +1,493 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	// Prefix is the path under which the CalDAV resources are served, it's also the URL of the principal
+	Prefix = "/dav"
+	// WellKnownPath is the path CalDAV clients use for discovering the service (RFC 6764)
+	WellKnownPath = "/.well-known/caldav"
+
+	homePath = Prefix + "/calendars/"
+
+	// DefaultPast and DefaultFuture define the window of events listed in the collections
+	DefaultPast   = calendar.Yearish
+	DefaultFuture = calendar.Yearish
+
+	allowedMethods = "OPTIONS, GET, HEAD, PROPFIND, REPORT"
+	contentTypeCal = "text/calendar; charset=utf-8; component=vevent"
+
+	// maxBodySize is the largest PROPFIND or REPORT body we read, it fits thousands of hrefs in a multiget
+	maxBodySize = 1 << 20
+)
+
+type handler struct {
+	Past   time.Duration
+	Future time.Duration
+	Groups []string
+	st     storage.Loader
+}
+
+type OptionFn func(*handler)
+
+// WithWindow sets the window of events that are listed in the collections, relative to the time of the request
+func WithWindow(past, future time.Duration) OptionFn {
+	return func(h *handler) {
+		if past >= 0 {
+			h.Past = past
+		}
+		if future > 0 {
+			h.Future = future
+		}
+	}
+}
+
+// WithGroups sets the calendar groups that get exposed as collections, besides the individual calendar types
+func WithGroups(groups ...string) OptionFn {
+	return func(h *handler) {
+		h.Groups = groups
+	}
+}
+
+func NewHandler(st storage.Loader, opts ...OptionFn) *handler {
+	h := new(handler)
+	h.st = st
+	h.Past = DefaultPast
+	h.Future = DefaultFuture
+	h.Groups = calendar.DefaultCalendars
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+// collections returns the names of the calendar collections, the groups come first
+func (h *handler) collections() []string {
+	names := make([]string, 0)
+	for _, g := range h.Groups {
+		if len(calendar.GetTypes([]string{g})) > 0 {
+			names = append(names, g)
+		}
+	}
+	for _, typ := range calendar.GetTypes(nil) {
+		if !inStringList(typ, names) {
+			names = append(names, typ)
+		}
+	}
+	return names
+}
+
+func inStringList(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func collectionPath(name string) string {
+	return homePath + name + "/"
+}
+
+func eventPath(collection string, ev calendar.Event) string {
+	return collectionPath(collection) + calendar.EventID(ev) + ".ics"
+}
+
+// calendarData renders the event as a standalone iCalendar object
+func calendarData(ev calendar.Event) ([]byte, error) {
+	b := bytes.Buffer{}
+	err := ical.NewCalendar("", []string{ev.Type}, calendar.Events{ev}, time.UTC).Encode(&b)
+	return b.Bytes(), err
+}
+
+// eTag is derived from the calendar data of the event, so it changes with every revision of the event
+func eTag(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
+
+type resource struct {
+	ev   calendar.Event
+	data []byte
+	etag string
+}
+
+func newResource(ev calendar.Event) (resource, error) {
+	data, err := calendarData(ev)
+	if err != nil {
+		return resource{}, err
+	}
+	return resource{ev: ev, data: data, etag: eTag(data)}, nil
+}
+
+// loadResources loads the events of the collection that overlap the [start, end) interval
+func (h *handler) loadResources(name string, start, end time.Time) ([]resource, error) {
+	types := calendar.GetTypes([]string{name})
+	// we look back a bit, for the tournaments that started before the interval, but are still running
+	lookBack := start.Add(-4 * calendar.Week)
+	events, err := h.st.LoadEvents(storage.Cursor(lookBack, end.Sub(lookBack)), types...)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].StartTime.Before(events[j].StartTime) })
+	resources := make([]resource, 0, len(events))
+	for _, ev := range events {
+		evEnd := ev.StartTime.Add(ev.Duration)
+		if ev.StartTime.Before(end) && (evEnd.After(start) || !ev.StartTime.Before(start)) {
+			res, err := newResource(ev)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, res)
+		}
+	}
+	return resources, nil
+}
+
+func (h *handler) window() (time.Time, time.Time) {
+	now := time.Now().UTC()
+	return now.Add(-h.Past), now.Add(h.Future)
+}
+
+// cTag is the collection entity tag, derived from the etags of its events
+func cTag(resources []resource) string {
+	h := fnv.New64a()
+	for _, res := range resources {
+		io.WriteString(h, res.etag)
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum64())
+}
+
+// target is the resource a request path points to
+type target struct {
+	principal  bool
+	home       bool
+	collection string
+	event      string
+}
+
+func (h *handler) parsePath(p string) (target, bool) {
+	t := target{}
+	rel := strings.Trim(strings.TrimPrefix(p, Prefix), "/")
+	pieces := strings.Split(rel, "/")
+	switch {
+	case rel == "":
+		t.principal = true
+	case len(pieces) == 1 && pieces[0] == "calendars":
+		t.home = true
+	case len(pieces) == 2 && pieces[0] == "calendars":
+		t.collection = pieces[1]
+	case len(pieces) == 3 && pieces[0] == "calendars" && path.Ext(pieces[2]) == ".ics":
+		t.collection = pieces[1]
+		t.event = strings.TrimSuffix(pieces[2], ".ics")
+	default:
+		return t, false
+	}
+	if t.collection != "" && !inStringList(t.collection, h.collections()) {
+		return t, false
+	}
+	return t, true
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, calendar-access")
+	t, ok := h.parsePath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, t)
+	case "PROPFIND":
+		h.propfind(w, r, t)
+	case "REPORT":
+		h.report(w, r, t)
+	default:
+		// the collections are read-only, PUT, DELETE, MKCALENDAR etc are not allowed
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) findEvent(t target) (resource, error) {
+	typ, id, err := calendar.ParseEventID(t.event)
+	if err != nil {
+		return resource{}, storage.ErrNotFound
+	}
+	if !inStringList(typ, calendar.GetTypes([]string{t.collection})) {
+		return resource{}, storage.ErrNotFound
+	}
+	ev, err := storage.FindEvent(h.st, typ, id)
+	if err != nil {
+		return resource{}, err
+	}
+	return newResource(ev)
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, t target) {
+	if t.event != "" {
+		res, err := h.findEvent(t)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeCal)
+		w.Header().Set("ETag", res.etag)
+		if inm := r.Header.Get("If-None-Match"); inm == res.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		metrics.CountEvents(r, 1)
+		w.Write(res.data)
+		return
+	}
+	if t.collection == "" {
+		http.Error(w, "this is a CalDAV service, please use a calendar client", http.StatusNotFound)
+		return
+	}
+	start, end := h.window()
+	resources, err := h.loadResources(t.collection, start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events := make(calendar.Events, 0, len(resources))
+	for _, res := range resources {
+		events = append(events, res.ev)
+	}
+	w.Header().Set("Content-Type", contentTypeCal)
+	w.Header().Set("ETag", cTag(resources))
+	metrics.CountEvents(r, len(events))
+	ical.NewCalendar("", calendar.GetTypes([]string{t.collection}), events, time.UTC).Encode(w)
+}
+
+func principalProps() []prop {
+	return []prop{
+		{name: propResourceType, inner: element(xml.Name{Space: nsDAV, Local: "principal"}, "")},
+		textProp(propDisplayName, "othrys"),
+		{name: propCurrentUserPrincipal, inner: href(Prefix + "/")},
+		{name: propPrincipalURL, inner: href(Prefix + "/")},
+		{name: propCalendarHomeSet, inner: href(homePath)},
+	}
+}
+
+func homeProps() []prop {
+	return []prop{
+		{name: propResourceType, inner: element(xml.Name{Space: nsDAV, Local: "collection"}, "")},
+		{name: propCurrentUserPrincipal, inner: href(Prefix + "/")},
+	}
+}
+
+var readPrivilege = element(xml.Name{Space: nsDAV, Local: "privilege"}, element(xml.Name{Space: nsDAV, Local: "read"}, ""))
+
+func supportedReport(n xml.Name) string {
+	return element(xml.Name{Space: nsDAV, Local: "supported-report"}, element(xml.Name{Space: nsDAV, Local: "report"}, element(n, "")))
+}
+
+func collectionProps(name string, resources []resource) []prop {
+	label := calendar.Labels[name]
+	if label == "" {
+		label = name
+	}
+	return []prop{
+		{name: propResourceType, inner: element(xml.Name{Space: nsDAV, Local: "collection"}, "") + element(xml.Name{Space: nsCalDAV, Local: "calendar"}, "")},
+		textProp(propDisplayName, label),
+		textProp(propCalendarDescription, fmt.Sprintf("Events for %s", label)),
+		{name: propCurrentUserPrincipal, inner: href(Prefix + "/")},
+		{name: propSupportedComponents, inner: `<C:comp name="VEVENT"/>`},
+		{name: propPrivilegeSet, inner: readPrivilege},
+		{name: propSupportedReportSet, inner: supportedReport(reportCalendarQuery) + supportedReport(reportCalendarMultiget)},
+		textProp(propGetCTag, cTag(resources)),
+		textProp(propGetETag, cTag(resources)),
+	}
+}
+
+func eventProps(res resource, withData bool) []prop {
+	props := []prop{
+		{name: propResourceType},
+		textProp(propGetETag, res.etag),
+		textProp(propGetContentType, contentTypeCal),
+	}
+	if !res.ev.LastModified.IsZero() {
+		props = append(props, timeProp(propGetLastModified, res.ev.LastModified))
+	}
+	if withData {
+		props = append(props, textProp(propCalendarData, string(res.data)))
+	}
+	return props
+}
+
+func badRequest(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// invalidBody answers with 413 when the request body is larger than maxBodySize, and with 400 otherwise
+func invalidBody(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	badRequest(w, err)
+}
+
+func (h *handler) propfind(w http.ResponseWriter, r *http.Request, t target) {
+	var requested []xml.Name
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		invalidBody(w, err)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		pf := propfindRequest{}
+		if err = xml.Unmarshal(body, &pf); err != nil {
+			badRequest(w, fmt.Errorf("invalid propfind body: %w", err))
+			return
+		}
+		if pf.AllProp == nil {
+			requested = pf.Prop.names()
+		}
+	}
+	depth := r.Header.Get("Depth")
+	children := depth == "1" || depth == "infinity" || depth == ""
+
+	ms := multistatus{}
+	add := func(p string, available []prop) {
+		found, missing := selectProps(available, requested)
+		ms.add(p, found, missing)
+	}
+	switch {
+	case t.principal:
+		add(Prefix+"/", principalProps())
+	case t.home:
+		add(homePath, homeProps())
+		if children {
+			start, end := h.window()
+			for _, name := range h.collections() {
+				resources, err := h.loadResources(name, start, end)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				add(collectionPath(name), collectionProps(name, resources))
+			}
+		}
+	case t.event == "":
+		start, end := h.window()
+		resources, err := h.loadResources(t.collection, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		add(collectionPath(t.collection), collectionProps(t.collection, resources))
+		if children {
+			for _, res := range resources {
+				add(eventPath(t.collection, res.ev), eventProps(res, false))
+			}
+		}
+	default:
+		res, err := h.findEvent(t)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		add(eventPath(t.collection, res.ev), eventProps(res, false))
+	}
+	ms.write(w)
+}
+
+func (h *handler) report(w http.ResponseWriter, r *http.Request, t target) {
+	if t.collection == "" {
+		http.Error(w, "reports are supported only on calendar collections", http.StatusForbidden)
+		return
+	}
+	rep := reportRequest{}
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&rep); err != nil {
+		invalidBody(w, fmt.Errorf("invalid report body: %w", err))
+		return
+	}
+	requested := rep.Prop.names()
+
+	ms := multistatus{}
+	add := func(res resource) {
+		found, missing := selectProps(eventProps(res, true), requested)
+		ms.add(eventPath(t.collection, res.ev), found, missing)
+		metrics.CountEvents(r, 1)
+	}
+	switch rep.XMLName {
+	case reportCalendarQuery:
+		start, end := h.window()
+		if rep.Filter != nil {
+			trStart, trEnd, err := parseTimeRange(rep.Filter.CompFilter.timeRange())
+			if err != nil {
+				badRequest(w, err)
+				return
+			}
+			if !trStart.IsZero() {
+				start = trStart
+			}
+			if !trEnd.IsZero() {
+				end = trEnd
+			}
+		}
+		resources, err := h.loadResources(t.collection, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, res := range resources {
+			if t.event == "" || calendar.EventID(res.ev) == t.event {
+				add(res)
+			}
+		}
+	case reportCalendarMultiget:
+		for _, hr := range rep.Hrefs {
+			ht, ok := h.parsePath(strings.TrimSpace(hr))
+			if !ok || ht.event == "" || ht.collection != t.collection {
+				ms.addStatus(hr, http.StatusNotFound)
+				continue
+			}
+			res, err := h.findEvent(ht)
+			if err != nil {
+				ms.addStatus(hr, http.StatusNotFound)
+				continue
+			}
+			add(res)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unsupported report %s", rep.XMLName.Local), http.StatusForbidden)
+		return
+	}
+	ms.write(w)
+}
@@ -0,0 +1,113 @@
+package caldav
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+// countingStore counts the calls loading intervals of events, which the lookups of single events need to avoid
+type countingStore struct {
+	storage.Loader
+	storage.Finder
+	loads int
+}
+
+func (c *countingStore) LoadEvents(cursor storage.DateCursor, types ...string) (calendar.Events, error) {
+	c.loads++
+	return c.Loader.LoadEvents(cursor, types...)
+}
+
+const multigetTpl = `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  %s
+</C:calendar-multiget>`
+
+func multiget(hrefs ...string) string {
+	s := strings.Builder{}
+	for _, h := range hrefs {
+		fmt.Fprintf(&s, "<D:href>%s</D:href>\n", h)
+	}
+	return fmt.Sprintf(multigetTpl, s.String())
+}
+
+func TestReportMultiget(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Hour)
+	events := calendar.Events{
+		{CalID: 1, Type: "sc2", StartTime: start, Duration: time.Hour, Category: "Test Cup", Stage: "Group A"},
+		{CalID: 2, Type: "sc2", StartTime: start.Add(time.Hour), Duration: time.Hour, Category: "Test Cup", Stage: "Group B"},
+	}
+	mem := memory.New()
+	if err := mem.SaveEvents(events); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		found      []string
+		missing    []string
+	}{
+		{
+			name:       "found and missing",
+			body:       multiget(eventPath("sc2", events[0]), eventPath("sc2", events[1]), homePath+"sc2/sc2-3.ics"),
+			wantStatus: http.StatusMultiStatus,
+			found:      []string{eventPath("sc2", events[0]), eventPath("sc2", events[1])},
+			missing:    []string{homePath + "sc2/sc2-3.ics"},
+		},
+		{
+			name:       "other collection",
+			body:       multiget(eventPath("dota", events[0])),
+			wantStatus: http.StatusMultiStatus,
+			missing:    []string{eventPath("dota", events[0])},
+		},
+		{
+			name:       "body too large",
+			body:       multiget(strings.Repeat(homePath+"sc2/sc2-1.ics ", maxBodySize/20)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &countingStore{Loader: mem, Finder: mem}
+			r := httptest.NewRequest("REPORT", collectionPath("sc2"), strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			NewHandler(st).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, expected %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if st.loads > 0 {
+				t.Errorf("loaded the events %d times, expected single event lookups", st.loads)
+			}
+			body := w.Body.String()
+			for _, href := range tt.found {
+				if !strings.Contains(body, href) {
+					t.Errorf("missing response for %s", href)
+				}
+			}
+			for _, href := range tt.missing {
+				i := strings.Index(body, href)
+				if i < 0 {
+					t.Errorf("missing response for %s", href)
+					continue
+				}
+				if !strings.Contains(body[i:], "404") {
+					t.Errorf("expected a 404 status for %s", href)
+				}
+			}
+			if tt.wantStatus == http.StatusMultiStatus && len(tt.found) > 0 && !strings.Contains(body, "BEGIN:VEVENT") {
+				t.Errorf("no calendar data in the response")
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package caldav
+
+import (
+	"net/http"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+func Routes(st storage.Loader, opts ...OptionFn) http.Handler {
+	r := http.NewServeMux()
+	r.Handle(Prefix+"/", NewHandler(st, opts...))
+	r.Handle(WellKnownPath, http.RedirectHandler(Prefix+"/", http.StatusMovedPermanently))
+	return r
+}
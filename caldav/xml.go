@@ -0,0 +1,237 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// XML namespaces used by CalDAV and its common extensions
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+var prefixes = map[string]string{
+	nsDAV:    "D",
+	nsCalDAV: "C",
+	nsCS:     "CS",
+}
+
+var (
+	propResourceType         = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName          = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentUserPrincipal = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL         = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propPrivilegeSet         = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propSupportedReportSet   = xml.Name{Space: nsDAV, Local: "supported-report-set"}
+	propGetETag              = xml.Name{Space: nsDAV, Local: "getetag"}
+	propGetContentType       = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propGetLastModified      = xml.Name{Space: nsDAV, Local: "getlastmodified"}
+	propCalendarHomeSet      = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propCalendarDescription  = xml.Name{Space: nsCalDAV, Local: "calendar-description"}
+	propSupportedComponents  = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCalendarData         = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propGetCTag              = xml.Name{Space: nsCS, Local: "getctag"}
+
+	reportCalendarQuery    = xml.Name{Space: nsCalDAV, Local: "calendar-query"}
+	reportCalendarMultiget = xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}
+)
+
+// element renders an XML element with the prefix of its namespace, the inner content needs to be escaped already
+func element(n xml.Name, inner string) string {
+	prefix, ok := prefixes[n.Space]
+	if !ok {
+		if inner == "" {
+			return fmt.Sprintf(`<X:%s xmlns:X="%s"/>`, n.Local, escape(n.Space))
+		}
+		return fmt.Sprintf(`<X:%s xmlns:X="%s">%s</X:%s>`, n.Local, escape(n.Space), inner, n.Local)
+	}
+	if inner == "" {
+		return fmt.Sprintf("<%s:%s/>", prefix, n.Local)
+	}
+	return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, n.Local, inner, prefix, n.Local)
+}
+
+func escape(s string) string {
+	b := strings.Builder{}
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func href(s string) string {
+	return element(xml.Name{Space: nsDAV, Local: "href"}, escape(s))
+}
+
+// prop is the value of a WebDAV property, with the inner XML already escaped
+type prop struct {
+	name  xml.Name
+	inner string
+}
+
+func textProp(n xml.Name, value string) prop {
+	return prop{name: n, inner: escape(value)}
+}
+
+func timeProp(n xml.Name, t time.Time) prop {
+	return textProp(n, t.UTC().Format(http.TimeFormat))
+}
+
+// selectProps splits the requested properties in the ones we have values for and the ones we don't,
+// if no properties were requested explicitly, all the available ones are returned.
+func selectProps(available []prop, requested []xml.Name) ([]prop, []xml.Name) {
+	if requested == nil {
+		return available, nil
+	}
+	found := make([]prop, 0, len(requested))
+	missing := make([]xml.Name, 0)
+	for _, n := range requested {
+		ok := false
+		for _, p := range available {
+			if p.name == n {
+				found = append(found, p)
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			missing = append(missing, n)
+		}
+	}
+	return found, missing
+}
+
+type multistatus struct {
+	b bytes.Buffer
+}
+
+func (m *multistatus) propstat(props string, status int) {
+	m.b.WriteString("<D:propstat><D:prop>")
+	m.b.WriteString(props)
+	m.b.WriteString("</D:prop>")
+	fmt.Fprintf(&m.b, "<D:status>HTTP/1.1 %d %s</D:status>", status, http.StatusText(status))
+	m.b.WriteString("</D:propstat>")
+}
+
+// add appends the response for the resource at path
+func (m *multistatus) add(path string, found []prop, missing []xml.Name) {
+	m.b.WriteString("<D:response>")
+	m.b.WriteString(href(path))
+	if len(found) > 0 {
+		props := strings.Builder{}
+		for _, p := range found {
+			props.WriteString(element(p.name, p.inner))
+		}
+		m.propstat(props.String(), http.StatusOK)
+	}
+	if len(missing) > 0 {
+		props := strings.Builder{}
+		for _, n := range missing {
+			props.WriteString(element(n, ""))
+		}
+		m.propstat(props.String(), http.StatusNotFound)
+	}
+	m.b.WriteString("</D:response>")
+}
+
+// addStatus appends a response without properties, like the ones for the missing resources in a multiget
+func (m *multistatus) addStatus(path string, status int) {
+	m.b.WriteString("<D:response>")
+	m.b.WriteString(href(path))
+	fmt.Fprintf(&m.b, "<D:status>HTTP/1.1 %d %s</D:status>", status, http.StatusText(status))
+	m.b.WriteString("</D:response>")
+}
+
+func (m *multistatus) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	fmt.Fprintf(w, `<D:multistatus xmlns:D="%s" xmlns:C="%s" xmlns:CS="%s">`, nsDAV, nsCalDAV, nsCS)
+	w.Write(m.b.Bytes())
+	io.WriteString(w, "</D:multistatus>")
+}
+
+type anyElement struct {
+	XMLName xml.Name
+}
+
+type propNames struct {
+	Names []anyElement `xml:",any"`
+}
+
+func (p *propNames) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, 0, len(p.Names))
+	for _, n := range p.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+type propfindRequest struct {
+	XMLName xml.Name   `xml:"DAV: propfind"`
+	AllProp *struct{}  `xml:"DAV: allprop"`
+	Prop    *propNames `xml:"DAV: prop"`
+}
+
+type timeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	TimeRange   *timeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// timeRange returns the first time-range filter in the component filters tree
+func (f compFilter) timeRange() *timeRange {
+	if f.TimeRange != nil {
+		return f.TimeRange
+	}
+	for _, sub := range f.CompFilters {
+		if tr := sub.timeRange(); tr != nil {
+			return tr
+		}
+	}
+	return nil
+}
+
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *propNames `xml:"DAV: prop"`
+	Filter  *struct {
+		CompFilter compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	Hrefs []string `xml:"DAV: href"`
+}
+
+const formatTimeRange = "20060102T150405Z"
+
+// parseTimeRange loads the interval of a time-range filter, the missing ends of the interval are left as zero times
+func parseTimeRange(tr *timeRange) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if tr == nil {
+		return start, end, nil
+	}
+	if tr.Start != "" {
+		if start, err = time.Parse(formatTimeRange, tr.Start); err != nil {
+			return start, end, fmt.Errorf("invalid time-range start %q", tr.Start)
+		}
+	}
+	if tr.End != "" {
+		if end, err = time.Parse(formatTimeRange, tr.End); err != nil {
+			return start, end, fmt.Errorf("invalid time-range end %q", tr.End)
+		}
+	}
+	return start, end, nil
+}
@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,6 +17,9 @@ import (
 
 var DefaultCalendars = []string{liquid.LabelTeamLiquid, plusforward.LabelPlusForward}
 
+// Providers are the sources the events get fetched from
+var Providers = []string{liquid.LabelTeamLiquid, plusforward.LabelPlusForward, gcn.LabelGCN}
+
 type Fetcher interface {
 	Load(startDate time.Time) (Events, error)
 }
@@ -60,6 +64,28 @@ func (e Event) IsValid() bool {
 	return !e.StartTime.IsZero() && e.CalID > 0
 }
 
+// IsTournament returns true for events that span multiple matches or whole days,
+// as opposed to individual matches.
+func (e Event) IsTournament() bool {
+	return e.MatchCount > 1 || e.Duration >= Day
+}
+
+// Participants returns the opponents in the matches of the event, from the content lines that look like "A vs B"
+func (e Event) Participants() []string {
+	participants := make([]string, 0)
+	for _, line := range strings.Split(e.Content, "\n") {
+		if !strings.Contains(line, " vs ") {
+			continue
+		}
+		for _, p := range strings.Split(line, " vs ") {
+			if p = strings.TrimSpace(p); p != "" && !inStringList(p, participants) {
+				participants = append(participants, p)
+			}
+		}
+	}
+	return participants
+}
+
 func (e Event) Equals(other Event) bool {
 	return e.CalID == other.CalID &&
 		e.StartTime == other.StartTime &&
@@ -114,6 +140,27 @@ func (e Events) Contains(inc Event) bool {
 	return false
 }
 
+// EventID returns the identity of the event, which the API and the posting ledger use,
+// and which is the local part of its iCalendar UID
+func EventID(ev Event) string {
+	return fmt.Sprintf("%s-%d", ev.Type, ev.CalID)
+}
+
+// ParseEventID splits an identifier returned by EventID in the event type and CalID,
+// the type needs to be a single calendar, not a group label like "tl".
+func ParseEventID(s string) (string, int64, error) {
+	i := strings.LastIndex(s, "-")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid event id %q", s)
+	}
+	typ := s[:i]
+	id, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if types := GetTypes([]string{typ}); err != nil || id <= 0 || len(types) != 1 || types[0] != typ {
+		return "", 0, fmt.Errorf("invalid event id %q", s)
+	}
+	return typ, id, nil
+}
+
 func inStringList(s string, list []string) bool {
 	for _, lss := range list {
 		if lss == s {
@@ -224,6 +271,18 @@ func GetCalendarURL(typ string, date time.Time, byWeek bool) (*url.URL, error) {
 	return nil, fmt.Errorf("invalid type %s", typ)
 }
 
+// Provider returns the source the events of the typ calendar get fetched from, or an empty string for invalid types
+func Provider(typ string) string {
+	if plusforward.ValidType(typ) {
+		return plusforward.LabelPlusForward
+	} else if liquid.ValidType(typ) {
+		return liquid.LabelTeamLiquid
+	} else if gcn.ValidType(typ) {
+		return gcn.LabelGCN
+	}
+	return ""
+}
+
 func LoadEvents(typ string, date time.Time) (Events, error) {
 	events := make(Events, 0)
 	u, err := GetCalendarURL(typ, date, false)
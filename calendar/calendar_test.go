@@ -0,0 +1,34 @@
+package calendar
+
+import "testing"
+
+func TestParseEventID(t *testing.T) {
+	tests := []struct {
+		in  string
+		typ string
+		id  int64
+		ok  bool
+	}{
+		{in: "sc2-123", typ: "sc2", id: 123, ok: true},
+		{in: "qch-7", typ: "qch", id: 7, ok: true},
+		{in: "tl-123", ok: false},
+		{in: "pfw-123", ok: false},
+		{in: "sc2.ics-123", ok: false},
+		{in: "unknown-123", ok: false},
+		{in: "sc2-0", ok: false},
+		{in: "sc2-abc", ok: false},
+		{in: "sc2", ok: false},
+		{in: "-123", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			typ, id, err := ParseEventID(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v, expected valid %t", err, tt.ok)
+			}
+			if tt.ok && (typ != tt.typ || id != tt.id) {
+				t.Errorf("parsed %s %d, expected %s %d", typ, id, tt.typ, tt.id)
+			}
+		})
+	}
+}
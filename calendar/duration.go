@@ -0,0 +1,43 @@
+package calendar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Day      = 24 * time.Hour
+	Week     = 7 * Day
+	Monthish = 31 * Day
+	Yearish  = 365 * Day
+)
+
+// durationUnits are the units ParseDuration accepts on top of the ones supported by time.ParseDuration
+var durationUnits = []struct {
+	suffix string
+	d      time.Duration
+}{
+	{"mo", Monthish},
+	{"y", Yearish},
+	{"w", Week},
+	{"d", Day},
+}
+
+// ParseDuration extends time.ParseDuration with days, weeks, months and years, using the "d", "w", "mo" and "y" units.
+// The units can not be mixed, so "1y" and "36h" are valid, but "1y2d" is not.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for _, u := range durationUnits {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		val, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(val * float64(u.d)), nil
+	}
+	return time.ParseDuration(s)
+}
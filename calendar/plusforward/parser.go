@@ -66,8 +66,6 @@ func LoadEvents(url *url.URL, date time.Time) (events, error) {
 
 	// Find the review items
 	doc.Find("td.cal_day").Each(func(i int, s *goquery.Selection) {
-		cnt := len(s.Nodes)
-		fmt.Sprintf("%d\n", cnt)
 		var day time.Time
 		dateVal := s.Find("div.cal_date").Text()
 		if wdmv, err := time.Parse("MondayJanuary _2", dateVal); err == nil {
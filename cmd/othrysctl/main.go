@@ -25,13 +25,20 @@ func main() {
 				Name:  "debug",
 				Usage: "Output debug messages",
 			},
+			cmd.EphemeralFlag,
 		},
 		Commands: []cli.Command{
 			cmd.ShowTypesCmd,
 			cmd.FetchCmd,
 			cmd.ListCmd,
+			cmd.SearchCmd,
+			cmd.OverrideCmd,
 			cmd.AuthorizeCmd,
 			cmd.PostCmd,
+			cmd.ExportCmd,
+			cmd.ImportCmd,
+			cmd.PruneCmd,
+			cmd.FeedCmd,
 		},
 	}
 
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	_ "time/tzdata"
 
 	"github.com/urfave/cli"
 
@@ -23,6 +24,7 @@ func main() {
 				Usage: "Set storage path",
 				Value: cmd.DataPath(),
 			},
+			cmd.EphemeralFlag,
 		},
 		Commands: []cli.Command{
 			cmd.Server,
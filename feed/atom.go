@@ -0,0 +1,86 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomText       `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// WriteAtom renders the feed as an Atom (RFC 4287) document
+func WriteAtom(w io.Writer, f Feed) error {
+	af := atomFeed{
+		NS:      atomNS,
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  f.Title,
+		Links: []atomLink{
+			{Rel: "self", Type: ContentTypeAtom, Href: f.Self},
+			{Rel: "alternate", Href: f.Link},
+		},
+		Entries: make([]atomEntry, 0, len(f.Entries)),
+	}
+	for _, e := range f.Entries {
+		ae := atomEntry{
+			ID:      e.ID,
+			Title:   e.Title,
+			Link:    atomLink{Rel: "alternate", Href: e.Link},
+			Updated: e.Updated.UTC().Format(time.RFC3339),
+			Content: atomText{Type: "text", Body: e.Content},
+		}
+		if !e.Published.IsZero() {
+			ae.Published = e.Published.UTC().Format(time.RFC3339)
+		}
+		if e.HTML {
+			ae.Content.Type = "html"
+		}
+		for _, c := range e.Categories {
+			ae.Categories = append(ae.Categories, atomCategory{Term: c})
+		}
+		af.Entries = append(af.Entries, ae)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(af)
+}
@@ -0,0 +1,141 @@
+package feed
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/api"
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/post"
+)
+
+// Feed is the format independent representation of a feed, which gets rendered as Atom, RSS or JSON Feed
+type Feed struct {
+	ID      string
+	Title   string
+	Link    string
+	Self    string
+	Updated time.Time
+	Entries []Entry
+}
+
+// Entry is one item of a feed, either an event or the daily digest of events
+type Entry struct {
+	ID         string
+	Title      string
+	Link       string
+	Published  time.Time
+	Updated    time.Time
+	Content    string
+	HTML       bool
+	Categories []string
+}
+
+// tagURI builds a tag URI (RFC 4151) which stays the same for as long as ical.UIDDomain does
+func tagURI(specific string) string {
+	return fmt.Sprintf("tag:%s,2000:%s", ical.UIDDomain, specific)
+}
+
+// updated returns the time of the last revision of the event
+func updated(ev calendar.Event) time.Time {
+	if ev.LastModified.IsZero() {
+		return ev.StartTime
+	}
+	return ev.LastModified
+}
+
+func eventLink(ev calendar.Event, baseURL string) string {
+	if len(ev.Links) > 0 {
+		return ev.Links[0]
+	}
+	return baseURL + api.Prefix + "/events/" + calendar.EventID(ev)
+}
+
+func eventCategories(ev calendar.Event) []string {
+	categories := make([]string, 0, 2)
+	if label, ok := calendar.Labels[ev.Type]; ok {
+		categories = append(categories, label)
+	}
+	if ev.Category != "" {
+		categories = append(categories, ev.Category)
+	}
+	return categories
+}
+
+// EventEntry builds the feed entry for a single event, with the times in the loc location
+func EventEntry(ev calendar.Event, baseURL string, loc *time.Location) (Entry, error) {
+	title, content, err := post.RenderEvent(ev)
+	if err != nil {
+		return Entry{}, err
+	}
+	title = strings.TrimSuffix(strings.TrimSpace(title), ":")
+	if title == "" {
+		title = calendar.Labels[ev.Type]
+	}
+	when := ev.StartTime.In(loc).Format("Monday, 02 Jan 2006 15:04 MST")
+	if ev.Canceled {
+		title = "Canceled: " + title
+	}
+	return Entry{
+		ID:         tagURI("event/" + calendar.EventID(ev)),
+		Title:      title,
+		Link:       eventLink(ev, baseURL),
+		Published:  ev.StartTime,
+		Updated:    updated(ev),
+		Content:    fmt.Sprintf("<p>%s</p>%s", html.EscapeString(when), content),
+		HTML:       true,
+		Categories: eventCategories(ev),
+	}, nil
+}
+
+// DigestEntries builds one feed entry for each day with events, using the same content as the daily posts,
+// the entries link to the day in the calendar at link and their IDs are unique to the selection path of the feed
+func DigestEntries(events calendar.Events, selection, link string, loc *time.Location) ([]Entry, error) {
+	days := make(map[time.Time]calendar.Events)
+	for _, ev := range events {
+		st := ev.StartTime.In(loc)
+		day := time.Date(st.Year(), st.Month(), st.Day(), 0, 0, 0, 0, loc)
+		days[day] = append(days[day], ev)
+	}
+	entries := make([]Entry, 0, len(days))
+	for day, evs := range days {
+		title, content, err := post.RenderDigest(day, evs)
+		if err != nil {
+			return nil, err
+		}
+		e := Entry{
+			ID:        tagURI("digest" + path.Join(selection, day.Format("2006-01-02"))),
+			Title:     title,
+			Link:      link + "#" + day.Format("2006-01-02"),
+			Published: day,
+			Content:   strings.TrimSpace(content),
+		}
+		for _, ev := range evs {
+			if u := updated(ev); u.After(e.Updated) {
+				e.Updated = u
+			}
+			for _, cat := range eventCategories(ev) {
+				if !inStringList(cat, e.Categories) {
+					e.Categories = append(e.Categories, cat)
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Published.Before(entries[j].Published) })
+	return entries, nil
+}
+
+func inStringList(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package feed
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/filter"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// Prefix is the path under which the feeds are served, it is followed by the same paths as the iCal routes
+// and an extension that selects the format: /feeds/upcoming/qch.atom
+const Prefix = "/feeds"
+
+const (
+	ContentTypeAtom     = "application/atom+xml"
+	ContentTypeRSS      = "application/rss+xml"
+	ContentTypeJSONFeed = "application/feed+json"
+)
+
+// DigestDaily is the value of the "digest" parameter that groups the events of each day in a single entry
+const DigestDaily = "daily"
+
+type writerFn func(io.Writer, Feed) error
+
+var formats = map[string]struct {
+	contentType string
+	write       writerFn
+}{
+	".atom": {ContentTypeAtom, WriteAtom},
+	".rss":  {ContentTypeRSS, WriteRSS},
+	".json": {ContentTypeJSONFeed, WriteJSONFeed},
+}
+
+type handler struct {
+	UpcomingPast   time.Duration
+	UpcomingFuture time.Duration
+	st             storage.Loader
+}
+
+type OptionFn func(*handler)
+
+// WithUpcomingWindow sets the window served by the "upcoming" feeds, relative to the time of the request
+func WithUpcomingWindow(past, future time.Duration) OptionFn {
+	return func(h *handler) {
+		if past >= 0 {
+			h.UpcomingPast = past
+		}
+		if future > 0 {
+			h.UpcomingFuture = future
+		}
+	}
+}
+
+func NewHandler(st storage.Loader, opts ...OptionFn) *handler {
+	h := new(handler)
+	h.st = st
+	h.UpcomingPast = ical.DefaultUpcomingPast
+	h.UpcomingFuture = ical.DefaultUpcomingFuture
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+func badRequest(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(err.Error()))
+}
+
+func feedTitle(types []string) string {
+	labels := make([]string, 0, len(types))
+	for _, typ := range types {
+		if label, ok := calendar.Labels[typ]; ok {
+			labels = append(labels, label)
+		}
+	}
+	return fmt.Sprintf("Events for %s", strings.Join(labels, ", "))
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, Prefix)
+	ext := path.Ext(p)
+	format, ok := formats[ext]
+	if !ok {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(fmt.Sprintf("unknown feed format %q, valid ones are .atom, .rss and .json", ext)))
+		return
+	}
+	p = strings.TrimSuffix(p, ext)
+	types, in := ical.ParsePath(&url.URL{Path: p})
+
+	q := r.URL.Query()
+	f, err := filter.FromValues(q)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			badRequest(w, fmt.Errorf("invalid timezone %q", tz))
+			return
+		}
+	}
+	digest := q.Get("digest")
+	if digest != "" && digest != DigestDaily {
+		badRequest(w, fmt.Errorf("invalid digest value %q", digest))
+		return
+	}
+
+	cursor := in.Cursor(time.Now().UTC(), filter.Filters{Past: h.UpcomingPast, Future: h.UpcomingFuture}, f)
+	events, err := storage.Search(h.st, f.Text, cursor, types...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	filtered := make(calendar.Events, 0, len(events))
+	for _, ev := range events {
+		if cursor.Contains(ev.StartTime) && f.Match(ev) {
+			filtered = append(filtered, ev)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].StartTime.Before(filtered[j].StartTime) })
+
+	baseURL := fmt.Sprintf("https://%s", r.Host)
+	selection := *r.URL
+	selection.Path = p
+	fd := Feed{
+		ID:    tagURI("feed" + selection.RequestURI()),
+		Title: feedTitle(types),
+		Link:  baseURL + p,
+		Self:  baseURL + r.URL.RequestURI(),
+	}
+	if digest == DigestDaily {
+		fd.Entries, err = DigestEntries(filtered, p, fd.Link, loc)
+	} else {
+		fd.Entries = make([]Entry, 0, len(filtered))
+		for _, ev := range filtered {
+			var e Entry
+			if e, err = EventEntry(ev, baseURL, loc); err != nil {
+				break
+			}
+			fd.Entries = append(fd.Entries, e)
+		}
+	}
+	for _, e := range fd.Entries {
+		if e.Updated.After(fd.Updated) {
+			fd.Updated = e.Updated
+		}
+	}
+	if fd.Updated.IsZero() {
+		fd.Updated = cursor.T
+	}
+
+	b := &bytes.Buffer{}
+	if err == nil {
+		err = format.write(b, fd)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType+"; charset=utf-8")
+	w.Header().Set("Last-Modified", fd.Updated.UTC().Format(http.TimeFormat))
+	metrics.CountEvents(r, len(filtered))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,58 @@
+package feed
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeedItem struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url,omitempty"`
+	Title         string    `json:"title"`
+	ContentHTML   string    `json:"content_html,omitempty"`
+	ContentText   string    `json:"content_text,omitempty"`
+	DatePublished time.Time `json:"date_published"`
+	DateModified  time.Time `json:"date_modified"`
+	Tags          []string  `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+// WriteJSONFeed renders the feed as a JSON Feed 1.1 document
+func WriteJSONFeed(w io.Writer, f Feed) error {
+	jf := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.Self,
+		Items:       make([]jsonFeedItem, 0, len(f.Entries)),
+	}
+	for _, e := range f.Entries {
+		it := jsonFeedItem{
+			ID:            e.ID,
+			URL:           e.Link,
+			Title:         e.Title,
+			DatePublished: e.Published.UTC(),
+			DateModified:  e.Updated.UTC(),
+			Tags:          e.Categories,
+		}
+		if e.HTML {
+			it.ContentHTML = e.Content
+		} else {
+			it.ContentText = e.Content
+		}
+		jf.Items = append(jf.Items, it)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jf)
+}
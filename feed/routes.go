@@ -0,0 +1,13 @@
+package feed
+
+import (
+	"net/http"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+func Routes(st storage.Loader, opts ...OptionFn) http.Handler {
+	r := http.NewServeMux()
+	r.Handle(Prefix+"/", NewHandler(st, opts...))
+	return r
+}
@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	KindMatches     = "matches"
+	KindTournaments = "tournaments"
+)
+
+// Filters holds the criteria for narrowing down a selection of events, usually received as query parameters
+type Filters struct {
+	// Past and Future define a rolling window relative to the time of the request
+	Past   time.Duration
+	Future time.Duration
+
+	Categories      []string
+	Stages          []string
+	Participants    []string
+	Text            string
+	ExcludeCanceled bool
+	Kind            string
+	MinDuration     time.Duration
+}
+
+func parseDuration(v url.Values, name string) (time.Duration, error) {
+	val := v.Get(name)
+	if val == "" {
+		return 0, nil
+	}
+	d, err := calendar.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s value %q", name, val)
+	}
+	return d, nil
+}
+
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, val := range values {
+		if val = strings.TrimSpace(val); val != "" {
+			result = append(result, val)
+		}
+	}
+	return result
+}
+
+// FromValues loads the filters from query parameters:
+//
+//	past, future: rolling window relative to now, eg: past=7d&future=90d
+//	category, stage, participant: can be repeated, an event matches if it matches any of the values
+//	q: full-text search
+//	canceled: "false" excludes canceled events
+//	kind: "matches" or "tournaments"
+//	min-duration: the minimum duration of events, eg: min-duration=2h
+func FromValues(v url.Values) (Filters, error) {
+	f := Filters{}
+	var err error
+	if f.Past, err = parseDuration(v, "past"); err != nil {
+		return f, err
+	}
+	if f.Future, err = parseDuration(v, "future"); err != nil {
+		return f, err
+	}
+	if f.MinDuration, err = parseDuration(v, "min-duration"); err != nil {
+		return f, err
+	}
+	f.Categories = nonEmpty(v["category"])
+	f.Stages = nonEmpty(v["stage"])
+	f.Participants = nonEmpty(v["participant"])
+	f.Text = strings.TrimSpace(v.Get("q"))
+	if c := v.Get("canceled"); c != "" {
+		include, err := strconv.ParseBool(c)
+		if err != nil {
+			return f, fmt.Errorf("invalid canceled value %q", c)
+		}
+		f.ExcludeCanceled = !include
+	}
+	switch k := strings.ToLower(v.Get("kind")); k {
+	case "", KindMatches, KindTournaments:
+		f.Kind = k
+	default:
+		return f, fmt.Errorf("invalid kind value %q", k)
+	}
+	return f, nil
+}
+
+// HasWindow returns true if the filters define a rolling window
+func (f Filters) HasWindow() bool {
+	return f.Past > 0 || f.Future > 0
+}
+
+// Window returns the cursor for the rolling window relative to now
+func (f Filters) Window(now time.Time) storage.DateCursor {
+	return storage.Cursor(now.Add(-f.Past), f.Past+f.Future)
+}
+
+func containsAny(s string, values []string) bool {
+	s = storage.Normalize(s)
+	for _, val := range values {
+		if strings.Contains(s, storage.Normalize(val)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasParticipant(e calendar.Event, participants []string) bool {
+	for _, p := range participants {
+		if storage.Matches(calendar.Event{Content: e.Content, TagNames: e.TagNames}, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the event satisfies all the filters
+func (f Filters) Match(e calendar.Event) bool {
+	if f.ExcludeCanceled && e.Canceled {
+		return false
+	}
+	if f.Kind == KindMatches && e.IsTournament() || f.Kind == KindTournaments && !e.IsTournament() {
+		return false
+	}
+	if e.Duration < f.MinDuration {
+		return false
+	}
+	if len(f.Categories) > 0 && !containsAny(e.Category, f.Categories) {
+		return false
+	}
+	if len(f.Stages) > 0 && !containsAny(e.Stage, f.Stages) {
+		return false
+	}
+	if len(f.Participants) > 0 && !hasParticipant(e, f.Participants) {
+		return false
+	}
+	return f.Text == "" || storage.Matches(e, f.Text)
+}
+
+// Apply returns the events that satisfy all the filters
+func (f Filters) Apply(events calendar.Events) calendar.Events {
+	result := make(calendar.Events, 0, len(events))
+	for _, e := range events {
+		if f.Match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
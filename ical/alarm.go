@@ -0,0 +1,79 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// AllDayAlarmTime is the time of day at which the alarms for all-day events trigger,
+// it avoids reminding people of a tournament in the middle of the night.
+const AllDayAlarmTime = 9 * time.Hour
+
+// NoAlarms is the value that disables the default alarms for a request
+const NoAlarms = "none"
+
+// ParseAlarms loads the alarm lead times from values like "15m,1h", which can also be repeated.
+// The result is nil if none were received, and empty if alarms were disabled explicitly with "none".
+func ParseAlarms(values []string) ([]time.Duration, error) {
+	var alarms []time.Duration
+	for _, val := range values {
+		for _, a := range strings.Split(val, ",") {
+			if a = strings.TrimSpace(a); a == "" {
+				continue
+			}
+			if alarms == nil {
+				alarms = make([]time.Duration, 0)
+			}
+			if strings.EqualFold(a, NoAlarms) {
+				continue
+			}
+			d, err := calendar.ParseDuration(a)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid alarm value %q", a)
+			}
+			alarms = append(alarms, d)
+		}
+	}
+	return alarms, nil
+}
+
+// allDayTrigger returns the trigger for an all-day event, relative to its start, at AllDayAlarmTime
+// on the day that is at least lead before the start.
+func allDayTrigger(lead time.Duration) time.Duration {
+	days := (lead + calendar.Day - 1) / calendar.Day
+	return -days*calendar.Day + AllDayAlarmTime
+}
+
+// VAlarms builds the VALARM components for an event, individual matches get reminders exactly lead before
+// they start, while the all-day spans get them at AllDayAlarmTime of the corresponding day.
+func VAlarms(ev calendar.Event, allDay bool, leads []time.Duration) []*Component {
+	triggers := make([]time.Duration, 0, len(leads))
+	for _, lead := range leads {
+		trigger := -lead
+		if allDay {
+			trigger = allDayTrigger(lead)
+		}
+		found := false
+		for _, t := range triggers {
+			found = found || t == trigger
+		}
+		if !found {
+			triggers = append(triggers, trigger)
+		}
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i] < triggers[j] })
+
+	alarms := make([]*Component, 0, len(triggers))
+	for _, trigger := range triggers {
+		a := NewComponent("VALARM")
+		a.Text("ACTION", "DISPLAY")
+		a.Text("DESCRIPTION", eventSummary(ev))
+		a.Duration("TRIGGER", trigger)
+		alarms = append(alarms, a)
+	}
+	return alarms
+}
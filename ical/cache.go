@@ -0,0 +1,71 @@
+package ical
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// cacheMaxAge matches the refresh interval we advertise in the calendars
+const cacheMaxAge = time.Hour
+
+// lastModified returns the newest modification time among the events
+func lastModified(events calendar.Events) time.Time {
+	var last time.Time
+	for _, ev := range events {
+		if ev.LastModified.After(last) {
+			last = ev.LastModified
+		}
+	}
+	return last
+}
+
+// eTag builds a weak entity tag from the request URI, the representation and the content of the events,
+// it's weak because the same representation can be served with different content encodings.
+func eTag(r *http.Request, contentType string, events calendar.Events) string {
+	h := fnv.New64a()
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte(contentType))
+	for _, ev := range events {
+		fmt.Fprintf(h, "%s/%d:%d:%d:%s:%s:%s:%t:%s\n", ev.Type, ev.CalID, ev.StartTime.Unix(), ev.Duration,
+			ev.Category, ev.Stage, ev.Content, ev.Canceled, strings.Join(ev.Links, " "))
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+func setCacheHeaders(h http.Header, etag string, modified time.Time) {
+	h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cacheMaxAge.Seconds())))
+	h.Set("ETag", etag)
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+func stripWeak(tag string) string {
+	return strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+}
+
+// notModified checks the conditional request headers, with If-None-Match taking precedence over If-Modified-Since
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			if t := strings.TrimSpace(tag); t == "*" || stripWeak(t) == stripWeak(etag) {
+				return true
+			}
+		}
+		return false
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
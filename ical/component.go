@@ -0,0 +1,236 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Value types from RFC 5545 section 3.3
+const (
+	TypeText      = "TEXT"
+	TypeDate      = "DATE"
+	TypeDateTime  = "DATE-TIME"
+	TypeDuration  = "DURATION"
+	TypeInteger   = "INTEGER"
+	TypeURI       = "URI"
+	TypeUTCOffset = "UTC-OFFSET"
+)
+
+const (
+	formatDate          = "20060102"
+	formatDateTime      = "20060102T150405"
+	formatDateTimeUTC   = "20060102T150405Z"
+	maxLineOctets       = 75
+	lineSeparator       = "\r\n"
+	continuationLineSep = lineSeparator + " "
+)
+
+// Param is a property parameter, like the TZID in DTSTART;TZID=Europe/Paris:20230102T150000
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Property is an iCalendar content line, the values are kept unescaped and in the iCalendar format
+// of their type, so they can be serialized to other representations like jCal and xCal.
+type Property struct {
+	Name   string
+	Params []Param
+	Type   string
+	Values []string
+}
+
+// Component is an iCalendar component like VCALENDAR, VEVENT or VTIMEZONE
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+// Add appends a property with the received type and values, and returns the component to allow chaining
+func (c *Component) Add(name, typ string, values ...string) *Component {
+	c.Properties = append(c.Properties, Property{Name: name, Type: typ, Values: values})
+	return c
+}
+
+// AddWithParams appends a property that has parameters
+func (c *Component) AddWithParams(name, typ string, params []Param, values ...string) *Component {
+	c.Properties = append(c.Properties, Property{Name: name, Params: params, Type: typ, Values: values})
+	return c
+}
+
+func (c *Component) Text(name string, values ...string) *Component {
+	return c.Add(name, TypeText, values...)
+}
+
+func (c *Component) URI(name, value string) *Component {
+	return c.Add(name, TypeURI, value)
+}
+
+func (c *Component) Integer(name string, value int) *Component {
+	return c.Add(name, TypeInteger, fmt.Sprintf("%d", value))
+}
+
+func (c *Component) Duration(name string, d time.Duration) *Component {
+	return c.Add(name, TypeDuration, FormatDuration(d))
+}
+
+// Date adds a DATE property
+func (c *Component) Date(name string, t time.Time) *Component {
+	return c.AddWithParams(name, TypeDate, []Param{{Name: "VALUE", Value: TypeDate}}, t.Format(formatDate))
+}
+
+// DateTime adds a DATE-TIME property, in UTC form if the location of t is UTC, otherwise as local time
+// with a TZID parameter, which needs a matching VTIMEZONE component in the calendar.
+func (c *Component) DateTime(name string, t time.Time) *Component {
+	if t.Location() == time.UTC {
+		return c.Add(name, TypeDateTime, t.Format(formatDateTimeUTC))
+	}
+	return c.AddWithParams(name, TypeDateTime, []Param{{Name: "TZID", Value: t.Location().String()}}, t.Format(formatDateTime))
+}
+
+// Get returns the first property with the received name
+func (c *Component) Get(name string) (Property, bool) {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// FormatDuration formats a duration according to RFC 5545 section 3.3.6
+func FormatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	if d == 0 {
+		return "PT0S"
+	}
+	s := strings.Builder{}
+	s.WriteString(sign)
+	s.WriteString("P")
+	if d%(7*24*time.Hour) == 0 {
+		fmt.Fprintf(&s, "%dW", d/(7*24*time.Hour))
+		return s.String()
+	}
+	if days := d / (24 * time.Hour); days > 0 {
+		fmt.Fprintf(&s, "%dD", days)
+		d -= days * 24 * time.Hour
+	}
+	if d == 0 {
+		return s.String()
+	}
+	s.WriteString("T")
+	if h := d / time.Hour; h > 0 {
+		fmt.Fprintf(&s, "%dH", h)
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		fmt.Fprintf(&s, "%dM", m)
+		d -= m * time.Minute
+	}
+	if sec := d / time.Second; sec > 0 {
+		fmt.Fprintf(&s, "%dS", sec)
+	}
+	return s.String()
+}
+
+// FormatUTCOffset formats an offset in seconds according to RFC 5545 section 3.3.14
+func FormatUTCOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	if sec := offset % 60; sec != 0 {
+		return fmt.Sprintf("%c%02d%02d%02d", sign, offset/3600, offset%3600/60, sec)
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func encodeParamValue(s string) string {
+	s = strings.NewReplacer(`"`, "'", "\r", "", "\n", " ").Replace(s)
+	if strings.ContainsAny(s, ":;,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+func (p Property) contentLine() string {
+	line := strings.Builder{}
+	line.WriteString(p.Name)
+	for _, par := range p.Params {
+		line.WriteString(";")
+		line.WriteString(par.Name)
+		line.WriteString("=")
+		line.WriteString(encodeParamValue(par.Value))
+	}
+	line.WriteString(":")
+	values := p.Values
+	if p.Type == TypeText {
+		values = make([]string, len(p.Values))
+		for i, v := range p.Values {
+			values[i] = escapeText(v)
+		}
+	}
+	line.WriteString(strings.Join(values, ","))
+	return line.String()
+}
+
+// fold splits content lines longer than 75 octets, without breaking UTF-8 sequences
+func fold(line string) string {
+	if len(line) <= maxLineOctets {
+		return line
+	}
+	s := strings.Builder{}
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		s.WriteString(line[:cut])
+		s.WriteString(continuationLineSep)
+		line = line[cut:]
+		// continuation lines start with a space, which counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	s.WriteString(line)
+	return s.String()
+}
+
+func (c *Component) encode(w *bufio.Writer) {
+	w.WriteString("BEGIN:" + c.Name + lineSeparator)
+	for _, p := range c.Properties {
+		w.WriteString(fold(p.contentLine()))
+		w.WriteString(lineSeparator)
+	}
+	for _, sub := range c.Components {
+		sub.encode(w)
+	}
+	w.WriteString("END:" + c.Name + lineSeparator)
+}
+
+// Encode writes the component in the iCalendar format
+func (c *Component) Encode(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	c.encode(b)
+	return b.Flush()
+}
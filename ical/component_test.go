@@ -0,0 +1,352 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	goical "github.com/emersion/go-ical"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// decodeStrict checks the raw calendar against the RFC 5545 rules the decoder doesn't enforce:
+// CRLF line endings, lines of at most 75 octets, and TZID parameters that reference a VTIMEZONE of the calendar,
+// then decodes it.
+func decodeStrict(t *testing.T, raw []byte) *goical.Calendar {
+	t.Helper()
+	if !bytes.HasSuffix(raw, []byte("\r\n")) {
+		t.Fatalf("the calendar doesn't end with CRLF")
+	}
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\r\n"), "\r\n")
+	for i, line := range lines {
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("line %d contains a bare CR or LF: %q", i+1, line)
+		}
+		if len(line) > maxLineOctets {
+			t.Errorf("line %d is %d octets long: %q", i+1, len(line), line)
+		}
+	}
+
+	cal, err := goical.NewDecoder(bytes.NewReader(raw)).Decode()
+	if err != nil {
+		t.Fatalf("unable to decode calendar: %s\n%s", err, raw)
+	}
+	for _, name := range []string{goical.PropVersion, goical.PropProductID} {
+		if len(cal.Props.Values(name)) != 1 {
+			t.Errorf("the calendar needs exactly one %s", name)
+		}
+	}
+
+	timezones := make(map[string]bool)
+	for _, c := range cal.Children {
+		if c.Name != goical.CompTimezone {
+			continue
+		}
+		tzid := c.Props.Get(goical.PropTimezoneID)
+		if tzid == nil {
+			t.Errorf("VTIMEZONE without TZID")
+			continue
+		}
+		timezones[tzid.Value] = true
+		if len(c.Children) == 0 {
+			t.Errorf("VTIMEZONE %s without observances", tzid.Value)
+		}
+		for _, o := range c.Children {
+			if o.Name != goical.CompTimezoneStandard && o.Name != goical.CompTimezoneDaylight {
+				t.Errorf("invalid VTIMEZONE component %s", o.Name)
+			}
+			for _, name := range []string{goical.PropDateTimeStart, goical.PropTimezoneOffsetFrom, goical.PropTimezoneOffsetTo} {
+				if o.Props.Get(name) == nil {
+					t.Errorf("%s of %s without %s", o.Name, tzid.Value, name)
+				}
+			}
+		}
+	}
+	var checkTZIDs func(c *goical.Component)
+	checkTZIDs = func(c *goical.Component) {
+		for name, props := range c.Props {
+			for _, p := range props {
+				if tzid := p.Params.Get(goical.ParamTimezoneID); tzid != "" && !timezones[tzid] {
+					t.Errorf("%s references TZID %s without a VTIMEZONE", name, tzid)
+				}
+			}
+		}
+		for _, child := range c.Children {
+			checkTZIDs(child)
+		}
+	}
+	checkTZIDs(cal.Component)
+
+	for _, ev := range cal.Events() {
+		for _, name := range []string{goical.PropUID, goical.PropDateTimeStamp, goical.PropDateTimeStart} {
+			if len(ev.Props.Values(name)) != 1 {
+				t.Errorf("VEVENT needs exactly one %s", name)
+			}
+		}
+		if ev.Props.Get(goical.PropDateTimeEnd) != nil && ev.Props.Get(goical.PropDuration) != nil {
+			t.Errorf("VEVENT can't have both DTEND and DURATION")
+		}
+		start, end := ev.Props.Get(goical.PropDateTimeStart), ev.Props.Get(goical.PropDateTimeEnd)
+		if start != nil && end != nil && start.ValueType() != end.ValueType() {
+			t.Errorf("DTSTART is %s and DTEND is %s", start.ValueType(), end.ValueType())
+		}
+	}
+	return cal
+}
+
+func encode(t *testing.T, c *Component) []byte {
+	t.Helper()
+	b := bytes.Buffer{}
+	if err := c.Encode(&b); err != nil {
+		t.Fatalf("unable to encode calendar: %s", err)
+	}
+	return b.Bytes()
+}
+
+func findEvent(t *testing.T, cal *goical.Calendar, uid string) goical.Event {
+	t.Helper()
+	for _, ev := range cal.Events() {
+		if id, _ := ev.Props.Text(goical.PropUID); id == uid {
+			return ev
+		}
+	}
+	t.Fatalf("no event with UID %s", uid)
+	return goical.Event{}
+}
+
+func TestVEvent(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no timezone data: %s", err)
+	}
+	match := calendar.Event{CalID: 1, Type: "sc2", StartTime: time.Date(2024, time.March, 30, 18, 0, 0, 0, time.UTC), Duration: 2 * time.Hour, Category: "Test Cup", Stage: "Group A", LastModified: time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)}
+	tournament := calendar.Event{CalID: 2, Type: "sc2", StartTime: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), Duration: 3 * calendar.Day, Category: "Test Cup", Stage: "Main Event"}
+	canceled := calendar.Event{CalID: 3, Type: "sc2", StartTime: time.Date(2024, time.March, 31, 18, 0, 0, 0, time.UTC), Duration: time.Hour, Category: "Test Cup", Canceled: true}
+	long := calendar.Event{
+		CalID: 4, Type: "sc2", StartTime: time.Date(2024, time.April, 2, 18, 0, 0, 0, time.UTC), Duration: time.Hour,
+		Category: "Ünïcödé Cüp, with; séparators",
+		Content:  strings.Repeat("Zoë vs Chloé — 日本語の説明, ", 12),
+		Links:    []string{"https://liquipedia.net/starcraft2/Test_Cup/" + strings.Repeat("Season_", 10)},
+	}
+	events := calendar.Events{match, tournament, canceled, long}
+
+	tests := []struct {
+		name   string
+		loc    *time.Location
+		alarms []time.Duration
+		check  func(t *testing.T, cal *goical.Calendar)
+	}{
+		{
+			name: "UID",
+			loc:  time.UTC,
+			check: func(t *testing.T, cal *goical.Calendar) {
+				seen := make(map[string]bool)
+				for _, ev := range cal.Events() {
+					uid, _ := ev.Props.Text(goical.PropUID)
+					if seen[uid] {
+						t.Errorf("duplicate UID %s", uid)
+					}
+					seen[uid] = true
+				}
+				for _, ev := range events {
+					if !seen[EventUID(ev)] {
+						t.Errorf("missing UID %s", EventUID(ev))
+					}
+				}
+			},
+		},
+		{
+			name:   "cancelled",
+			loc:    time.UTC,
+			alarms: []time.Duration{15 * time.Minute},
+			check: func(t *testing.T, cal *goical.Calendar) {
+				ev := findEvent(t, cal, EventUID(canceled))
+				if status, _ := ev.Props.Text(goical.PropStatus); status != "CANCELLED" {
+					t.Errorf("STATUS %s, expected CANCELLED", status)
+				}
+				if len(ev.Children) > 0 {
+					t.Errorf("cancelled events shouldn't have alarms")
+				}
+				ev = findEvent(t, cal, EventUID(match))
+				if status, _ := ev.Props.Text(goical.PropStatus); status != "CONFIRMED" {
+					t.Errorf("STATUS %s, expected CONFIRMED", status)
+				}
+				if len(ev.Children) != 1 || ev.Children[0].Name != goical.CompAlarm {
+					t.Errorf("expected one VALARM for the event")
+				}
+			},
+		},
+		{
+			name: "all day in UTC",
+			loc:  time.UTC,
+			check: func(t *testing.T, cal *goical.Calendar) {
+				ev := findEvent(t, cal, EventUID(tournament))
+				start, end := ev.Props.Get(goical.PropDateTimeStart), ev.Props.Get(goical.PropDateTimeEnd)
+				if start.ValueType() != goical.ValueDate || start.Value != "20240401" {
+					t.Errorf("DTSTART %s %s, expected DATE 20240401", start.ValueType(), start.Value)
+				}
+				// the end of all day events is exclusive
+				if end.ValueType() != goical.ValueDate || end.Value != "20240404" {
+					t.Errorf("DTEND %s %s, expected DATE 20240404", end.ValueType(), end.Value)
+				}
+			},
+		},
+		{
+			name: "not all day in another timezone",
+			loc:  paris,
+			check: func(t *testing.T, cal *goical.Calendar) {
+				ev := findEvent(t, cal, EventUID(tournament))
+				start, err := ev.DateTimeStart(nil)
+				if err != nil {
+					t.Fatalf("invalid DTSTART: %s", err)
+				}
+				if !start.Equal(tournament.StartTime) {
+					t.Errorf("DTSTART %s, expected %s", start, tournament.StartTime)
+				}
+				if tzid := ev.Props.Get(goical.PropDateTimeStart).Params.Get(goical.ParamTimezoneID); tzid != paris.String() {
+					t.Errorf("DTSTART TZID %q, expected %q", tzid, paris.String())
+				}
+			},
+		},
+		{
+			name: "timezone across the DST change",
+			loc:  paris,
+			check: func(t *testing.T, cal *goical.Calendar) {
+				var tz *goical.Component
+				for _, c := range cal.Children {
+					if c.Name == goical.CompTimezone {
+						tz = c
+					}
+				}
+				if tz == nil {
+					t.Fatalf("no VTIMEZONE in the calendar")
+				}
+				daylight := false
+				for _, o := range tz.Children {
+					if o.Name != goical.CompTimezoneDaylight {
+						continue
+					}
+					daylight = true
+					if start := o.Props.Get(goical.PropDateTimeStart); start.Value != "20240331T020000" {
+						t.Errorf("DAYLIGHT starts at %s, expected 20240331T020000", start.Value)
+					}
+					if to := o.Props.Get(goical.PropTimezoneOffsetTo); to.Value != "+0200" {
+						t.Errorf("DAYLIGHT offset %s, expected +0200", to.Value)
+					}
+				}
+				if !daylight {
+					t.Errorf("no DAYLIGHT observance for the change on 2024-03-31")
+				}
+				for _, want := range events {
+					ev := findEvent(t, cal, EventUID(want))
+					start, err := ev.DateTimeStart(nil)
+					if err != nil {
+						t.Fatalf("invalid DTSTART: %s", err)
+					}
+					end, err := ev.DateTimeEnd(nil)
+					if err != nil {
+						t.Fatalf("invalid DTEND: %s", err)
+					}
+					if !start.Equal(want.StartTime) || !end.Equal(want.StartTime.Add(want.Duration)) {
+						t.Errorf("event %s at %s - %s, expected %s - %s", EventUID(want), start, end, want.StartTime, want.StartTime.Add(want.Duration))
+					}
+				}
+			},
+		},
+		{
+			name: "sequence",
+			loc:  time.UTC,
+			check: func(t *testing.T, cal *goical.Calendar) {
+				ev := findEvent(t, cal, EventUID(match))
+				seq, err := ev.Props.Get(goical.PropSequence).Int()
+				if err != nil {
+					t.Fatalf("invalid SEQUENCE: %s", err)
+				}
+				if seq != sequence(match) || seq <= 0 {
+					t.Errorf("SEQUENCE %d, expected %d", seq, sequence(match))
+				}
+				updated := match
+				updated.LastModified = match.LastModified.Add(time.Minute)
+				if sequence(updated) <= seq {
+					t.Errorf("SEQUENCE %d of the updated event isn't greater than %d", sequence(updated), seq)
+				}
+				ev = findEvent(t, cal, EventUID(tournament))
+				if seq, _ := ev.Props.Get(goical.PropSequence).Int(); seq != 0 {
+					t.Errorf("SEQUENCE %d for an event never modified, expected 0", seq)
+				}
+			},
+		},
+		{
+			name: "line folding",
+			loc:  time.UTC,
+			check: func(t *testing.T, cal *goical.Calendar) {
+				ev := findEvent(t, cal, EventUID(long))
+				if description, _ := ev.Props.Text(goical.PropDescription); description != eventDescription(long) {
+					t.Errorf("DESCRIPTION %q, expected %q", description, eventDescription(long))
+				}
+				if summary, _ := ev.Props.Text(goical.PropSummary); summary != eventSummary(long) {
+					t.Errorf("SUMMARY %q, expected %q", summary, eventSummary(long))
+				}
+				if u := ev.Props.Get(goical.PropURL); u == nil || u.Value != long.Links[0] {
+					t.Errorf("URL %v, expected %s", u, long.Links[0])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := encode(t, NewCalendar("test", []string{"sc2"}, events, tt.loc, tt.alarms...))
+			tt.check(t, decodeStrict(t, raw))
+		})
+	}
+}
+
+func TestCalendarColor(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []string
+		want  string
+	}{
+		{name: "single type", types: []string{"sc2"}, want: calendar.Colors["sc2"]},
+		{name: "multiple types", types: []string{"sc2", "dota"}},
+		{name: "all types"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal := decodeStrict(t, encode(t, NewCalendar("test", tt.types, nil, time.UTC)))
+			color := ""
+			if p := cal.Props.Get(goical.PropColor); p != nil {
+				color = p.Value
+			}
+			if color != tt.want {
+				t.Errorf("COLOR %q, expected %q", color, tt.want)
+			}
+		})
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []string{
+		"SUMMARY:short",
+		"DESCRIPTION:" + strings.Repeat("a", 200),
+		"DESCRIPTION:" + strings.Repeat("é", 100),
+		"DESCRIPTION:" + strings.Repeat("日本語", 40),
+	}
+	for _, line := range tests {
+		folded := fold(line)
+		for _, l := range strings.Split(folded, lineSeparator) {
+			if len(l) > maxLineOctets {
+				t.Errorf("folded line is %d octets long", len(l))
+			}
+			if !utf8.ValidString(l) {
+				t.Errorf("folded line breaks a UTF-8 sequence: %q", l)
+			}
+		}
+		if unfolded := strings.ReplaceAll(folded, continuationLineSep, ""); unfolded != line {
+			t.Errorf("unfolded line %q, expected %q", unfolded, line)
+		}
+	}
+}
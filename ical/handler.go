@@ -3,6 +3,7 @@ package ical
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
@@ -10,151 +11,463 @@ import (
 	"strings"
 	"time"
 
-	"github.com/soh335/ical"
-
 	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/filter"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
 	"git.sr.ht/~mariusor/othrys/storage"
-	"git.sr.ht/~mariusor/othrys/storage/boltdb"
+)
+
+// DefaultUpcomingPast and DefaultUpcomingFuture define the window served by the "upcoming" route
+const (
+	DefaultUpcomingPast   = calendar.Week
+	DefaultUpcomingFuture = 90 * calendar.Day
 )
 
 type cal struct {
-	Version string
-	Path    string
+	Version        string
+	UpcomingPast   time.Duration
+	UpcomingFuture time.Duration
+	Alarms         []time.Duration
+	st             storage.Loader
+	html           http.Handler
+}
+
+type OptionFn func(*cal)
+
+// WithUpcomingWindow sets the window served by the "upcoming" route, relative to the time of the request
+func WithUpcomingWindow(past, future time.Duration) OptionFn {
+	return func(c *cal) {
+		if past >= 0 {
+			c.UpcomingPast = past
+		}
+		if future > 0 {
+			c.UpcomingFuture = future
+		}
+	}
+}
+
+// WithAlarms sets the default reminders for the events, used when requests don't specify their own
+func WithAlarms(alarms ...time.Duration) OptionFn {
+	return func(c *cal) {
+		c.Alarms = alarms
+	}
 }
 
-func NewHandler(p string) *cal {
+// WithHTMLView sets the handler for the requests that prefer HTML, like the ones coming from browsers
+func WithHTMLView(h http.Handler) OptionFn {
+	return func(c *cal) {
+		c.html = h
+	}
+}
+
+func NewHandler(st storage.Loader, opts ...OptionFn) *cal {
 	c := new(cal)
-	c.Path = p
+	c.st = st
+	c.UpcomingPast = DefaultUpcomingPast
+	c.UpcomingFuture = DefaultUpcomingFuture
+	for _, fn := range opts {
+		fn(c)
+	}
 	return c
 }
 
-func getContentType(u *url.URL) string {
-	typ := "text/calendar; charset=utf-8"
-	if path.Ext(u.Path) == ".txt" {
-		typ = "text/plain; chaset=utf-8"
+// Media types of the calendar representations we can serve
+const (
+	ContentTypeICal = "text/calendar"
+	ContentTypeJCal = "application/calendar+json"
+	ContentTypeXCal = "application/calendar+xml"
+	ContentTypeText = "text/plain"
+	ContentTypeHTML = "text/html"
+)
+
+var extensionTypes = map[string]string{
+	".ics":  ContentTypeICal,
+	".txt":  ContentTypeText,
+	".json": ContentTypeJCal,
+	".xml":  ContentTypeXCal,
+	".html": ContentTypeHTML,
+}
+
+// getContentType picks the representation of the calendar, from the extension of the path if it has one,
+// otherwise from the preferred media type in the Accept header that we can serve.
+func getContentType(r *http.Request) string {
+	if typ, ok := extensionTypes[path.Ext(r.URL.Path)]; ok {
+		return typ
+	}
+	best, bestQ := ContentTypeICal, 0.0
+	for _, acc := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, _ := strings.Cut(acc, ";")
+		q := 1.0
+		if val, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				q = f
+			}
+		}
+		switch mt = strings.ToLower(strings.TrimSpace(mt)); mt {
+		case ContentTypeICal, ContentTypeJCal, ContentTypeXCal, ContentTypeHTML:
+			if q > bestQ {
+				best, bestQ = mt, q
+			}
+		}
+	}
+	return best
+}
+
+// encoderFor returns the function that serializes the calendar in the contentType representation
+func encoderFor(cal *Component, contentType string) func(io.Writer) error {
+	switch contentType {
+	case ContentTypeJCal:
+		return cal.EncodeJSON
+	case ContentTypeXCal:
+		return cal.EncodeXML
+	}
+	return cal.Encode
+}
+
+// UpcomingPath is the path element that selects a window relative to the time of the request, instead of calendar years
+const UpcomingPath = "upcoming"
+
+// Interval is the period of time selected by a request, either a range of calendar years,
+// or the upcoming window relative to the time of the request.
+type Interval struct {
+	From, To int
+	Upcoming bool
+}
+
+// MinYear and MaxYear bound the years that can be requested, the storage only holds events of this century.
+// MaxYearSpan is the largest number of years a single request can load.
+const (
+	MinYear     = 2000
+	MaxYear     = 2099
+	MaxYearSpan = 5
+)
+
+// ParseYears parses a single year, or a range of years like 2023-2025.
+// The years get clamped to the MinYear - MaxYear interval, and ranges spanning more than MaxYearSpan years are invalid.
+func ParseYears(s string) (int, int, bool) {
+	first, last, isRange := strings.Cut(s, "-")
+	from, err := strconv.ParseInt(first, 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.ParseInt(last, 10, 32); err != nil || to < from {
+			return 0, 0, false
+		}
+	}
+	if to < MinYear || from > MaxYear {
+		return 0, 0, false
+	}
+	from, to = max(from, MinYear), min(to, MaxYear)
+	if to-from >= MaxYearSpan {
+		return 0, 0, false
 	}
-	return typ
+	return int(from), int(to), true
 }
 
-func parsePath(u *url.URL) ([]string, int) {
-	year := int64(time.Now().Year())
+// ParsePath loads the calendar types and the interval from paths with the format:
+// /[year[-year]/]type+type or /upcoming[/type+type]
+// When the path doesn't contain types, it returns the default calendars, and when the year is invalid it returns none.
+func ParsePath(u *url.URL) ([]string, Interval) {
+	year := time.Now().Year()
+	in := Interval{From: year, To: year}
 	if u == nil {
-		return calendar.DefaultCalendars, int(year)
+		return calendar.GetTypes(calendar.DefaultCalendars), in
 	}
+	pieces := make([]string, 0)
 	p := u.Path
-	types := make([]string, 0)
-	pieces := strings.Split(p, "/")[1:]
+	p = strings.TrimSuffix(p, path.Ext(p))
+	for _, piece := range strings.Split(p, "/") {
+		if len(piece) > 0 {
+			pieces = append(pieces, piece)
+		}
+	}
 	if len(pieces) == 0 {
-		return calendar.DefaultCalendars, int(year)
+		return calendar.GetTypes(calendar.DefaultCalendars), in
 	}
 	var typesS string
-	if len(pieces) == 1 {
-		if maybeYear, err := strconv.ParseInt(strings.Replace(pieces[0], "/", "", -1), 10, 32); err == nil {
-			year = maybeYear
-			types = calendar.DefaultCalendars
-		} else {
-			typesS = pieces[0]
-		}
+	if from, to, ok := ParseYears(pieces[0]); ok {
+		in.From, in.To = from, to
+	} else if pieces[0] == UpcomingPath {
+		in.Upcoming = true
+	} else if len(pieces) > 1 {
+		// an invalid or out of bounds year doesn't select any calendars
+		return []string{}, in
+	} else {
+		typesS = pieces[0]
 	}
 	if len(pieces) > 1 {
-		if maybeYear, err := strconv.ParseInt(strings.Replace(pieces[len(pieces)-2], "/", "", -1), 10, 32); err == nil {
-			year = maybeYear
-		}
 		typesS = pieces[len(pieces)-1]
 	}
-	if len(typesS) > 0 {
-		types = strings.Split(typesS, "+")
+	if len(typesS) == 0 {
+		return calendar.GetTypes(calendar.DefaultCalendars), in
 	}
-	types = calendar.GetTypes(types)
-	return types, int(year)
+	return calendar.GetTypes(strings.Split(typesS, "+")), in
+}
+
+// Cursor returns the date cursor for the interval, taking into account the rolling window from the filters
+func (in Interval) Cursor(now time.Time, upcoming filter.Filters, f filter.Filters) storage.DateCursor {
+	if in.Upcoming {
+		if f.Past > 0 {
+			upcoming.Past = f.Past
+		}
+		if f.Future > 0 {
+			upcoming.Future = f.Future
+		}
+		return upcoming.Window(now)
+	}
+	if f.HasWindow() {
+		return f.Window(now)
+	}
+	start := time.Date(in.From, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(in.To+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return storage.Cursor(start, end.Sub(start)-time.Second)
+}
+
+func filterEvents(events calendar.Events, cursor storage.DateCursor, f filter.Filters) calendar.Events {
+	result := make(calendar.Events, 0, len(events))
+	for _, e := range events {
+		if cursor.Contains(e.StartTime) && f.Match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
 }
 
 func (c *cal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	types, yearURL := parsePath(r.URL)
-	dateURL := fmt.Sprintf("%d-01-01 00:00:00", yearURL)
+	contentType := getContentType(r)
+	if contentType == ContentTypeHTML {
+		if c.html != nil {
+			w.Header().Add("Vary", "Accept")
+			c.html.ServeHTTP(w, r)
+			return
+		}
+		contentType = ContentTypeICal
+	}
+	types, in := ParsePath(r.URL)
+	if len(types) == 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(fmt.Sprintf("no valid calendars in %q", r.URL.Path)))
+		return
+	}
+
+	f, err := filter.FromValues(r.URL.Query())
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	loc := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("invalid timezone %q", tz)))
+			return
+		}
+	}
+	alarms, err := ParseAlarms(r.URL.Query()["alarm"])
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if alarms == nil {
+		alarms = c.Alarms
+	}
+	cursor := in.Cursor(time.Now().UTC(), filter.Filters{Past: c.UpcomingPast, Future: c.UpcomingFuture}, f)
+	events, err := storage.Search(c.st, f.Text, cursor, types...)
+	if err == nil {
+		events = filterEvents(events, cursor, f)
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Add("Vary", "Accept")
+	if err == nil {
+		etag, modified := eTag(r, contentType, events), lastModified(events)
+		setCacheHeaders(w.Header(), etag, modified)
+		if notModified(r, etag, modified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	cal := NewCalendar(c.Version, types, events, loc, alarms...)
+	cal.URI("URL", fmt.Sprintf("https://%s%s", r.Host, r.URL.Path))
+
+	b := &bytes.Buffer{}
+	if err == nil {
+		err = encoderFor(cal, contentType)(b)
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fmt.Sprintf("%s", err)))
+		return
+	}
+	metrics.CountEvents(r, len(events))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+
+// Write encodes the events as a single iCalendar object to w.
+func Write(w io.Writer, events calendar.Events, types ...string) error {
+	return NewCalendar("", types, events, time.UTC).Encode(w)
+}
+
+// UIDDomain is the right hand side of the UIDs of the events, it needs to stay the same for UIDs to be stable
+var UIDDomain = "othrys"
+
+// EventUID returns the globally unique identifier of the event
+func EventUID(ev calendar.Event) string {
+	return calendar.EventID(ev) + "@" + UIDDomain
+}
+
+// sequenceEpoch is the reference for computing the SEQUENCE of events from their modification time
+var sequenceEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// sequence returns the revision number of the event, as the minutes elapsed between sequenceEpoch and its last modification.
+// It doesn't count the revisions one by one, but it only increases when the event changes, which is what clients check.
+func sequence(ev calendar.Event) int {
+	if ev.LastModified.Before(sequenceEpoch) {
+		return 0
+	}
+	return int(ev.LastModified.Sub(sequenceEpoch) / time.Minute)
+}
+
+// isAllDay returns true for events that start at midnight and last for whole days in the loc location
+func isAllDay(ev calendar.Event, loc *time.Location) bool {
+	start := ev.StartTime.In(loc)
+	end := ev.StartTime.Add(ev.Duration).In(loc)
+	midnight := func(t time.Time) bool {
+		return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0
+	}
+	return ev.Duration > 0 && midnight(start) && midnight(end)
+}
+
+func eventSummary(ev calendar.Event) string {
+	summary := ev.Stage
+	if ev.Category != "" {
+		summary = fmt.Sprintf("[%s] %s: %s", ev.Type, ev.Category, summary)
+	}
+	return strings.TrimSpace(summary)
+}
 
-	var date time.Time
-	var err error
-	date, _ = time.Parse("2006-01-02 15:04:05", dateURL)
-	st := boltdb.New(boltdb.Config{
-		Path:  path.Join(c.Path, boltdb.DefaultFile),
-		LogFn: nil,
-		ErrFn: nil,
-	})
-	// use one year
-	duration := 8759*time.Hour + 59*time.Minute + 59*time.Second
-	if !date.IsZero() {
-		date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+func eventDescription(ev calendar.Event) string {
+	description := ev.Content
+	if len(ev.Links) > 0 {
+		description = strings.TrimSpace(description + "\n\n" + strings.Join(ev.Links, "\n"))
 	}
+	return description
+}
 
-	events, err := st.LoadEvents(storage.DateCursor{T: date, D: duration}, types...)
+// VEvent builds the VEVENT component for the event, with the times in the loc location,
+// and reminders for each of the alarms lead times
+func VEvent(ev calendar.Event, loc *time.Location, alarms ...time.Duration) *Component {
+	e := NewComponent("VEVENT")
+	e.Text("UID", EventUID(ev))
 
-	cal := ical.NewBasicVCalendar()
-	cal.PRODID = fmt.Sprintf("-//TL//ESPORTS-CAL//EN/%s", c.Version)
+	stamp := ev.StartTime
+	if !ev.LastModified.IsZero() {
+		stamp = ev.LastModified
+	}
+	e.DateTime("DTSTAMP", stamp.UTC())
+	if !ev.LastModified.IsZero() {
+		e.DateTime("LAST-MODIFIED", ev.LastModified.UTC())
+	}
+	allDay := isAllDay(ev, loc)
+	if allDay {
+		e.Date("DTSTART", ev.StartTime.In(loc))
+		e.Date("DTEND", ev.StartTime.Add(ev.Duration).In(loc))
+	} else {
+		e.DateTime("DTSTART", ev.StartTime.In(loc))
+		e.DateTime("DTEND", ev.StartTime.Add(ev.Duration).In(loc))
+	}
+	e.Integer("SEQUENCE", sequence(ev))
+	e.Text("SUMMARY", eventSummary(ev))
+	if description := eventDescription(ev); description != "" {
+		e.Text("DESCRIPTION", description)
+	}
+	if len(ev.Links) > 0 {
+		e.URI("URL", ev.Links[0])
+	}
+	categories := make([]string, 0, 2)
+	if label, ok := calendar.Labels[ev.Type]; ok {
+		categories = append(categories, label)
+	}
+	if ev.Category != "" {
+		categories = append(categories, ev.Category)
+	}
+	if len(categories) > 0 {
+		e.Text("CATEGORIES", categories...)
+	}
+	status := "CONFIRMED"
+	if ev.Canceled {
+		status = "CANCELLED"
+	}
+	e.Text("STATUS", status)
+	e.Text("TRANSP", "TRANSPARENT")
+	if !ev.Canceled {
+		e.Components = append(e.Components, VAlarms(ev, allDay, alarms)...)
+	}
+	return e
+}
 
-	cal.VERSION = "2.0"
-	cal.URL = fmt.Sprintf("https://%s%s", r.Host, r.URL.Path)
+// NewCalendar builds the VCALENDAR component for the events, with the times in the loc location
+// and reminders for each of the alarms lead times
+func NewCalendar(version string, types []string, events calendar.Events, loc *time.Location, alarms ...time.Duration) *Component {
+	if loc == nil {
+		loc = time.UTC
+	}
+	cal := NewComponent("VCALENDAR")
+	cal.Text("VERSION", "2.0")
+	cal.Text("PRODID", strings.TrimSuffix(fmt.Sprintf("-//TL//ESPORTS-CAL//EN/%s", version), "/"))
+	cal.Text("CALSCALE", "GREGORIAN")
+	cal.Text("METHOD", "PUBLISH")
 
 	name := "EsportsCalendar"
 	description := name
 
-	cal.NAME = name
-	cal.X_WR_CALNAME = name
 	lbls := make([]string, 0)
 	for _, typ := range types {
 		if label, ok := calendar.Labels[typ]; ok {
 			lbls = append(lbls, label)
 		}
-		if col, ok := calendar.Colors[typ]; ok {
-			cal.COLOR = col
-		}
 	}
 	if len(lbls) > 0 {
 		description = fmt.Sprintf("EsportsCalendar, events for %s", strings.Join(lbls, ", "))
 	}
-	cal.DESCRIPTION = description
-	cal.X_WR_CALDESC = description
-
-	tz := date.Location().String()
-	cal.TIMEZONE_ID = tz
-	cal.X_WR_TIMEZONE = tz
-
-	cal.REFRESH_INTERVAL = "PT1H"
-	cal.X_PUBLISHED_TTL = "PT1H"
-
-	cal.CALSCALE = "GREGORIAN"
-	cal.METHOD = "PUBLISH"
-	for _, ev := range events {
-		summary := ev.Stage
-		if ev.Category != "" {
-			summary = fmt.Sprintf("[%s] %s: %s", ev.Type, ev.Category, summary)
+	cal.Text("NAME", name)
+	cal.Text("X-WR-CALNAME", name)
+	cal.Text("DESCRIPTION", description)
+	cal.Text("X-WR-CALDESC", description)
+	if len(types) == 1 {
+		if col, ok := calendar.Colors[types[0]]; ok {
+			cal.Text("COLOR", col)
 		}
+	}
+	cal.Text("X-WR-TIMEZONE", loc.String())
+	cal.AddWithParams("REFRESH-INTERVAL", TypeDuration, []Param{{Name: "VALUE", Value: TypeDuration}}, FormatDuration(cacheMaxAge))
+	cal.Text("X-PUBLISHED-TTL", FormatDuration(cacheMaxAge))
 
-		stamp := ev.StartTime
-		if !ev.LastModified.IsZero() {
-			stamp = ev.LastModified
-		}
-		e := &ical.VEvent{
-			UID:         fmt.Sprintf("%d", ev.CalID),
-			DTSTAMP:     stamp,
-			DTSTART:     ev.StartTime,
-			DTEND:       ev.StartTime.Add(ev.Duration),
-			SUMMARY:     summary,
-			DESCRIPTION: ev.Content,
-			TZID:        tz,
-			AllDay:      ev.Duration > 24*time.Hour,
+	if loc != time.UTC && len(events) > 0 {
+		from, to := events[0].StartTime, events[0].StartTime
+		for _, ev := range events {
+			if ev.StartTime.Before(from) {
+				from = ev.StartTime
+			}
+			if end := ev.StartTime.Add(ev.Duration); end.After(to) {
+				to = end
+			}
 		}
-		cal.VComponent = append(cal.VComponent, e)
+		cal.Components = append(cal.Components, VTimezone(loc, from, to))
 	}
-
-	b := &bytes.Buffer{}
-	err = cal.Encode(b)
-
-	w.Header().Set("Content-Type", getContentType(r.URL))
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("%s", err)))
+	for _, ev := range events {
+		cal.Components = append(cal.Components, VEvent(ev, loc, alarms...))
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(b.Bytes())
+	return cal
 }
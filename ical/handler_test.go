@@ -0,0 +1,256 @@
+package ical
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+func testEvents() calendar.Events {
+	return calendar.Events{
+		{CalID: 1, Type: "sc2", StartTime: time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC), Duration: time.Hour, Category: "Test Cup", Stage: "Group A"},
+		{CalID: 2, Type: "sc2", StartTime: time.Date(2024, time.March, 5, 18, 0, 0, 0, time.UTC), Duration: time.Hour, Category: "Test Cup", Stage: "Playoffs"},
+		{CalID: 3, Type: "sc2", StartTime: time.Date(2023, time.June, 1, 18, 0, 0, 0, time.UTC), Duration: time.Hour, Category: "Old Cup"},
+		{CalID: 4, Type: "dota", StartTime: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), Duration: 2 * calendar.Day, Category: "Other Cup"},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantUIDs    []string
+		notWantUIDs []string
+	}{
+		{
+			name:        "year and type",
+			url:         "/2024/sc2",
+			wantStatus:  http.StatusOK,
+			wantType:    ContentTypeICal,
+			wantUIDs:    []string{"sc2-1@othrys", "sc2-2@othrys"},
+			notWantUIDs: []string{"sc2-3@othrys", "dota-4@othrys"},
+		},
+		{
+			name:        "range of years",
+			url:         "/2023-2024/sc2",
+			wantStatus:  http.StatusOK,
+			wantType:    ContentTypeICal,
+			wantUIDs:    []string{"sc2-1@othrys", "sc2-2@othrys", "sc2-3@othrys"},
+			notWantUIDs: []string{"dota-4@othrys"},
+		},
+		{
+			name:        "multiple types",
+			url:         "/2024/sc2+dota",
+			wantStatus:  http.StatusOK,
+			wantType:    ContentTypeICal,
+			wantUIDs:    []string{"sc2-1@othrys", "sc2-2@othrys", "dota-4@othrys"},
+			notWantUIDs: []string{"sc2-3@othrys"},
+		},
+		{
+			name:        "text search",
+			url:         "/2024/sc2?q=playoffs",
+			wantStatus:  http.StatusOK,
+			wantType:    ContentTypeICal,
+			wantUIDs:    []string{"sc2-2@othrys"},
+			notWantUIDs: []string{"sc2-1@othrys"},
+		},
+		{
+			name:       "jcal",
+			url:        "/2024/sc2.json",
+			wantStatus: http.StatusOK,
+			wantType:   ContentTypeJCal,
+			wantUIDs:   []string{"sc2-1@othrys", "sc2-2@othrys"},
+		},
+		{
+			name:       "accept xcal",
+			url:        "/2024/sc2",
+			accept:     ContentTypeXCal,
+			wantStatus: http.StatusOK,
+			wantType:   ContentTypeXCal,
+			wantUIDs:   []string{"sc2-1@othrys", "sc2-2@othrys"},
+		},
+		{
+			name:       "invalid timezone",
+			url:        "/2024/sc2?tz=Nowhere/Land",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "out of bounds years",
+			url:        "/1-999999/sc2",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown calendar",
+			url:        "/2024/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid alarm",
+			url:        "/2024/sc2?alarm=soon",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	st := memory.New()
+	if err := st.SaveEvents(testEvents()); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	h := NewHandler(st)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, expected %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+				t.Errorf("content type %q, expected %q", ct, tt.wantType)
+			}
+			body := w.Body.String()
+			for _, uid := range tt.wantUIDs {
+				if !strings.Contains(body, uid) {
+					t.Errorf("missing event %s", uid)
+				}
+			}
+			for _, uid := range tt.notWantUIDs {
+				if strings.Contains(body, uid) {
+					t.Errorf("unexpected event %s", uid)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerNotModified(t *testing.T) {
+	st := memory.New()
+	if err := st.SaveEvents(testEvents()); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	h := NewHandler(st)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/2024/sc2", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("no ETag in the response")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/2024/sc2", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status %d for an unchanged calendar, expected %d", w.Code, http.StatusNotModified)
+	}
+
+	changed := testEvents()[1]
+	changed.Stage = "Grand Final"
+	if err := st.SaveEvent(changed); err != nil {
+		t.Fatalf("unable to save event: %s", err)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d for a changed calendar, expected %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestETagFollowsContent(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/2024/sc2", nil)
+	events := testEvents()[:2]
+	etag := eTag(r, ContentTypeICal, events)
+
+	resaved := append(calendar.Events{}, events...)
+	resaved[0].LastModified = time.Now()
+	if got := eTag(r, ContentTypeICal, resaved); got != etag {
+		t.Errorf("ETag changed to %s for the same content, expected %s", got, etag)
+	}
+
+	changed := append(calendar.Events{}, events...)
+	changed[0].Stage = "Group C"
+	if got := eTag(r, ContentTypeICal, changed); got == etag {
+		t.Errorf("ETag %s didn't change with the content", got)
+	}
+}
+
+func TestParseYears(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to int
+		ok       bool
+	}{
+		{in: "2024", from: 2024, to: 2024, ok: true},
+		{in: "2023-2025", from: 2023, to: 2025, ok: true},
+		{in: "1999-2001", from: 2000, to: 2001, ok: true},
+		{in: "2098-2100", from: 2098, to: 2099, ok: true},
+		{in: "2020-2024", from: 2020, to: 2024, ok: true},
+		{in: "2020-2025", ok: false},
+		{in: "2000-2099", ok: false},
+		{in: "1-999999", ok: false},
+		{in: "0", ok: false},
+		{in: "2100", ok: false},
+		{in: "2025-2023", ok: false},
+		{in: "sc2", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			from, to, ok := ParseYears(tt.in)
+			if ok != tt.ok {
+				t.Fatalf("valid %t, expected %t", ok, tt.ok)
+			}
+			if ok && (from != tt.from || to != tt.to) {
+				t.Errorf("parsed %d-%d, expected %d-%d", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	defaults := calendar.GetTypes(calendar.DefaultCalendars)
+	year := time.Now().Year()
+	tests := []struct {
+		path  string
+		types []string
+		in    Interval
+	}{
+		{path: "/", types: defaults, in: Interval{From: year, To: year}},
+		{path: "/2024", types: defaults, in: Interval{From: 2024, To: 2024}},
+		{path: "/upcoming", types: defaults, in: Interval{From: year, To: year, Upcoming: true}},
+		{path: "/2023-2024/sc2+dota.ics", types: []string{"sc2", "dota"}, in: Interval{From: 2023, To: 2024}},
+		{path: "/sc2", types: []string{"sc2"}, in: Interval{From: year, To: year}},
+		{path: "/0/sc2", types: []string{}, in: Interval{From: year, To: year}},
+		{path: "/2000-2099/sc2", types: []string{}, in: Interval{From: year, To: year}},
+		{path: "/unknown", types: []string{}, in: Interval{From: year, To: year}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			types, in := ParsePath(&url.URL{Path: tt.path})
+			if strings.Join(types, "+") != strings.Join(tt.types, "+") {
+				t.Errorf("types %v, expected %v", types, tt.types)
+			}
+			if in != tt.in {
+				t.Errorf("interval %+v, expected %+v", in, tt.in)
+			}
+		})
+	}
+	if types, _ := ParsePath(nil); strings.Join(types, "+") != strings.Join(defaults, "+") {
+		t.Errorf("types %v for a nil URL, expected %v", types, defaults)
+	}
+}
@@ -0,0 +1,86 @@
+package ical
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jCalValue converts a value from its iCalendar format to the one used by both jCal and xCal,
+// where dates and times use the extended ISO 8601 format with dashes and colons.
+func jCalValue(typ, v string) string {
+	switch typ {
+	case TypeDate:
+		if t, err := time.Parse(formatDate, v); err == nil {
+			return t.Format(time.DateOnly)
+		}
+	case TypeDateTime:
+		if t, err := time.Parse(formatDateTimeUTC, v); err == nil {
+			return t.Format("2006-01-02T15:04:05Z")
+		}
+		if t, err := time.Parse(formatDateTime, v); err == nil {
+			return t.Format("2006-01-02T15:04:05")
+		}
+	case TypeUTCOffset:
+		if len(v) >= 5 {
+			o := v[:3] + ":" + v[3:5]
+			if len(v) == 7 {
+				o += ":" + v[5:]
+			}
+			return o
+		}
+	}
+	return v
+}
+
+// params returns the parameters of the property without VALUE, which is represented by the type in jCal and xCal
+func (p Property) params() []Param {
+	params := make([]Param, 0, len(p.Params))
+	for _, par := range p.Params {
+		if !strings.EqualFold(par.Name, "VALUE") {
+			params = append(params, par)
+		}
+	}
+	return params
+}
+
+func (p Property) jCal() []any {
+	params := make(map[string]string)
+	for _, par := range p.params() {
+		params[strings.ToLower(par.Name)] = par.Value
+	}
+	typ := strings.ToLower(p.Type)
+	if typ == "" {
+		typ = "unknown"
+	}
+	prop := []any{strings.ToLower(p.Name), params, typ}
+	for _, v := range p.Values {
+		if p.Type == TypeInteger {
+			if i, err := strconv.Atoi(v); err == nil {
+				prop = append(prop, i)
+				continue
+			}
+		}
+		prop = append(prop, jCalValue(p.Type, v))
+	}
+	return prop
+}
+
+func (c *Component) jCal() []any {
+	props := make([]any, 0, len(c.Properties))
+	for _, p := range c.Properties {
+		props = append(props, p.jCal())
+	}
+	subs := make([]any, 0, len(c.Components))
+	for _, sub := range c.Components {
+		subs = append(subs, sub.jCal())
+	}
+	return []any{strings.ToLower(c.Name), props, subs}
+}
+
+// EncodeJSON writes the component in the jCal format (RFC 7265)
+func (c *Component) EncodeJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(c.jCal())
+}
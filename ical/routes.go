@@ -2,10 +2,12 @@ package ical
 
 import (
 	"net/http"
+
+	"git.sr.ht/~mariusor/othrys/storage"
 )
 
-func Routes(path string) http.Handler {
+func Routes(st storage.Loader, opts ...OptionFn) http.Handler {
 	r := http.NewServeMux()
-	r.Handle("/", NewHandler(path))
+	r.Handle("/", NewHandler(st, opts...))
 	return r
 }
@@ -0,0 +1,86 @@
+package ical
+
+import (
+	"time"
+)
+
+// transition is a change of the UTC offset for a location
+type transition struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+	name       string
+	dst        bool
+}
+
+// findTransition returns the first second in (start, end] at which the offset of loc differs from the one at start
+func findTransition(loc *time.Location, start, end time.Time) time.Time {
+	_, offset := start.In(loc).Zone()
+	for end.Sub(start) > time.Second {
+		mid := start.Add(end.Sub(start) / 2).Truncate(time.Second)
+		if _, o := mid.In(loc).Zone(); o == offset {
+			start = mid
+		} else {
+			end = mid
+		}
+	}
+	return end
+}
+
+// transitions returns the offset changes of loc between from and to, checked with daily granularity
+func transitions(loc *time.Location, from, to time.Time) []transition {
+	result := make([]transition, 0)
+	prev := from
+	_, prevOffset := prev.In(loc).Zone()
+	for t := from.Add(24 * time.Hour); !t.After(to.Add(24 * time.Hour)); t = t.Add(24 * time.Hour) {
+		_, offset := t.In(loc).Zone()
+		if offset == prevOffset {
+			prev = t
+			continue
+		}
+		at := findTransition(loc, prev, t).In(loc)
+		name, _ := at.Zone()
+		result = append(result, transition{at: at, offsetFrom: prevOffset, offsetTo: offset, name: name, dst: at.IsDST()})
+		prev, prevOffset = t, offset
+	}
+	return result
+}
+
+func observance(t transition) *Component {
+	name := "STANDARD"
+	if t.dst {
+		name = "DAYLIGHT"
+	}
+	o := NewComponent(name)
+	// the start of the observance is expressed in local time as it was before the transition
+	local := t.at.UTC().Add(time.Duration(t.offsetFrom) * time.Second)
+	o.Add("DTSTART", TypeDateTime, local.Format(formatDateTime))
+	o.Add("TZOFFSETFROM", TypeUTCOffset, FormatUTCOffset(t.offsetFrom))
+	o.Add("TZOFFSETTO", TypeUTCOffset, FormatUTCOffset(t.offsetTo))
+	if t.name != "" {
+		o.Text("TZNAME", t.name)
+	}
+	return o
+}
+
+// VTimezone builds the VTIMEZONE component for loc, with the observances in effect between from and to
+func VTimezone(loc *time.Location, from, to time.Time) *Component {
+	tz := NewComponent("VTIMEZONE")
+	tz.Text("TZID", loc.String())
+
+	from = from.AddDate(0, 0, -1)
+	at := from.In(loc)
+	name, offset := at.Zone()
+	// the observance in effect at the start of the interval, we consider it started at the Unix epoch
+	tz.Components = append(tz.Components, observance(transition{
+		at:         time.Unix(0, 0).Add(-time.Duration(offset) * time.Second),
+		offsetFrom: offset,
+		offsetTo:   offset,
+		name:       name,
+		dst:        at.IsDST(),
+	}))
+	for _, t := range transitions(loc, from, to) {
+		tz.Components = append(tz.Components, observance(t))
+	}
+	return tz
+}
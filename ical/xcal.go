@@ -0,0 +1,93 @@
+package ical
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+const xCalNS = "urn:ietf:params:xml:ns:icalendar-2.0"
+
+type xmlWriter struct {
+	enc *xml.Encoder
+	err error
+}
+
+func (x *xmlWriter) start(name string, attr ...xml.Attr) {
+	if x.err == nil {
+		x.err = x.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}, Attr: attr})
+	}
+}
+
+func (x *xmlWriter) end(name string) {
+	if x.err == nil {
+		x.err = x.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+func (x *xmlWriter) element(name, value string) {
+	x.start(name)
+	if x.err == nil {
+		x.err = x.enc.EncodeToken(xml.CharData(value))
+	}
+	x.end(name)
+}
+
+func (x *xmlWriter) property(p Property) {
+	name := strings.ToLower(p.Name)
+	x.start(name)
+	if params := p.params(); len(params) > 0 {
+		x.start("parameters")
+		for _, par := range params {
+			pn := strings.ToLower(par.Name)
+			x.start(pn)
+			x.element("text", par.Value)
+			x.end(pn)
+		}
+		x.end("parameters")
+	}
+	typ := strings.ToLower(p.Type)
+	if typ == "" {
+		typ = "unknown"
+	}
+	for _, v := range p.Values {
+		x.element(typ, jCalValue(p.Type, v))
+	}
+	x.end(name)
+}
+
+func (x *xmlWriter) component(c *Component) {
+	name := strings.ToLower(c.Name)
+	x.start(name)
+	if len(c.Properties) > 0 {
+		x.start("properties")
+		for _, p := range c.Properties {
+			x.property(p)
+		}
+		x.end("properties")
+	}
+	if len(c.Components) > 0 {
+		x.start("components")
+		for _, sub := range c.Components {
+			x.component(sub)
+		}
+		x.end("components")
+	}
+	x.end(name)
+}
+
+// EncodeXML writes the component in the xCal format (RFC 6321)
+func (c *Component) EncodeXML(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	x := xmlWriter{enc: xml.NewEncoder(w)}
+	x.enc.Indent("", "  ")
+	x.start("icalendar", xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: xCalNS})
+	x.component(c)
+	x.end("icalendar")
+	if x.err != nil {
+		return x.err
+	}
+	return x.enc.Flush()
+}
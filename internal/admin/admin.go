@@ -0,0 +1,81 @@
+// Package admin serves the endpoints for operating the server, which require the admin token.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"git.sr.ht/~mariusor/othrys/internal/post"
+	"git.sr.ht/~mariusor/othrys/internal/schedule"
+)
+
+// Prefix is the path under which the admin endpoints are served
+const Prefix = "/admin"
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
+// Auth only lets through to next the requests with the token in their "Authorization: Bearer" header
+func Auth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(received)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="othrys"`)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Routes serves the admin endpoints, to the requests authenticated with token:
+//
+//	GET /admin/jobs: the state of the scheduled jobs
+//	POST /admin/jobs/{name}/run: runs the job right away
+//	GET /admin/posts: the results of the last post to each account
+func Routes(token string, sched *schedule.Scheduler, posts *post.Status) http.Handler {
+	r := http.NewServeMux()
+	r.HandleFunc("GET "+Prefix+"/posts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, posts.Results())
+	})
+	r.HandleFunc("GET "+Prefix+"/jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, sched.Status())
+	})
+	r.HandleFunc("POST "+Prefix+"/jobs/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		err := sched.Trigger(name)
+		switch {
+		case errors.Is(err, schedule.ErrUnknownJob):
+			writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", name))
+		case errors.Is(err, schedule.ErrRunning):
+			writeError(w, http.StatusConflict, fmt.Errorf("job %s is already running", name))
+		case err != nil:
+			writeError(w, http.StatusServiceUnavailable, err)
+		default:
+			writeJSON(w, http.StatusAccepted, struct {
+				Job    string `json:"job"`
+				Status string `json:"status"`
+			}{Job: name, Status: "started"})
+		}
+	})
+	r.HandleFunc(Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+	})
+	return Auth(token, r)
+}
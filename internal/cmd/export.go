@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	FormatJSONLines = "jsonl"
+	FormatICal      = "ics"
+)
+
+// exportEpoch is the earliest date we consider when no start date is passed to export
+var exportEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var ExportCmd = cli.Command{
+	Name:  "export",
+	Usage: "Exports saved calendar events as JSON Lines or iCalendar",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "calendar",
+			Usage: "Which calendars to export",
+			Value: (*cli.StringSlice)(&calendar.DefaultCalendars),
+		},
+		&cli.StringFlag{
+			Name:  "start",
+			Usage: "Date at which to start, by default all events are exported",
+		},
+		&cli.DurationFlag{
+			Name:  "end",
+			Usage: "Date interval to export, by default until one year from now",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "The format of the export: jsonl, ics",
+			Value: FormatJSONLines,
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "The file to write to, by default standard output",
+			Value: "-",
+		},
+	},
+	Action: exportEvents,
+}
+
+func exportInterval(c *cli.Context) storage.DateCursor {
+	start := exportEpoch
+	if sf := c.String("start"); len(sf) > 0 {
+		if sfp, err := time.Parse("2006-01-02", sf); err == nil {
+			start = sfp
+		}
+	}
+	duration := c.Duration("end")
+	if duration == 0 {
+		duration = time.Now().Add(ResolutionYearish).Sub(start)
+	}
+	return storage.Cursor(start, duration)
+}
+
+func exportEvents(c *cli.Context) error {
+	types := calendar.GetTypes(stringSliceValues(c, "calendar"))
+	if len(types) == 0 {
+		return fmt.Errorf("no valid calendars have been passed")
+	}
+	format := c.String("format")
+	if format != FormatJSONLines && format != FormatICal {
+		return fmt.Errorf("invalid export format %q", format)
+	}
+
+	cursor := exportInterval(c)
+	st := Storage(c)
+
+	var out io.Writer = os.Stdout
+	if o := c.String("output"); o != "" && o != "-" {
+		f, err := os.OpenFile(o, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to open output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if format == FormatICal {
+		// the calendars show the events the way they are served, with their overrides
+		events, err := st.LoadEvents(cursor, types...)
+		if err != nil {
+			return fmt.Errorf("unable to load events: %w", err)
+		}
+		toExport := make(calendar.Events, 0, len(events))
+		for _, e := range events {
+			if cursor.Contains(e.StartTime) {
+				toExport = append(toExport, e)
+			}
+		}
+		return ical.Write(out, toExport, types...)
+	}
+
+	events, err := savedEvents(st, cursor, types...)
+	if err != nil {
+		return fmt.Errorf("unable to load events: %w", err)
+	}
+	overrides, err := eventOverrides(st, events)
+	if err != nil {
+		return fmt.Errorf("unable to load overrides: %w", err)
+	}
+	return writeJSONLines(out, events, overrides)
+}
+
+// savedEvents returns the events in the cursor interval as they have been saved, including the hidden ones,
+// so the export can be imported again without the overrides getting mixed in the events.
+// For the storage backends that can't walk their saved events, it falls back to loading them with their overrides.
+func savedEvents(st storage.Loader, cursor storage.DateCursor, types ...string) (calendar.Events, error) {
+	p, ok := st.(storage.Pruner)
+	if !ok {
+		events, err := st.LoadEvents(cursor, types...)
+		if err != nil {
+			return nil, err
+		}
+		saved := make(calendar.Events, 0, len(events))
+		for _, e := range events {
+			if cursor.Contains(e.StartTime) {
+				saved = append(saved, e)
+			}
+		}
+		return saved, nil
+	}
+	saved := make(calendar.Events, 0)
+	_, err := p.CountEvents(func(e calendar.Event) bool {
+		if cursor.Contains(e.StartTime) && inStringList(e.Type, types) {
+			saved = append(saved, e)
+		}
+		return false
+	})
+	storage.SortEvents(saved, types)
+	return saved, err
+}
+
+// eventOverrides returns the overrides of the events, when st persists them
+func eventOverrides(st storage.Loader, events calendar.Events) ([]storage.Override, error) {
+	ost, ok := st.(storage.OverrideStore)
+	if !ok {
+		return nil, nil
+	}
+	all, err := ost.LoadOverrides()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]struct{}, len(events))
+	for _, e := range events {
+		keys[storage.OverrideKey(e.Type, e.CalID)] = struct{}{}
+	}
+	overrides := make([]storage.Override, 0)
+	for _, o := range all {
+		if _, ok := keys[o.Key()]; ok {
+			overrides = append(overrides, o)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Key() < overrides[j].Key() })
+	return overrides, nil
+}
+
+// overrideLine is how the overrides are written in the JSON Lines exports, next to the events they change
+type overrideLine struct {
+	Override *storage.Override `json:"override,omitempty"`
+}
+
+func writeJSONLines(w io.Writer, events calendar.Events, overrides []storage.Override) error {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("unable to encode event %d: %w", e.CalID, err)
+		}
+	}
+	for i := range overrides {
+		if err := enc.Encode(overrideLine{Override: &overrides[i]}); err != nil {
+			return fmt.Errorf("unable to encode override %s: %w", overrides[i].Key(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+func TestExportImport(t *testing.T) {
+	visible := testEvent("sc2", 1, testStart.Add(10*time.Hour), "Group A")
+	fixed := testEvent("sc2", 2, testStart.Add(20*time.Hour), "Group B")
+	hidden := testEvent("sc2", 3, testStart.Add(30*time.Hour), "Group C")
+	other := testEvent("dota", 4, testStart.Add(12*time.Hour), "Group D")
+	playoffs := "Playoffs"
+	overrides := []storage.Override{
+		{Type: "sc2", CalID: 2, Stage: &playoffs},
+		{Type: "sc2", CalID: 3, Hidden: true},
+		{Type: "dota", CalID: 4, Hidden: true},
+	}
+
+	src := memory.New()
+	if err := src.SaveEvents(calendar.Events{visible, fixed, hidden, other}); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	for _, o := range overrides {
+		if err := src.SaveOverride(o); err != nil {
+			t.Fatalf("unable to save override: %s", err)
+		}
+	}
+
+	cursor := storage.Cursor(testStart, ResolutionWeek)
+	events, err := savedEvents(src, cursor, "sc2")
+	if err != nil {
+		t.Fatalf("savedEvents returned error: %s", err)
+	}
+	exported, err := eventOverrides(src, events)
+	if err != nil {
+		t.Fatalf("eventOverrides returned error: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if err = writeJSONLines(&buf, events, exported); err != nil {
+		t.Fatalf("writeJSONLines returned error: %s", err)
+	}
+
+	dst := memory.New()
+	saved, skipped, err := importJSONLines(&buf, dst, MergeSkip, cursor, "sc2")
+	if err != nil {
+		t.Fatalf("importJSONLines returned error: %s", err)
+	}
+	if saved != 5 || skipped != 0 {
+		t.Errorf("imported %d, skipped %d, expected 3 events and 2 overrides", saved, skipped)
+	}
+
+	for _, want := range (calendar.Events{visible, fixed, hidden}) {
+		got, err := storage.FindSavedEvent(dst, want)
+		if err != nil {
+			t.Fatalf("event %d not imported: %s", want.CalID, err)
+		}
+		if !got.Equals(want) {
+			t.Errorf("imported %v, expected the saved event %v", got, want)
+		}
+	}
+	if _, err = storage.FindSavedEvent(dst, other); err == nil {
+		t.Errorf("imported the event of a calendar that wasn't exported")
+	}
+	restored, err := dst.LoadOverrides()
+	if err != nil {
+		t.Fatalf("unable to load overrides: %s", err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("restored %d overrides, expected 2", len(restored))
+	}
+
+	want, _ := src.LoadEvents(cursor, "sc2")
+	got, _ := dst.LoadEvents(cursor, "sc2")
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d events after the import, expected %d", len(got), len(want))
+	}
+	for i := range got {
+		if !got[i].Equals(want[i]) {
+			t.Errorf("loaded %v after the import, expected %v", got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/savedfeed"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+var FeedCmd = cli.Command{
+	Name:  "feed",
+	Usage: "Manages the saved feeds, which are served under secret URLs",
+	Subcommands: []cli.Command{
+		{
+			Name:  "create",
+			Usage: "Saves a new feed and outputs its URLs",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "name",
+					Usage: "The name of the feed",
+				},
+				&cli.StringSliceFlag{
+					Name:  "calendar",
+					Usage: "The calendar types to include in the feed",
+				},
+				&cli.StringSliceFlag{
+					Name:  "category",
+					Usage: "Only include the events of these categories",
+				},
+				&cli.StringSliceFlag{
+					Name:  "stage",
+					Usage: "Only include the events of these stages",
+				},
+				&cli.StringSliceFlag{
+					Name:  "participant",
+					Usage: "Only include the events of these participants",
+				},
+				&cli.StringFlag{
+					Name:  "q",
+					Usage: "Only include the events that contain the text",
+				},
+				&cli.StringFlag{
+					Name:  "kind",
+					Usage: "Only include the events of this kind: matches or tournaments",
+				},
+				&cli.StringFlag{
+					Name:  "canceled",
+					Usage: "Include canceled events or not: true or false",
+				},
+				&cli.StringFlag{
+					Name:  "min-duration",
+					Usage: "Only include the events that last at least this long",
+				},
+				&cli.StringFlag{
+					Name:  "tz",
+					Usage: "The timezone of the feed",
+				},
+				&cli.StringSliceFlag{
+					Name:  "alarm",
+					Usage: "Reminders before the events in the iCalendar feed, eg: 15m, or \"none\"",
+				},
+				&cli.StringFlag{
+					Name:  "base-url",
+					Usage: "The public URL of the server, used to output the URLs of the feed",
+					Value: "http://localhost:3000",
+				},
+			},
+			Action: feedCreate,
+		},
+		{
+			Name:   "list",
+			Usage:  "Lists the saved feeds",
+			Action: feedList,
+		},
+		{
+			Name:      "revoke",
+			Usage:     "Deletes saved feeds, their URLs stop working",
+			ArgsUsage: "TOKEN...",
+			Action:    feedRevoke,
+		},
+	},
+}
+
+func feedStorage(c *cli.Context) (storage.SavedFeedStore, error) {
+	st, ok := Storage(c).(storage.SavedFeedStore)
+	if !ok {
+		return nil, fmt.Errorf("storage does not support saved feeds")
+	}
+	return st, nil
+}
+
+func feedCreate(c *cli.Context) error {
+	values := make(url.Values)
+	for _, p := range savedfeed.Params {
+		if !c.IsSet(p) {
+			continue
+		}
+		if v := c.StringSlice(p); len(v) > 0 {
+			values[p] = v
+			continue
+		}
+		values.Set(p, c.String(p))
+	}
+	f, err := savedfeed.New(c.String("name"), c.StringSlice("calendar"), values)
+	if err != nil {
+		return err
+	}
+	st, err := feedStorage(c)
+	if err != nil {
+		return err
+	}
+	if err = st.SaveFeed(f); err != nil {
+		return fmt.Errorf("unable to save feed: %w", err)
+	}
+	base, err := url.Parse(c.String("base-url"))
+	if err != nil {
+		return fmt.Errorf("invalid base URL %q: %w", c.String("base-url"), err)
+	}
+	info("Saved feed %s", formatFeed(f))
+	exts := make([]string, 0, len(savedfeed.Formats))
+	for ext := range savedfeed.Formats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		info("  %s: %s", savedfeed.Formats[ext], base.JoinPath(savedfeed.Path(f, ext)))
+	}
+	return nil
+}
+
+func feedList(c *cli.Context) error {
+	st, err := feedStorage(c)
+	if err != nil {
+		return err
+	}
+	feeds, err := st.LoadFeeds()
+	if err != nil {
+		return fmt.Errorf("unable to load feeds: %w", err)
+	}
+	if len(feeds) == 0 {
+		fmt.Printf("nothing found\n")
+		return nil
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].Created.Before(feeds[j].Created)
+	})
+	for _, f := range feeds {
+		info("%s", formatFeed(f))
+	}
+	return nil
+}
+
+func feedRevoke(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return errors.New("missing the tokens of the feeds to revoke")
+	}
+	st, err := feedStorage(c)
+	if err != nil {
+		return err
+	}
+	for _, token := range c.Args() {
+		if err = st.DeleteFeed(token); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("feed %s not found", token)
+			}
+			return fmt.Errorf("unable to revoke feed %s: %w", token, err)
+		}
+		info("Revoked feed %s", token)
+	}
+	return nil
+}
+
+func formatFeed(f storage.SavedFeed) string {
+	s := fmt.Sprintf("[%s] %q %s created=%s", f.Token, f.Name, strings.Join(f.Types, "+"), f.Created.Format("2006-01-02 15:04"))
+	if q := f.Values.Encode(); q != "" {
+		s += " " + q
+	}
+	return s
+}
@@ -5,14 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
 	"time"
 
 	"github.com/urfave/cli"
 
 	"git.sr.ht/~mariusor/othrys/calendar"
-	"git.sr.ht/~mariusor/othrys/storage/boltdb"
+	"git.sr.ht/~mariusor/othrys/internal/post"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
 )
 
 var now = time.Now()
@@ -105,6 +106,13 @@ type cal struct {
 	weekly bool
 	err    logFn
 	log    logFn
+	// load fetches the events of a calendar type for the week of the received date
+	load func(string, time.Time) (calendar.Events, error)
+	// fetched and failed keep track of the providers that loaded the events successfully or not
+	fetched map[string]time.Time
+	failed  map[string]bool
+	// changed are the events that have been saved because they're new, or they differ from the stored ones
+	changed calendar.Events
 }
 
 func New(debug bool, types ...string) (*cal, error) {
@@ -117,11 +125,14 @@ func New(debug bool, types ...string) (*cal, error) {
 		fmt.Fprintln(os.Stderr)
 	}
 	return &cal{
-		debug:  debug,
-		Types:  calendar.GetTypes(types),
-		weekly: true,
-		log:    logFn,
-		err:    errFn,
+		debug:   debug,
+		Types:   calendar.GetTypes(types),
+		weekly:  true,
+		log:     logFn,
+		err:     errFn,
+		load:    calendar.LoadEvents,
+		fetched: make(map[string]time.Time),
+		failed:  make(map[string]bool),
 	}, nil
 }
 
@@ -145,11 +156,13 @@ func (c cal) Load(startDate time.Time) (calendar.Events, error) {
 			u, _ := calendar.GetCalendarURL(l.t, l.d, c.weekly)
 			c.log("Loading [%s]: %s", l.t, u)
 		}
-		ev, err := calendar.LoadEvents(l.t, l.d)
+		ev, err := c.load(l.t, l.d)
 		if err != nil {
 			c.err("Unable to parse page URI for type %s: %s", l.t, err)
+			c.failed[calendar.Provider(l.t)] = true
 			continue
 		}
+		c.fetched[calendar.Provider(l.t)] = time.Now().UTC()
 		events = append(events, ev...)
 		if c.debug {
 			c.log("%d events", len(ev))
@@ -181,15 +194,33 @@ func fetchCalendars(c *cli.Context) error {
 	if len(f.Types) == 0 {
 		return fmt.Errorf("no valid calendars have been passed: %s", types)
 	}
+	st := Storage(c)
+	if c.Bool("dry-run") {
+		st = memory.New()
+	}
+	if err = fetchEvents(f, st, start, duration); err != nil {
+		return err
+	}
+	ledger, ok := st.(storage.PostLedger)
+	if !ok || c.Bool("dry-run") || len(f.changed) == 0 {
+		return nil
+	}
+	creds, err := post.LoadCredentials(c.GlobalString("path"))
+	if err != nil {
+		return fmt.Errorf("unable to load credentials for updating the posts: %w", err)
+	}
+	return updatePosts(st, ledger, creds, f.changed)
+}
+
+// fetchEvents loads the events of the f calendars for the duration interval from start,
+// saves the ones that changed to st and records the providers that have been fetched successfully.
+func fetchEvents(f *cal, st storage.Store, start time.Time, duration time.Duration) error {
+	debug := f.debug
 	date := start
 	endDate := start.Add(duration - time.Second)
-	st := boltdb.New(boltdb.Config{
-		Path:  path.Join(c.GlobalString("path"), boltdb.DefaultFile),
-		LogFn: nil,
-		ErrFn: nil,
-	})
 
 	var events calendar.Events
+	var err error
 	for {
 		duration := durationStep - time.Second
 		if debug {
@@ -216,7 +247,11 @@ func fetchCalendars(c *cli.Context) error {
 					f.log("%v", e.Content)
 				}
 			}
-			old := st.LoadEvent(e.Type, e.StartTime, e.CalID)
+			// the event is looked up by its ID, as its start time might have changed since it was saved
+			old, err := storage.FindSavedEvent(st, e)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				f.err("Error loading %d: %s", e.CalID, err)
+			}
 			if old.IsValid() {
 				fmt.Printf("%v", old)
 			}
@@ -224,6 +259,8 @@ func fetchCalendars(c *cli.Context) error {
 				err := st.SaveEvent(e)
 				if err != nil {
 					f.err("Error saving %d: %s", e.CalID, err)
+				} else {
+					f.changed = append(f.changed, e)
 				}
 			}
 		}
@@ -232,5 +269,15 @@ func fetchCalendars(c *cli.Context) error {
 		}
 		date = date.Add(duration)
 	}
+	if fs, ok := st.(storage.FetchStore); ok {
+		for provider, t := range f.fetched {
+			if f.failed[provider] {
+				continue
+			}
+			if err := fs.SaveFetch(provider, t); err != nil {
+				f.err("Error saving the fetch time for %s: %s", provider, err)
+			}
+		}
+	}
 	return err
 }
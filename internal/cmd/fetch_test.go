@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+var testStart = time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+func testEvent(typ string, id int64, start time.Time, stage string) calendar.Event {
+	return calendar.Event{
+		CalID:     id,
+		Type:      typ,
+		StartTime: start,
+		Duration:  time.Hour,
+		Category:  "Test Cup",
+		Stage:     stage,
+	}
+}
+
+// testCal returns a calendar for the types which loads the events from the source instead of the network
+func testCal(source map[string]calendar.Events, types ...string) *cal {
+	nop := func(string, ...interface{}) {}
+	return &cal{
+		Types: types,
+		log:   nop,
+		err:   nop,
+		load: func(typ string, _ time.Time) (calendar.Events, error) {
+			events, ok := source[typ]
+			if !ok {
+				return nil, errors.New("unavailable")
+			}
+			return events, nil
+		},
+		fetched: make(map[string]time.Time),
+		failed:  make(map[string]bool),
+	}
+}
+
+func TestFetchEvents(t *testing.T) {
+	first := testEvent("sc2", 1, testStart.Add(10*time.Hour), "Group A")
+	second := testEvent("sc2", 2, testStart.Add(26*time.Hour), "Group B")
+	changed := first
+	changed.Stage = "Playoffs"
+	rescheduled := first
+	rescheduled.StartTime = testStart.Add(30 * time.Hour)
+
+	tests := []struct {
+		name        string
+		saved       calendar.Events
+		source      map[string]calendar.Events
+		types       []string
+		wantChanged int
+		wantStages  []string
+		wantFetched []string
+	}{
+		{
+			name:        "new events",
+			source:      map[string]calendar.Events{"sc2": {first, second}},
+			types:       []string{"sc2"},
+			wantChanged: 2,
+			wantStages:  []string{"Group A", "Group B"},
+			wantFetched: []string{calendar.Provider("sc2")},
+		},
+		{
+			name:        "unchanged events",
+			saved:       calendar.Events{first, second},
+			source:      map[string]calendar.Events{"sc2": {first, second}},
+			types:       []string{"sc2"},
+			wantChanged: 0,
+			wantStages:  []string{"Group A", "Group B"},
+			wantFetched: []string{calendar.Provider("sc2")},
+		},
+		{
+			name:        "changed event",
+			saved:       calendar.Events{first, second},
+			source:      map[string]calendar.Events{"sc2": {changed, second}},
+			types:       []string{"sc2"},
+			wantChanged: 1,
+			wantStages:  []string{"Playoffs", "Group B"},
+			wantFetched: []string{calendar.Provider("sc2")},
+		},
+		{
+			name:        "rescheduled event",
+			saved:       calendar.Events{first, second},
+			source:      map[string]calendar.Events{"sc2": {rescheduled, second}},
+			types:       []string{"sc2"},
+			wantChanged: 1,
+			wantStages:  []string{"Group B", "Group A"},
+			wantFetched: []string{calendar.Provider("sc2")},
+		},
+		{
+			name:        "failed provider",
+			saved:       calendar.Events{first},
+			source:      map[string]calendar.Events{},
+			types:       []string{"sc2"},
+			wantChanged: 0,
+			wantStages:  []string{"Group A"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.New()
+			if err := st.SaveEvents(tt.saved); err != nil {
+				t.Fatalf("unable to save events: %s", err)
+			}
+			f := testCal(tt.source, tt.types...)
+			if err := fetchEvents(f, st, testStart, durationStep); err != nil {
+				t.Fatalf("fetchEvents returned error: %s", err)
+			}
+			if len(f.changed) != tt.wantChanged {
+				t.Errorf("changed %d events, expected %d", len(f.changed), tt.wantChanged)
+			}
+			events, err := st.LoadEvents(storage.Cursor(testStart, durationStep), tt.types...)
+			if err != nil {
+				t.Fatalf("unable to load events: %s", err)
+			}
+			if len(events) != len(tt.wantStages) {
+				t.Fatalf("stored %d events, expected %d", len(events), len(tt.wantStages))
+			}
+			for i, ev := range events {
+				if ev.Stage != tt.wantStages[i] {
+					t.Errorf("event %d has stage %q, expected %q", i, ev.Stage, tt.wantStages[i])
+				}
+			}
+			fetches, err := st.LoadFetches()
+			if err != nil {
+				t.Fatalf("unable to load fetches: %s", err)
+			}
+			if len(fetches) != len(tt.wantFetched) {
+				t.Errorf("recorded %d fetches, expected %d", len(fetches), len(tt.wantFetched))
+			}
+			for _, provider := range tt.wantFetched {
+				if _, ok := fetches[provider]; !ok {
+					t.Errorf("no fetch recorded for %s", provider)
+				}
+			}
+		})
+	}
+}
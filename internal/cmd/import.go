@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	MergeSkip      = "skip"
+	MergeOverwrite = "overwrite"
+	MergeNewest    = "newest"
+)
+
+var ImportCmd = cli.Command{
+	Name:  "import",
+	Usage: "Imports calendar events and their overrides from a JSON Lines export",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "calendar",
+			Usage: "Which calendars to import, by default all of them",
+		},
+		&cli.StringFlag{
+			Name:  "start",
+			Usage: "Date at which to start, by default all events are imported",
+		},
+		&cli.DurationFlag{
+			Name:  "end",
+			Usage: "Date interval to import, by default until one year from now",
+		},
+		&cli.StringFlag{
+			Name:  "input",
+			Usage: "The file to read from, by default standard input",
+			Value: "-",
+		},
+		&cli.StringFlag{
+			Name:  "mode",
+			Usage: "How to merge with existing events: skip, overwrite, newest",
+			Value: MergeSkip,
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Don't persist events",
+		},
+	},
+	Action: importEvents,
+}
+
+// shouldReplace decides based on the merge mode if the incoming event replaces the existing one
+func shouldReplace(mode string, old, inc calendar.Event) bool {
+	if !old.IsValid() {
+		return true
+	}
+	switch mode {
+	case MergeOverwrite:
+		return !old.Equals(inc) || !old.LastModified.Equal(inc.LastModified)
+	case MergeNewest:
+		return inc.LastModified.After(old.LastModified)
+	}
+	return false
+}
+
+func importEvents(c *cli.Context) error {
+	mode := c.String("mode")
+	if mode != MergeSkip && mode != MergeOverwrite && mode != MergeNewest {
+		return fmt.Errorf("invalid merge mode %q", mode)
+	}
+	types := calendar.GetTypes(stringSliceValues(c, "calendar"))
+
+	var in io.Reader = os.Stdin
+	if i := c.String("input"); i != "" && i != "-" {
+		f, err := os.Open(i)
+		if err != nil {
+			return fmt.Errorf("unable to open input file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	st := Storage(c)
+	if c.Bool("dry-run") {
+		st = nil
+	}
+	saved, skipped, err := importJSONLines(in, st, mode, exportInterval(c), types...)
+	info("Imported %d events and overrides, skipped %d", saved, skipped)
+	return err
+}
+
+// importJSONLines reads events and overrides from r and merges them in st, a nil store only counts them.
+// The overrides are restored for the calendar types being imported, with the same merge mode as the events.
+func importJSONLines(r io.Reader, st storage.Store, mode string, cursor storage.DateCursor, types ...string) (int, int, error) {
+	saved, skipped := 0, 0
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for s.Scan() {
+		line++
+		raw := s.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		ol := overrideLine{}
+		if err := json.Unmarshal(raw, &ol); err != nil {
+			return saved, skipped, fmt.Errorf("invalid line %d: %w", line, err)
+		}
+		if ol.Override != nil {
+			if importOverride(st, mode, *ol.Override, types) {
+				saved++
+			} else {
+				skipped++
+			}
+			continue
+		}
+		e := calendar.Event{}
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return saved, skipped, fmt.Errorf("invalid event on line %d: %w", line, err)
+		}
+		if !e.IsValid() || !cursor.Contains(e.StartTime) || !inStringList(e.Type, types) {
+			skipped++
+			continue
+		}
+		if st == nil {
+			saved++
+			continue
+		}
+		old, err := storage.FindSavedEvent(st, e)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return saved, skipped, fmt.Errorf("unable to load event %d: %w", e.CalID, err)
+		}
+		if !shouldReplace(mode, old, e) {
+			skipped++
+			continue
+		}
+		if err := st.SaveEvent(e); err != nil {
+			errFn("Error saving %d: %s", e.CalID, err)
+			skipped++
+			continue
+		}
+		saved++
+	}
+	return saved, skipped, s.Err()
+}
+
+// importOverride saves o in st, unless its type is not imported or the merge mode keeps an existing override.
+// With a nil store it only checks the type.
+func importOverride(st storage.Store, mode string, o storage.Override, types []string) bool {
+	if !inStringList(o.Type, types) {
+		return false
+	}
+	if st == nil {
+		return true
+	}
+	ost, ok := st.(storage.OverrideStore)
+	if !ok {
+		return false
+	}
+	if mode == MergeSkip {
+		existing, err := ost.LoadOverrides()
+		if err != nil {
+			errFn("Error loading the overrides: %s", err)
+			return false
+		}
+		for _, ex := range existing {
+			if ex.Key() == o.Key() {
+				return false
+			}
+		}
+	}
+	if err := ost.SaveOverride(o); err != nil {
+		errFn("Error saving the override of %s: %s", o.Key(), err)
+		return false
+	}
+	return true
+}
+
+func inStringList(s string, list []string) bool {
+	for _, lss := range list {
+		if lss == s {
+			return true
+		}
+	}
+	return false
+}
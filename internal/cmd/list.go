@@ -2,14 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"path"
 	"time"
 
 	"github.com/urfave/cli"
 
 	"git.sr.ht/~mariusor/othrys/calendar"
 	"git.sr.ht/~mariusor/othrys/storage"
-	"git.sr.ht/~mariusor/othrys/storage/boltdb"
 )
 
 var ListCmd = cli.Command{
@@ -57,11 +55,7 @@ func listCalendars(c *cli.Context) error {
 	}
 
 	date := start
-	st := boltdb.New(boltdb.Config{
-		Path:  path.Join(c.GlobalString("path"), boltdb.DefaultFile),
-		LogFn: nil,
-		ErrFn: nil,
-	})
+	st := Storage(c)
 
 	f.log("Loading events for period: %s - %s", date.Format("2006-01-02 Mon, 15:04"), date.Add(duration).Format("2006-01-02 Mon, 15:04"))
 	events, err := st.LoadEvents(storage.DateCursor{T: start, D: duration}, types...)
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const overrideTimeFormat = "2006-01-02 15:04"
+
+var overrideIdentityFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "calendar",
+		Usage: "The calendar type of the event",
+	},
+	&cli.Int64Flag{
+		Name:  "id",
+		Usage: "The ID of the event",
+	},
+}
+
+var OverrideCmd = cli.Command{
+	Name:  "override",
+	Usage: "Manages the manual overrides for events that survive fetching them again",
+	Subcommands: []cli.Command{
+		{
+			Name:  "set",
+			Usage: "Pins the values of an event's fields, or hides it",
+			Flags: append(overrideIdentityFlags[:len(overrideIdentityFlags):len(overrideIdentityFlags)],
+				&cli.StringFlag{
+					Name:  "start",
+					Usage: "Start time of the event in UTC, with the format: " + overrideTimeFormat,
+				},
+				&cli.DurationFlag{
+					Name:  "duration",
+					Usage: "Duration of the event",
+				},
+				&cli.StringFlag{
+					Name:  "category",
+					Usage: "Category of the event",
+				},
+				&cli.StringFlag{
+					Name:  "stage",
+					Usage: "Stage of the event",
+				},
+				&cli.StringFlag{
+					Name:  "content",
+					Usage: "Content of the event",
+				},
+				&cli.BoolFlag{
+					Name:  "canceled",
+					Usage: "Mark the event as canceled, use --canceled=false to mark it as not canceled",
+				},
+				&cli.StringSliceFlag{
+					Name:  "link",
+					Usage: "Links of the event",
+				},
+				&cli.BoolFlag{
+					Name:  "hide",
+					Usage: "Hide the event",
+				},
+			),
+			Action: overrideSet,
+		},
+		{
+			Name:  "unset",
+			Usage: "Removes the override for an event, or only some of its fields",
+			Flags: append(overrideIdentityFlags[:len(overrideIdentityFlags):len(overrideIdentityFlags)],
+				&cli.StringSliceFlag{
+					Name:  "field",
+					Usage: "The fields to unset: start, duration, category, stage, content, canceled, links, hidden",
+				},
+			),
+			Action: overrideUnset,
+		},
+		{
+			Name:   "list",
+			Usage:  "Lists the existing overrides",
+			Action: overrideList,
+		},
+	},
+}
+
+func overrideStorage(c *cli.Context) (storage.OverrideStore, error) {
+	st, ok := Storage(c).(storage.OverrideStore)
+	if !ok {
+		return nil, fmt.Errorf("storage does not support overrides")
+	}
+	return st, nil
+}
+
+func overrideIdentity(c *cli.Context) (string, int64, error) {
+	typ := c.String("calendar")
+	if types := calendar.GetTypes([]string{typ}); len(types) != 1 || types[0] != typ {
+		return "", 0, fmt.Errorf("invalid calendar type %q", typ)
+	}
+	id := c.Int64("id")
+	if id <= 0 {
+		return "", 0, fmt.Errorf("invalid event ID %d", id)
+	}
+	return typ, id, nil
+}
+
+func findOverride(st storage.OverrideStore, typ string, id int64) (storage.Override, error) {
+	overrides, err := st.LoadOverrides()
+	if err != nil {
+		return storage.Override{}, fmt.Errorf("unable to load overrides: %w", err)
+	}
+	for _, o := range overrides {
+		if o.Key() == storage.OverrideKey(typ, id) {
+			return o, nil
+		}
+	}
+	return storage.Override{Type: typ, CalID: id}, nil
+}
+
+func overrideSet(c *cli.Context) error {
+	typ, id, err := overrideIdentity(c)
+	if err != nil {
+		return err
+	}
+	st, err := overrideStorage(c)
+	if err != nil {
+		return err
+	}
+	o, err := findOverride(st, typ, id)
+	if err != nil {
+		return err
+	}
+
+	if c.IsSet("start") {
+		start, err := time.ParseInLocation(overrideTimeFormat, c.String("start"), time.UTC)
+		if err != nil {
+			return fmt.Errorf("invalid start time %q", c.String("start"))
+		}
+		o.StartTime = &start
+	}
+	if c.IsSet("duration") {
+		d := c.Duration("duration")
+		o.Duration = &d
+	}
+	if c.IsSet("category") {
+		v := c.String("category")
+		o.Category = &v
+	}
+	if c.IsSet("stage") {
+		v := c.String("stage")
+		o.Stage = &v
+	}
+	if c.IsSet("content") {
+		v := c.String("content")
+		o.Content = &v
+	}
+	if c.IsSet("canceled") {
+		v := c.Bool("canceled")
+		o.Canceled = &v
+	}
+	if c.IsSet("link") {
+		o.Links = c.StringSlice("link")
+	}
+	if c.IsSet("hide") {
+		o.Hidden = c.Bool("hide")
+	}
+	if err = st.SaveOverride(o); err != nil {
+		return fmt.Errorf("unable to save override: %w", err)
+	}
+	info("Saved override %s", formatOverride(o))
+	return nil
+}
+
+func overrideUnset(c *cli.Context) error {
+	typ, id, err := overrideIdentity(c)
+	if err != nil {
+		return err
+	}
+	st, err := overrideStorage(c)
+	if err != nil {
+		return err
+	}
+	fields := c.StringSlice("field")
+	if len(fields) == 0 {
+		return st.DeleteOverride(typ, id)
+	}
+
+	o, err := findOverride(st, typ, id)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		switch strings.ToLower(f) {
+		case "start":
+			o.StartTime = nil
+		case "duration":
+			o.Duration = nil
+		case "category":
+			o.Category = nil
+		case "stage":
+			o.Stage = nil
+		case "content":
+			o.Content = nil
+		case "canceled":
+			o.Canceled = nil
+		case "links":
+			o.Links = nil
+		case "hidden":
+			o.Hidden = false
+		default:
+			return fmt.Errorf("invalid override field %q", f)
+		}
+	}
+	if err = st.SaveOverride(o); err != nil {
+		return fmt.Errorf("unable to save override: %w", err)
+	}
+	info("Saved override %s", formatOverride(o))
+	return nil
+}
+
+func overrideList(c *cli.Context) error {
+	st, err := overrideStorage(c)
+	if err != nil {
+		return err
+	}
+	overrides, err := st.LoadOverrides()
+	if err != nil {
+		return fmt.Errorf("unable to load overrides: %w", err)
+	}
+	if len(overrides) == 0 {
+		fmt.Printf("nothing found\n")
+		return nil
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Key() < overrides[j].Key()
+	})
+	for _, o := range overrides {
+		info("%s", formatOverride(o))
+	}
+	return nil
+}
+
+func formatOverride(o storage.Override) string {
+	fields := make([]string, 0)
+	if o.Hidden {
+		fields = append(fields, "hidden")
+	}
+	if o.StartTime != nil {
+		fields = append(fields, fmt.Sprintf("start=%q", o.StartTime.Format(overrideTimeFormat)))
+	}
+	if o.Duration != nil {
+		fields = append(fields, fmt.Sprintf("duration=%s", *o.Duration))
+	}
+	if o.Category != nil {
+		fields = append(fields, fmt.Sprintf("category=%q", *o.Category))
+	}
+	if o.Stage != nil {
+		fields = append(fields, fmt.Sprintf("stage=%q", *o.Stage))
+	}
+	if o.Content != nil {
+		fields = append(fields, fmt.Sprintf("content=%q", *o.Content))
+	}
+	if o.Canceled != nil {
+		fields = append(fields, fmt.Sprintf("canceled=%t", *o.Canceled))
+	}
+	if o.Links != nil {
+		fields = append(fields, fmt.Sprintf("links=%q", strings.Join(o.Links, ",")))
+	}
+	return fmt.Sprintf("[%s] %s", o.Key(), strings.Join(fields, " "))
+}
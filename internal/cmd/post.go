@@ -1,16 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"path"
+	"sort"
 	"time"
 
 	"github.com/urfave/cli"
 
 	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
 	"git.sr.ht/~mariusor/othrys/internal/post"
+	"git.sr.ht/~mariusor/othrys/internal/schedule"
 	"git.sr.ht/~mariusor/othrys/storage"
-	"git.sr.ht/~mariusor/othrys/storage/boltdb"
 )
 
 var PostCmd = cli.Command{
@@ -46,12 +49,19 @@ var PostCmd = cli.Command{
 
 type PostConfig struct {
 	Path       string
+	Storage    storage.Loader
 	DryRun     bool
 	Date       time.Time
 	Resolution time.Duration
-	PostFns    []post.PosterFn
-	infFn      logFn
-	errFn      logFn
+	// PostFns maps the names of the accounts to the functions posting to them
+	PostFns map[string]post.PosterFn
+	// Accepts maps the names of the accounts to the functions returning whether they post the events of a calendar type,
+	// the accounts without one post all of them
+	Accepts map[string]func(string) bool
+	// Ledger, when set, is used to skip the events that have already been posted, and records the new ones
+	Ledger storage.PostLedger
+	infFn  logFn
+	errFn  logFn
 }
 
 func parseStartDate(s string) time.Time {
@@ -100,11 +110,15 @@ func stringSliceValues(c *cli.Context, p string) []string {
 
 func Post(resolution time.Duration) cli.ActionFunc {
 	return func(c *cli.Context) error {
+		st := Storage(c)
 		conf := PostConfig{
 			DryRun:     c.GlobalBool("dry-run"),
 			Date:       parseStartDate(stringValue(c, "date")),
 			Resolution: resolution,
 			Path:       c.GlobalString("path"),
+			Storage:    st,
+			PostFns:    make(map[string]post.PosterFn),
+			Accepts:    make(map[string]func(string) bool),
 		}
 
 		calendars := stringSliceValues(c, "calendar")
@@ -115,14 +129,18 @@ func Post(resolution time.Duration) cli.ActionFunc {
 			if err != nil {
 				return fmt.Errorf("unable to load credentials for the client: %w", err)
 			}
-			for _, cred := range creds {
+			for name, cred := range creds {
 				if cred.Valid(c) {
-					conf.PostFns = append(conf.PostFns, cred.Post())
+					conf.PostFns[name] = cred.Post()
+					conf.Accepts[name] = cred.Accepts
 				}
 			}
+			if ledger, ok := st.(storage.PostLedger); ok && len(conf.PostFns) > 0 {
+				conf.Ledger = ledger
+			}
 		}
 		if len(conf.PostFns) == 0 {
-			conf.PostFns = append(conf.PostFns, post.ToStdout)
+			conf.PostFns["stdout"] = post.ToStdout
 		}
 		return LoadAndPost(conf, calendars...)
 	}
@@ -142,11 +160,10 @@ func LoadAndPost(c PostConfig, types ...string) error {
 		return fmt.Errorf("no valid calendars have been passed: %s", types)
 	}
 
-	repo := boltdb.New(boltdb.Config{
-		Path:  path.Join(c.Path, boltdb.DefaultFile),
-		LogFn: boltdb.LoggerFn(c.infFn),
-		ErrFn: boltdb.LoggerFn(c.errFn),
-	})
+	repo := c.Storage
+	if repo == nil {
+		repo = loadStorage(c.Path, c.infFn, c.errFn)
+	}
 
 	releases, err := repo.LoadEvents(storage.Cursor(c.Date, c.Resolution), types...)
 	if err != nil {
@@ -159,18 +176,99 @@ func LoadAndPost(c PostConfig, types ...string) error {
 		return nil
 	}
 
-	toPostReleases := make(map[time.Time]calendar.Events)
-	for _, r := range releases {
-		day := r.StartTime.Truncate(ResolutionDay)
-		toPostReleases[day] = append(toPostReleases[day], r)
+	for _, name := range sortedKeys(c.PostFns) {
+		posted, skipped, err := postEvents(c.Ledger, name, c.Accepts[name], c.PostFns[name], releases)
+		if skipped > 0 {
+			info("Skipped %d events already posted to %s", skipped, name)
+		}
+		if err != nil {
+			info("Error trying to post to %s: %s", name, err)
+			continue
+		}
+		if posted > 0 {
+			info("Posted %d events to %s", posted, name)
+		}
 	}
+	return nil
+}
 
-	for _, postFn := range c.PostFns {
-		if err := postFn(toPostReleases); err != nil {
-			info("Error trying to post: %s", err)
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// postEvents posts to the account the events that are not in the ledger yet, and records the posted ones in it.
+// Only the events of the calendar types the account accepts get posted, all of them when accepts is nil.
+// It returns how many of the events have been posted, and how many have been skipped as already posted.
+func postEvents(ledger storage.PostLedger, account string, accepts func(string) bool, postFn post.PosterFn, events calendar.Events) (int, int, error) {
+	if accepts != nil {
+		accepted := make(calendar.Events, 0, len(events))
+		for _, ev := range events {
+			if accepts(ev.Type) {
+				accepted = append(accepted, ev)
+			}
 		}
+		events = accepted
 	}
-	return nil
+	toPost := events
+	if ledger != nil {
+		ids := make([]string, 0, len(events))
+		for _, ev := range events {
+			ids = append(ids, calendar.EventID(ev))
+		}
+		records, err := ledger.LoadPostRecords(account, storage.PostKindDigest, ids...)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unable to load the posting ledger: %w", err)
+		}
+		toPost = make(calendar.Events, 0, len(events))
+		for _, ev := range events {
+			if _, ok := records[calendar.EventID(ev)]; !ok {
+				toPost = append(toPost, ev)
+			}
+		}
+	}
+	skipped := len(events) - len(toPost)
+	if len(toPost) == 0 {
+		return 0, skipped, nil
+	}
+
+	// every account gets its own groups, as the posting functions can modify them
+	posted, err := postFn(groupByDay(toPost))
+	metrics.Posted(account, storage.PostKindDigest, err)
+	count := len(toPost)
+	if err != nil {
+		count = len(posted)
+	}
+	if ledger == nil || len(posted) == 0 {
+		return count, skipped, err
+	}
+
+	now := time.Now().UTC()
+	records := make([]storage.PostRecord, 0, len(posted))
+	for _, ev := range toPost {
+		ids, ok := posted[calendar.EventID(ev)]
+		if !ok {
+			continue
+		}
+		records = append(records, storage.PostRecord{
+			Account:  account,
+			Kind:     storage.PostKindDigest,
+			Event:    calendar.EventID(ev),
+			Start:    ev.StartTime,
+			Posted:   now,
+			Day:      ev.StartTime.Truncate(ResolutionDay),
+			Modified: ev.LastModified,
+			IDs:      ids,
+		})
+	}
+	if lerr := ledger.SavePostRecords(records...); lerr != nil {
+		err = errors.Join(err, fmt.Errorf("unable to save the posting ledger: %w", lerr))
+	}
+	return count, skipped, err
 }
 
 func getEventsForTimeAndResolution(rel calendar.Events, when time.Time, resolution time.Duration) calendar.Events {
@@ -218,23 +316,368 @@ const (
 	ResolutionYearish  = 365 * ResolutionDay
 )
 
-func PostEverything(dataPath string, resolution time.Duration) error {
-	creds, err := post.LoadCredentials(dataPath)
+// groupByDay groups the events by the day they start on, like the posts render them
+func groupByDay(events calendar.Events) map[time.Time]calendar.Events {
+	days := make(map[time.Time]calendar.Events)
+	for _, r := range events {
+		day := r.StartTime.Truncate(ResolutionDay)
+		days[day] = append(days[day], r)
+	}
+	return days
+}
+
+// maxPostCatchUp is how far back the periods missed since the last post to an account get posted
+const maxPostCatchUp = ResolutionWeek
+
+// catchUpEvents returns the events of the period starting at start, and the ones which start in the periods
+// missed since from, that haven't ended yet at now.
+func catchUpEvents(events calendar.Events, from, start time.Time, resolution time.Duration, now time.Time) calendar.Events {
+	result := getEventsForTimeAndResolution(events, start, resolution)
+	in := make(map[string]struct{}, len(result))
+	for _, ev := range result {
+		in[calendar.EventID(ev)] = struct{}{}
+	}
+	for _, ev := range events {
+		if _, ok := in[calendar.EventID(ev)]; ok {
+			continue
+		}
+		if !ev.StartTime.Before(from) && ev.StartTime.Before(start) && ev.StartTime.Add(ev.Duration).After(now) {
+			result = append(result, ev)
+		}
+	}
+	return result
+}
+
+// postPeriod posts the events of the calendar types in the period starting at start to each of the accounts,
+// and records the results in status. It stops before the next account when ctx is canceled.
+// With a ledger, the events already posted to an account are skipped, and the events that haven't ended yet
+// of the periods missed since the last post to the account are posted too.
+func postPeriod(ctx context.Context, st storage.Loader, ledger storage.PostLedger, job string, accounts map[string]post.LoginCredentials, types []string, start time.Time, resolution time.Duration, status *post.Status) error {
+	started := time.Now().UTC()
+	end := start.Add(resolution)
+
+	froms := make(map[string]time.Time, len(accounts))
+	earliest := start
+	for name := range accounts {
+		from := start
+		if ledger != nil {
+			until, err := ledger.LoadPostedUntil(name, storage.PostKindDigest)
+			if err != nil {
+				return fmt.Errorf("unable to load the posting ledger: %w", err)
+			}
+			if !until.IsZero() && until.Before(start) {
+				from = until
+			}
+			if limit := start.Add(-maxPostCatchUp); from.Before(limit) {
+				from = limit
+			}
+		}
+		if from.Before(earliest) {
+			earliest = from
+		}
+		froms[name] = from
+	}
+	loaded, err := st.LoadEvents(storage.Cursor(earliest, end.Sub(earliest)), types...)
+	if err != nil {
+		return fmt.Errorf("unable to load releases from storage: %w", err)
+	}
+
+	errs := make([]error, 0)
+	for _, name := range sortedKeys(accounts) {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("stopped before posting to %s: %w", name, err))
+			break
+		}
+		events := catchUpEvents(loaded, froms[name], start, resolution, started)
+		res := post.Result{
+			Account:    name,
+			Kind:       storage.PostKindDigest,
+			Job:        job,
+			Started:    started,
+			Period:     start,
+			Resolution: resolution.String(),
+			Calendars:  types,
+		}
+		res.Events, res.Skipped, err = postEvents(ledger, name, accounts[name].Accepts, accounts[name].Post(), events)
+		if err == nil && ledger != nil {
+			err = ledger.SavePostedUntil(name, storage.PostKindDigest, end)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			errs = append(errs, fmt.Errorf("unable to post to %s: %w", name, err))
+		}
+		res.Finished = time.Now().UTC()
+		status.Record(res)
+	}
+	return errors.Join(errs...)
+}
+
+// reminderInterval is how often the events about to start get checked for the reminders
+const reminderInterval = time.Minute
+
+// remindEvents posts to the accounts the reminders for the events of the calendar types that start within lead,
+// as replies to the daily posts of the events when the ledger has them, and records them in the ledger and in status.
+// Nothing gets posted during the quiet hours, so the events starting in them don't get reminders.
+func remindEvents(ctx context.Context, st storage.Loader, ledger storage.PostLedger, job string, accounts map[string]post.LoginCredentials, types []string, lead time.Duration, quiet *schedule.Hours, status *post.Status, now time.Time) error {
+	now = now.UTC()
+	if quiet != nil && quiet.Contains(now) {
+		return nil
+	}
+	loaded, err := st.LoadEvents(storage.Cursor(now, lead), types...)
+	if err != nil {
+		return fmt.Errorf("unable to load releases from storage: %w", err)
+	}
+	events := make(calendar.Events, 0, len(loaded))
+	ids := make([]string, 0, len(loaded))
+	for _, ev := range loaded {
+		if ev.Canceled || !ev.StartTime.After(now) || ev.StartTime.After(now.Add(lead)) {
+			continue
+		}
+		events = append(events, ev)
+		ids = append(ids, calendar.EventID(ev))
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0)
+	for _, name := range sortedKeys(accounts) {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("stopped before reminding %s: %w", name, err))
+			break
+		}
+		rem, ok := accounts[name].(post.Reminder)
+		if !ok {
+			continue
+		}
+		res := post.Result{
+			Account:    name,
+			Kind:       storage.PostKindReminder,
+			Job:        job,
+			Started:    now,
+			Period:     now,
+			Resolution: lead.String(),
+			Calendars:  types,
+		}
+		if res.Events, res.Skipped, err = remindAccount(ledger, name, rem, events, ids); err != nil {
+			res.Error = err.Error()
+			errs = append(errs, fmt.Errorf("unable to post reminders to %s: %w", name, err))
+		}
+		res.Finished = time.Now().UTC()
+		if res.Events > 0 || res.Error != "" {
+			status.Record(res)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// remindAccount posts to the account the reminders for the events that it hasn't been reminded of yet,
+// and returns how many have been posted and how many skipped as already posted.
+func remindAccount(ledger storage.PostLedger, account string, rem post.Reminder, events calendar.Events, ids []string) (int, int, error) {
+	reminded, err := ledger.LoadPostRecords(account, storage.PostKindReminder, ids...)
 	if err != nil {
-		return fmt.Errorf("no credentials found: %w", err)
+		return 0, 0, fmt.Errorf("unable to load the posting ledger: %w", err)
 	}
-	conf := PostConfig{
-		Date:       time.Now().UTC(),
-		Resolution: resolution,
-		Path:       dataPath,
+	digests, err := ledger.LoadPostRecords(account, storage.PostKindDigest, ids...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to load the posting ledger: %w", err)
 	}
-	for _, cred := range creds {
-		conf.PostFns = append(conf.PostFns, cred.Post())
+
+	errs := make([]error, 0)
+	records := make([]storage.PostRecord, 0, len(events))
+	for _, ev := range events {
+		id := calendar.EventID(ev)
+		if _, ok := reminded[id]; ok {
+			continue
+		}
+		replyTo := ""
+		if rec, ok := digests[id]; ok && len(rec.IDs) > 0 {
+			replyTo = rec.IDs[0]
+		}
+		remote, err := rem.Remind(ev, replyTo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		if remote == "" {
+			continue
+		}
+		records = append(records, storage.PostRecord{
+			Account:  account,
+			Kind:     storage.PostKindReminder,
+			Event:    id,
+			Start:    ev.StartTime,
+			Posted:   time.Now().UTC(),
+			Modified: ev.LastModified,
+			IDs:      []string{remote},
+		})
+	}
+	if len(records) > 0 || len(errs) > 0 {
+		metrics.Posted(account, storage.PostKindReminder, errors.Join(errs...))
+	}
+	if len(records) > 0 {
+		if err := ledger.SavePostRecords(records...); err != nil {
+			errs = append(errs, fmt.Errorf("unable to save the posting ledger: %w", err))
+		}
 	}
+	return len(records), len(reminded), errors.Join(errs...)
+}
 
-	if err = LoadAndPost(conf, calendar.GetTypes(nil)...); err != nil {
-		return fmt.Errorf("unable to post: %w", err)
+// updatePosts changes the posts of the changed events, for the accounts that support it and have posted them,
+// and records their new state in the ledger. The posts can hold other events too, which get loaded from st.
+// The events are posted as they are in st, with their overrides, and the ones hidden by an override are treated as canceled.
+func updatePosts(st storage.Loader, ledger storage.PostLedger, creds map[string]post.LoginCredentials, changed calendar.Events) error {
+	errs := make([]error, 0)
+	byID := make(map[string]calendar.Event, len(changed))
+	ids := make([]string, 0, len(changed))
+	for _, ev := range changed {
+		found, err := storage.FindEvent(st, ev.Type, ev.CalID)
+		switch {
+		case err == nil:
+			ev = found
+		case errors.Is(err, storage.ErrNotFound):
+			ev.Canceled = true
+		default:
+			errs = append(errs, fmt.Errorf("unable to load event %s: %w", calendar.EventID(ev), err))
+			continue
+		}
+		byID[calendar.EventID(ev)] = ev
+		ids = append(ids, calendar.EventID(ev))
+	}
+	if len(ids) == 0 {
+		return errors.Join(errs...)
 	}
 
-	return nil
+	for _, name := range sortedKeys(creds) {
+		upd, ok := creds[name].(post.Updater)
+		if !ok {
+			continue
+		}
+		records, err := ledger.LoadPostRecords(name, storage.PostKindDigest, ids...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to load the posting ledger: %w", err))
+			continue
+		}
+		if len(records) == 0 {
+			continue
+		}
+		objects, err := postedObjects(st, ledger, name, records, byID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		updated, err := upd.Update(objects)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to update the posts of %s: %w", name, err))
+		}
+
+		save := make([]storage.PostRecord, 0, len(records))
+		for _, rec := range records {
+			ev := byID[rec.Event]
+			done := true
+			remaining := make([]string, 0, len(rec.IDs))
+			for _, id := range rec.IDs {
+				deleted, ok := updated[id]
+				done = done && ok
+				if !deleted {
+					remaining = append(remaining, id)
+				}
+			}
+			rec.Day = postedDay(rec)
+			if done {
+				rec.Start = ev.StartTime
+				rec.Modified = ev.LastModified
+			}
+			rec.IDs = remaining
+			save = append(save, rec)
+		}
+		if err := ledger.SavePostRecords(save...); err != nil {
+			errs = append(errs, fmt.Errorf("unable to save the posting ledger: %w", err))
+		}
+		info("Updated %d posts of %s", len(updated), name)
+	}
+	return errors.Join(errs...)
+}
+
+// postedDay returns the day the event of the record has been posted under,
+// the records saved before it was kept have it in Start, as long as the event didn't move.
+func postedDay(rec storage.PostRecord) time.Time {
+	if rec.Day.IsZero() {
+		return rec.Start.Truncate(ResolutionDay)
+	}
+	return rec.Day
+}
+
+// postedObjects returns the remote objects of the records, with all the events they hold: the changed ones,
+// and the ones of the other records of the account that share the objects, as they are in st.
+func postedObjects(st storage.Loader, ledger storage.PostLedger, account string, records map[string]storage.PostRecord, changed map[string]calendar.Event) (map[string]post.Object, error) {
+	objects := make(map[string]post.Object)
+	for _, rec := range records {
+		for _, id := range rec.IDs {
+			objects[id] = post.Object{Day: postedDay(rec)}
+		}
+	}
+	all, err := ledger.LoadPostRecords(account, storage.PostKindDigest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the posting ledger: %w", err)
+	}
+
+	shared := make([]storage.PostRecord, 0)
+	var first, last time.Time
+	types := make([]string, 0)
+	for _, rec := range all {
+		if _, ok := changed[rec.Event]; ok {
+			continue
+		}
+		for _, id := range rec.IDs {
+			if _, ok := objects[id]; !ok {
+				continue
+			}
+			shared = append(shared, rec)
+			if first.IsZero() || rec.Start.Before(first) {
+				first = rec.Start
+			}
+			if rec.Start.After(last) {
+				last = rec.Start
+			}
+			if typ, _, err := calendar.ParseEventID(rec.Event); err == nil && !inStringList(typ, types) {
+				types = append(types, typ)
+			}
+			break
+		}
+	}
+	others := make(map[string]calendar.Event)
+	if len(shared) > 0 {
+		loaded, err := st.LoadEvents(storage.Cursor(first, last.Sub(first)+time.Minute), types...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load releases from storage: %w", err)
+		}
+		for _, ev := range loaded {
+			others[calendar.EventID(ev)] = ev
+		}
+	}
+
+	add := func(rec storage.PostRecord, ev calendar.Event) {
+		for _, id := range rec.IDs {
+			if ob, ok := objects[id]; ok {
+				ob.Events = append(ob.Events, ev)
+				objects[id] = ob
+			}
+		}
+	}
+	for _, rec := range records {
+		add(rec, changed[rec.Event])
+	}
+	for _, rec := range shared {
+		if ev, ok := others[rec.Event]; ok {
+			add(rec, ev)
+		}
+	}
+	for _, ob := range objects {
+		events := ob.Events
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].StartTime.Before(events[j].StartTime)
+		})
+	}
+	return objects, nil
 }
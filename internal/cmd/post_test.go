@@ -0,0 +1,592 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/internal/post"
+	"git.sr.ht/~mariusor/othrys/internal/schedule"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+// testPoster records the events it receives, and fails when err is set
+type testPoster struct {
+	received calendar.Events
+	err      error
+}
+
+func (p *testPoster) post(groups map[time.Time]calendar.Events) (post.Posted, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	posted := make(post.Posted)
+	for _, events := range groups {
+		for _, ev := range events {
+			p.received = append(p.received, ev)
+			posted.Add(fmt.Sprintf("status-%d", ev.CalID), ev)
+		}
+	}
+	return posted, nil
+}
+
+func TestLoadAndPost(t *testing.T) {
+	today := testEvent("sc2", 1, testStart.Add(10*time.Hour), "Group A")
+	tonight := testEvent("sc2", 2, testStart.Add(20*time.Hour), "Group B")
+	tomorrow := testEvent("sc2", 3, testStart.Add(34*time.Hour), "Group C")
+	other := testEvent("dota", 4, testStart.Add(12*time.Hour), "Group D")
+
+	tests := []struct {
+		name       string
+		saved      calendar.Events
+		posted     []string
+		types      []string
+		accepts    []string
+		err        error
+		wantPosted []int64
+		wantLedger []int64
+	}{
+		{
+			name:       "events of the day",
+			saved:      calendar.Events{today, tonight, tomorrow},
+			types:      []string{"sc2"},
+			wantPosted: []int64{1, 2},
+			wantLedger: []int64{1, 2},
+		},
+		{
+			name:       "only the requested types",
+			saved:      calendar.Events{today, other},
+			types:      []string{"sc2"},
+			wantPosted: []int64{1},
+			wantLedger: []int64{1},
+		},
+		{
+			name:       "only the types of the account",
+			saved:      calendar.Events{today, other},
+			types:      []string{"sc2", "dota"},
+			accepts:    []string{"sc2"},
+			wantPosted: []int64{1},
+			wantLedger: []int64{1},
+		},
+		{
+			name:       "no types of the account",
+			saved:      calendar.Events{other},
+			types:      []string{"dota"},
+			accepts:    []string{"sc2"},
+			wantPosted: []int64{},
+			wantLedger: []int64{},
+		},
+		{
+			name:       "skips the events already posted",
+			saved:      calendar.Events{today, tonight},
+			posted:     []string{calendar.EventID(today)},
+			types:      []string{"sc2"},
+			wantPosted: []int64{2},
+			wantLedger: []int64{1, 2},
+		},
+		{
+			name:       "failed post",
+			saved:      calendar.Events{today},
+			types:      []string{"sc2"},
+			err:        errors.New("unavailable"),
+			wantPosted: []int64{},
+			wantLedger: []int64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.New()
+			if err := st.SaveEvents(tt.saved); err != nil {
+				t.Fatalf("unable to save events: %s", err)
+			}
+			for _, id := range tt.posted {
+				rec := storage.PostRecord{Account: "test", Kind: storage.PostKindDigest, Event: id, IDs: []string{"old"}}
+				if err := st.SavePostRecords(rec); err != nil {
+					t.Fatalf("unable to save post records: %s", err)
+				}
+			}
+			p := &testPoster{err: tt.err}
+			conf := PostConfig{
+				Storage:    st,
+				Ledger:     st,
+				Date:       testStart,
+				Resolution: ResolutionDay,
+				PostFns:    map[string]post.PosterFn{"test": p.post},
+			}
+			if tt.accepts != nil {
+				conf.Accepts = map[string]func(string) bool{"test": func(typ string) bool { return slices.Contains(tt.accepts, typ) }}
+			}
+			if err := LoadAndPost(conf, tt.types...); err != nil {
+				t.Fatalf("LoadAndPost returned error: %s", err)
+			}
+			if len(p.received) != len(tt.wantPosted) {
+				t.Fatalf("posted %d events, expected %d", len(p.received), len(tt.wantPosted))
+			}
+			for i, ev := range p.received {
+				if ev.CalID != tt.wantPosted[i] {
+					t.Errorf("posted event %d, expected %d", ev.CalID, tt.wantPosted[i])
+				}
+			}
+			records, err := st.LoadPostRecords("test", storage.PostKindDigest)
+			if err != nil {
+				t.Fatalf("unable to load post records: %s", err)
+			}
+			if len(records) != len(tt.wantLedger) {
+				t.Errorf("recorded %d posts, expected %d", len(records), len(tt.wantLedger))
+			}
+			for _, id := range tt.wantLedger {
+				if _, ok := records[calendar.EventID(calendar.Event{Type: "sc2", CalID: id})]; !ok {
+					t.Errorf("no post recorded for event %d", id)
+				}
+			}
+		})
+	}
+}
+
+func TestPostWithoutObjectIDs(t *testing.T) {
+	today := testEvent("sc2", 1, testStart.Add(10*time.Hour), "Group A")
+	tonight := testEvent("sc2", 2, testStart.Add(20*time.Hour), "Group B")
+	st := memory.New()
+	if err := st.SaveEvents(calendar.Events{today, tonight}); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	calls := 0
+	// a poster that can't tell which of the objects it created holds which event
+	postFn := func(groups map[time.Time]calendar.Events) (post.Posted, error) {
+		calls++
+		posted := make(post.Posted)
+		for _, events := range groups {
+			posted.Sent(events...)
+		}
+		return posted, nil
+	}
+	conf := PostConfig{
+		Storage:    st,
+		Ledger:     st,
+		Date:       testStart,
+		Resolution: ResolutionDay,
+		PostFns:    map[string]post.PosterFn{"test": postFn},
+	}
+	for i := 0; i < 2; i++ {
+		if err := LoadAndPost(conf, "sc2"); err != nil {
+			t.Fatalf("LoadAndPost returned error: %s", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("posted %d times, expected the second run to skip the recorded events", calls)
+	}
+	records, err := st.LoadPostRecords("test", storage.PostKindDigest)
+	if err != nil {
+		t.Fatalf("unable to load post records: %s", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("recorded %d posts, expected 2", len(records))
+	}
+	for id, rec := range records {
+		if len(rec.IDs) > 0 {
+			t.Errorf("recorded the objects %v for %s, expected none", rec.IDs, id)
+		}
+	}
+}
+
+// testUpdater is an account which records the objects it gets asked to update,
+// and deletes the ones whose events have all been canceled
+type testUpdater struct {
+	objects map[string]post.Object
+	err     error
+}
+
+var _ post.Updater = (*testUpdater)(nil)
+
+func (u *testUpdater) Valid(*cli.Context) bool { return true }
+
+func (u *testUpdater) Accepts(string) bool { return true }
+
+func (u *testUpdater) Post() post.PosterFn { return nil }
+
+func (u *testUpdater) Update(objects map[string]post.Object) (post.Updated, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	u.objects = objects
+	updated := make(post.Updated)
+	for id, ob := range objects {
+		deleted := true
+		for _, ev := range ob.Events {
+			deleted = deleted && ev.Canceled
+		}
+		updated[id] = deleted
+	}
+	return updated, nil
+}
+
+func TestUpdatePostsWithOverrides(t *testing.T) {
+	fixed := testEvent("sc2", 1, testStart.Add(10*time.Hour), "Group A")
+	hidden := testEvent("sc2", 2, testStart.Add(20*time.Hour), "Group B")
+	playoffs := "Playoffs"
+
+	st := memory.New()
+	if err := st.SaveEvents(calendar.Events{fixed, hidden}); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	for _, o := range []storage.Override{{Type: "sc2", CalID: 1, Stage: &playoffs}, {Type: "sc2", CalID: 2, Hidden: true}} {
+		if err := st.SaveOverride(o); err != nil {
+			t.Fatalf("unable to save override: %s", err)
+		}
+	}
+	for _, rec := range []storage.PostRecord{
+		{Account: "test", Kind: storage.PostKindDigest, Event: calendar.EventID(fixed), Start: fixed.StartTime, IDs: []string{"status-1"}},
+		{Account: "test", Kind: storage.PostKindDigest, Event: calendar.EventID(hidden), Start: hidden.StartTime, IDs: []string{"status-2"}},
+	} {
+		if err := st.SavePostRecords(rec); err != nil {
+			t.Fatalf("unable to save post records: %s", err)
+		}
+	}
+
+	// the fetched events don't have the overrides applied
+	fetched := calendar.Events{fixed, hidden}
+	fetched[0].Content = "Updated"
+	fetched[1].Content = "Updated"
+	if err := st.SaveEvents(fetched); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	u := &testUpdater{}
+	if err := updatePosts(st, st, map[string]post.LoginCredentials{"test": u}, fetched); err != nil {
+		t.Fatalf("updatePosts returned error: %s", err)
+	}
+
+	if events := u.objects["status-1"].Events; len(events) != 1 || events[0].Stage != playoffs || events[0].Content != "Updated" {
+		t.Errorf("updated status-1 with %v, expected the fetched event with its override", events)
+	}
+	if events := u.objects["status-2"].Events; len(events) != 1 || !events[0].Canceled {
+		t.Errorf("updated status-2 with %v, expected the hidden event to be canceled", events)
+	}
+	records, err := st.LoadPostRecords("test", storage.PostKindDigest)
+	if err != nil {
+		t.Fatalf("unable to load post records: %s", err)
+	}
+	if rec := records[calendar.EventID(hidden)]; len(rec.IDs) != 0 {
+		t.Errorf("recorded the objects %v for the hidden event, expected them deleted", rec.IDs)
+	}
+	if rec := records[calendar.EventID(fixed)]; len(rec.IDs) != 1 {
+		t.Errorf("recorded the objects %v for the overridden event, expected status-1", rec.IDs)
+	}
+}
+
+func TestUpdatePosts(t *testing.T) {
+	first := testEvent("sc2", 1, testStart.Add(10*time.Hour), "Group A")
+	second := testEvent("sc2", 2, testStart.Add(20*time.Hour), "Group B")
+	moved := first
+	moved.StartTime = testStart.Add(34 * time.Hour)
+	moved.LastModified = testStart.Add(time.Hour)
+	canceled := first
+	canceled.Canceled = true
+	canceled.LastModified = testStart.Add(time.Hour)
+	record := func(ev calendar.Event, ids ...string) storage.PostRecord {
+		return storage.PostRecord{
+			Account: "test",
+			Kind:    storage.PostKindDigest,
+			Event:   calendar.EventID(ev),
+			Start:   ev.StartTime,
+			Day:     ev.StartTime.Truncate(ResolutionDay),
+			IDs:     ids,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		records []storage.PostRecord
+		changed calendar.Events
+		err     error
+		// wantObjects are the events of each object the account was asked to update, by their CalID
+		wantObjects map[string][]int64
+		// wantLedger are the records after the update, by the CalID of their event
+		wantLedger map[int64]storage.PostRecord
+	}{
+		{
+			name:        "changed event",
+			records:     []storage.PostRecord{record(first, "status-1")},
+			changed:     calendar.Events{moved},
+			wantObjects: map[string][]int64{"status-1": {1}},
+			wantLedger: map[int64]storage.PostRecord{
+				1: {Start: moved.StartTime, Modified: moved.LastModified, Day: testStart, IDs: []string{"status-1"}},
+			},
+		},
+		{
+			name:        "canceled event",
+			records:     []storage.PostRecord{record(first, "status-1")},
+			changed:     calendar.Events{canceled},
+			wantObjects: map[string][]int64{"status-1": {1}},
+			wantLedger: map[int64]storage.PostRecord{
+				1: {Start: first.StartTime, Modified: canceled.LastModified, Day: testStart, IDs: []string{}},
+			},
+		},
+		{
+			name:        "shared object",
+			records:     []storage.PostRecord{record(first, "status-1"), record(second, "status-1")},
+			changed:     calendar.Events{moved},
+			wantObjects: map[string][]int64{"status-1": {2, 1}},
+			wantLedger: map[int64]storage.PostRecord{
+				1: {Start: moved.StartTime, Modified: moved.LastModified, Day: testStart, IDs: []string{"status-1"}},
+				2: {Start: second.StartTime, Day: testStart, IDs: []string{"status-1"}},
+			},
+		},
+		{
+			name:        "shared object with a canceled event",
+			records:     []storage.PostRecord{record(first, "status-1"), record(second, "status-1")},
+			changed:     calendar.Events{canceled},
+			wantObjects: map[string][]int64{"status-1": {1, 2}},
+			wantLedger: map[int64]storage.PostRecord{
+				1: {Start: first.StartTime, Modified: canceled.LastModified, Day: testStart, IDs: []string{"status-1"}},
+				2: {Start: second.StartTime, Day: testStart, IDs: []string{"status-1"}},
+			},
+		},
+		{
+			name:        "objects of the other events",
+			records:     []storage.PostRecord{record(first, "status-1"), record(second, "status-2")},
+			changed:     calendar.Events{moved},
+			wantObjects: map[string][]int64{"status-1": {1}},
+			wantLedger: map[int64]storage.PostRecord{
+				1: {Start: moved.StartTime, Modified: moved.LastModified, Day: testStart, IDs: []string{"status-1"}},
+				2: {Start: second.StartTime, Day: testStart, IDs: []string{"status-2"}},
+			},
+		},
+		{
+			name:    "not posted",
+			records: []storage.PostRecord{record(second, "status-2")},
+			changed: calendar.Events{moved},
+			wantLedger: map[int64]storage.PostRecord{
+				2: {Start: second.StartTime, Day: testStart, IDs: []string{"status-2"}},
+			},
+		},
+		{
+			name:    "failed update",
+			records: []storage.PostRecord{record(first, "status-1")},
+			changed: calendar.Events{moved},
+			err:     errors.New("unavailable"),
+			wantLedger: map[int64]storage.PostRecord{
+				1: {Start: first.StartTime, Day: testStart, IDs: []string{"status-1"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.New()
+			if err := st.SaveEvents(calendar.Events{first, second}); err != nil {
+				t.Fatalf("unable to save events: %s", err)
+			}
+			if err := st.SaveEvents(tt.changed); err != nil {
+				t.Fatalf("unable to save events: %s", err)
+			}
+			if err := st.SavePostRecords(tt.records...); err != nil {
+				t.Fatalf("unable to save post records: %s", err)
+			}
+
+			u := &testUpdater{err: tt.err}
+			err := updatePosts(st, st, map[string]post.LoginCredentials{"test": u}, tt.changed)
+			if (err != nil) != (tt.err != nil) {
+				t.Fatalf("updatePosts returned error %v, expected %v", err, tt.err)
+			}
+
+			if len(u.objects) != len(tt.wantObjects) {
+				t.Errorf("updated the objects %v, expected %v", u.objects, tt.wantObjects)
+			}
+			for id, want := range tt.wantObjects {
+				ob, ok := u.objects[id]
+				if !ok {
+					t.Errorf("object %s not updated", id)
+					continue
+				}
+				if !ob.Day.Equal(testStart) {
+					t.Errorf("object %s for the day %s, expected %s", id, ob.Day, testStart)
+				}
+				got := make([]int64, 0, len(ob.Events))
+				for _, ev := range ob.Events {
+					got = append(got, ev.CalID)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("object %s holds the events %v, expected %v", id, got, want)
+				}
+			}
+
+			records, err := st.LoadPostRecords("test", storage.PostKindDigest)
+			if err != nil {
+				t.Fatalf("unable to load post records: %s", err)
+			}
+			for id, want := range tt.wantLedger {
+				rec, ok := records[calendar.EventID(calendar.Event{Type: "sc2", CalID: id})]
+				if !ok {
+					t.Errorf("no post recorded for event %d", id)
+					continue
+				}
+				if !rec.Start.Equal(want.Start) || !rec.Modified.Equal(want.Modified) || !rec.Day.Equal(want.Day) {
+					t.Errorf("recorded event %d at %s, modified %s, posted under %s, expected %s, %s, %s",
+						id, rec.Start, rec.Modified, rec.Day, want.Start, want.Modified, want.Day)
+				}
+				if !slices.Equal(rec.IDs, want.IDs) && len(rec.IDs)+len(want.IDs) > 0 {
+					t.Errorf("recorded the objects %v for event %d, expected %v", rec.IDs, id, want.IDs)
+				}
+			}
+		})
+	}
+}
+
+// testReminder is an account which records the events it gets reminders for, and the objects they reply to
+type testReminder struct {
+	reminded []int64
+	replyTo  []string
+}
+
+var _ post.Reminder = (*testReminder)(nil)
+
+func (r *testReminder) Valid(*cli.Context) bool { return true }
+
+func (r *testReminder) Accepts(string) bool { return true }
+
+func (r *testReminder) Post() post.PosterFn { return nil }
+
+func (r *testReminder) Remind(ev calendar.Event, replyTo string) (string, error) {
+	r.reminded = append(r.reminded, ev.CalID)
+	r.replyTo = append(r.replyTo, replyTo)
+	return fmt.Sprintf("reminder-%d", ev.CalID), nil
+}
+
+func TestRemindEvents(t *testing.T) {
+	noon := testStart.Add(12 * time.Hour)
+	quiet, err := schedule.ParseHours("23:00-07:00")
+	if err != nil {
+		t.Fatalf("unable to parse quiet hours: %s", err)
+	}
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		quiet       *schedule.Hours
+		digests     map[int64][]string
+		reminded    []int64
+		wantRemind  []int64
+		wantReplyTo []string
+	}{
+		{
+			name:        "events within the lead time",
+			now:         noon,
+			wantRemind:  []int64{1},
+			wantReplyTo: []string{""},
+		},
+		{
+			name:        "reply to the digest",
+			now:         noon,
+			digests:     map[int64][]string{1: {"status-1", "status-2"}},
+			wantRemind:  []int64{1},
+			wantReplyTo: []string{"status-1"},
+		},
+		{
+			name:       "already reminded",
+			now:        noon,
+			reminded:   []int64{1},
+			wantRemind: []int64{},
+		},
+		{
+			name:        "before the quiet hours",
+			now:         testStart.Add(22*time.Hour + 59*time.Minute),
+			quiet:       &quiet,
+			wantRemind:  []int64{1},
+			wantReplyTo: []string{""},
+		},
+		{
+			name:       "quiet hours before midnight",
+			now:        testStart.Add(23 * time.Hour),
+			quiet:      &quiet,
+			wantRemind: []int64{},
+		},
+		{
+			name:       "quiet hours after midnight",
+			now:        testStart.Add(30 * time.Hour),
+			quiet:      &quiet,
+			wantRemind: []int64{},
+		},
+		{
+			name:        "after the quiet hours",
+			now:         testStart.Add(31 * time.Hour),
+			quiet:       &quiet,
+			wantRemind:  []int64{1},
+			wantReplyTo: []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			soon := testEvent("sc2", 1, tt.now.Add(30*time.Minute), "Group A")
+			later := testEvent("sc2", 2, tt.now.Add(2*time.Hour), "Group B")
+			started := testEvent("sc2", 3, tt.now.Add(-10*time.Minute), "Group C")
+			canceled := testEvent("sc2", 4, tt.now.Add(20*time.Minute), "Group D")
+			canceled.Canceled = true
+
+			st := memory.New()
+			if err := st.SaveEvents(calendar.Events{soon, later, started, canceled}); err != nil {
+				t.Fatalf("unable to save events: %s", err)
+			}
+			for id, ids := range tt.digests {
+				rec := storage.PostRecord{Account: "test", Kind: storage.PostKindDigest, Event: calendar.EventID(calendar.Event{Type: "sc2", CalID: id}), IDs: ids}
+				if err := st.SavePostRecords(rec); err != nil {
+					t.Fatalf("unable to save post records: %s", err)
+				}
+			}
+			for _, id := range tt.reminded {
+				rec := storage.PostRecord{Account: "test", Kind: storage.PostKindReminder, Event: calendar.EventID(calendar.Event{Type: "sc2", CalID: id}), IDs: []string{"old"}}
+				if err := st.SavePostRecords(rec); err != nil {
+					t.Fatalf("unable to save post records: %s", err)
+				}
+			}
+
+			r := &testReminder{}
+			status := &post.Status{}
+			accounts := map[string]post.LoginCredentials{"test": r}
+			if err := remindEvents(context.Background(), st, st, "remind", accounts, []string{"sc2"}, time.Hour, tt.quiet, status, tt.now); err != nil {
+				t.Fatalf("remindEvents returned error: %s", err)
+			}
+			if len(r.reminded) != len(tt.wantRemind) {
+				t.Fatalf("reminded of %v, expected %v", r.reminded, tt.wantRemind)
+			}
+			for i, id := range r.reminded {
+				if id != tt.wantRemind[i] {
+					t.Errorf("reminded of event %d, expected %d", id, tt.wantRemind[i])
+				}
+				if r.replyTo[i] != tt.wantReplyTo[i] {
+					t.Errorf("replied to %q, expected %q", r.replyTo[i], tt.wantReplyTo[i])
+				}
+			}
+
+			records, err := st.LoadPostRecords("test", storage.PostKindReminder)
+			if err != nil {
+				t.Fatalf("unable to load post records: %s", err)
+			}
+			if len(records) != len(tt.reminded)+len(tt.wantRemind) {
+				t.Errorf("recorded %d reminders, expected %d", len(records), len(tt.reminded)+len(tt.wantRemind))
+			}
+			for _, id := range tt.wantRemind {
+				rec, ok := records[calendar.EventID(calendar.Event{Type: "sc2", CalID: id})]
+				if !ok || !slices.Equal(rec.IDs, []string{fmt.Sprintf("reminder-%d", id)}) {
+					t.Errorf("recorded %v for the reminder of event %d", rec.IDs, id)
+				}
+			}
+
+			// the next run doesn't remind of the same events again
+			if err := remindEvents(context.Background(), st, st, "remind", accounts, []string{"sc2"}, time.Hour, tt.quiet, status, tt.now.Add(reminderInterval)); err != nil {
+				t.Fatalf("remindEvents returned error: %s", err)
+			}
+			if len(r.reminded) != len(tt.wantRemind) {
+				t.Errorf("reminded of %v on the next run, expected only %v", r.reminded, tt.wantRemind)
+			}
+			if results := status.Results(); len(tt.wantRemind) > 0 && (len(results) != 1 || results[0].Events != len(tt.wantRemind)) {
+				t.Errorf("status %v, expected %d reminders", results, len(tt.wantRemind))
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	retainMatches     = "matches"
+	retainTournaments = "tournaments"
+	retainDefault     = "default"
+	retainForever     = "forever"
+)
+
+var PruneCmd = cli.Command{
+	Name:  "prune",
+	Usage: "Removes old events from storage according to retention policies",
+	Description: `Retention policies have the form KEY=DURATION, where KEY can be a calendar type, "matches", "tournaments",
+a combination of a type and kind, like "sc2:matches", or "default". The most specific policy is applied to each event.
+DURATION accepts the "d", "w", "mo", "y" units besides the regular ones, or "forever".
+Events that don't match any policy are kept.`,
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "retain",
+			Usage: "Retention policy, eg: sc2=2y, matches=6mo, tournaments=forever",
+		},
+		&cli.BoolFlag{
+			Name:  "compact",
+			Usage: "Compact the storage after removing the events",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only count the events that would be removed",
+		},
+	},
+	Action: pruneEvents,
+}
+
+// retention holds the maximum age of events, a negative value means they are kept forever
+type retention map[string]time.Duration
+
+func parseRetention(policies []string) (retention, error) {
+	r := make(retention)
+	for _, p := range policies {
+		key, val, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention policy %q", p)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		d := time.Duration(-1)
+		if val = strings.TrimSpace(val); val != retainForever {
+			var err error
+			if d, err = calendar.ParseDuration(val); err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid retention duration for %q: %s", key, val)
+			}
+		}
+
+		typ, kind, hasKind := strings.Cut(key, ":")
+		if !hasKind && (typ == retainMatches || typ == retainTournaments) {
+			typ, kind = "", typ
+		}
+		if kind != "" && kind != retainMatches && kind != retainTournaments {
+			return nil, fmt.Errorf("invalid event kind %q", kind)
+		}
+		if typ == "" || typ == retainDefault {
+			r[retentionKey(typ, kind)] = d
+			continue
+		}
+		types := calendar.GetTypes([]string{typ})
+		if len(types) == 0 {
+			return nil, fmt.Errorf("invalid calendar type %q", typ)
+		}
+		for _, t := range types {
+			r[retentionKey(t, kind)] = d
+		}
+	}
+	return r, nil
+}
+
+func retentionKey(typ, kind string) string {
+	if typ == "" || typ == retainDefault {
+		if kind == "" {
+			return retainDefault
+		}
+		return kind
+	}
+	if kind == "" {
+		return typ
+	}
+	return typ + ":" + kind
+}
+
+// expired returns true if the event is older than the most specific retention policy allows
+func (r retention) expired(e calendar.Event, now time.Time) bool {
+	kind := retainMatches
+	if e.IsTournament() {
+		kind = retainTournaments
+	}
+	for _, key := range []string{retentionKey(e.Type, kind), retentionKey(e.Type, ""), retentionKey("", kind), retainDefault} {
+		if d, ok := r[key]; ok {
+			return d >= 0 && e.StartTime.Add(e.Duration).Before(now.Add(-d))
+		}
+	}
+	return false
+}
+
+func pruneEvents(c *cli.Context) error {
+	policies, err := parseRetention(c.StringSlice("retain"))
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 && !c.Bool("compact") {
+		return fmt.Errorf("no retention policies have been passed")
+	}
+
+	st := Storage(c)
+	now := time.Now().UTC()
+	expired := func(e calendar.Event) bool {
+		return policies.expired(e, now)
+	}
+	if len(policies) > 0 {
+		p, ok := st.(storage.Pruner)
+		if !ok {
+			return fmt.Errorf("storage does not support removing events")
+		}
+		if c.Bool("dry-run") {
+			count, err := p.CountEvents(expired)
+			if err != nil {
+				return fmt.Errorf("unable to count events: %w", err)
+			}
+			info("Would remove %d events", count)
+			return nil
+		}
+		removed, err := p.RemoveEvents(expired)
+		if err != nil {
+			return fmt.Errorf("unable to remove events: %w", err)
+		}
+		info("Removed %d events", removed)
+	}
+
+	if c.Bool("compact") {
+		cp, ok := st.(storage.Compacter)
+		if !ok {
+			return fmt.Errorf("storage does not support compaction")
+		}
+		before, after, err := cp.Compact()
+		if err != nil {
+			return err
+		}
+		info("Compacted storage from %d to %d bytes", before, after)
+	}
+	return nil
+}
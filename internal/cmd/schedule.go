@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/internal/config"
+	"git.sr.ht/~mariusor/othrys/internal/post"
+	"git.sr.ht/~mariusor/othrys/internal/schedule"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// AllAccounts is the name used in the post flags for the settings of all the accounts that don't have their own
+const AllAccounts = config.Any
+
+// parsePairs parses the values of the flags that are a name and a value separated by "=", eg: tl=0 */6 * * *
+func parsePairs(values []string) (map[string]string, error) {
+	pairs := make(map[string]string, len(values))
+	for _, v := range values {
+		name, val, ok := strings.Cut(v, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return nil, fmt.Errorf("invalid value %q, it needs to be in the format: name=value", v)
+		}
+		if _, ok := pairs[name]; ok {
+			return nil, fmt.Errorf("duplicate value for %s", name)
+		}
+		pairs[name] = strings.TrimSpace(val)
+	}
+	return pairs, nil
+}
+
+// parseSchedules parses the schedule expressions of the names in exprs
+func parseSchedules(exprs map[string]string) (map[string]schedule.Schedule, error) {
+	schedules := make(map[string]schedule.Schedule, len(exprs))
+	for name, expr := range exprs {
+		s, err := schedule.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule for %s: %w", name, err)
+		}
+		schedules[name] = s
+	}
+	return schedules, nil
+}
+
+func sortedNames(m map[string]schedule.Schedule) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fetchJobs returns the jobs that fetch the calendars of each provider in the schedules,
+// like the fetch command does with its default flags: a month of events from the start of the current day.
+// The posts of the events that changed get updated for the accounts in creds.
+func fetchJobs(st storage.Store, creds map[string]post.LoginCredentials, schedules map[string]schedule.Schedule, debug bool) ([]schedule.Job, error) {
+	ledger, _ := st.(storage.PostLedger)
+	jobs := make([]schedule.Job, 0, len(schedules))
+	for _, provider := range sortedNames(schedules) {
+		if !inStringList(provider, calendar.Providers) {
+			return nil, fmt.Errorf("invalid provider %q, valid ones are: %s", provider, strings.Join(calendar.Providers, ", "))
+		}
+		jobs = append(jobs, schedule.Job{
+			Name:     "fetch:" + provider,
+			Schedule: schedules[provider],
+			Run: func(_ context.Context) error {
+				f, err := New(debug, provider)
+				if err != nil {
+					return err
+				}
+				now := time.Now().UTC()
+				start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+				if err = fetchEvents(f, st, start, ResolutionMonthish); err != nil {
+					return err
+				}
+				if ledger != nil && len(creds) > 0 && len(f.changed) > 0 {
+					if err = updatePosts(st, ledger, creds, f.changed); err != nil {
+						return err
+					}
+				}
+				if len(f.failed) > 0 {
+					return fmt.Errorf("unable to load some of the calendars of %s", provider)
+				}
+				return nil
+			},
+		})
+	}
+	return jobs, nil
+}
+
+// postJobs returns the jobs that post the events to each of the accounts, the AllAccounts settings are used for
+// the accounts with credentials that don't have their own. Each run posts the events of the period of the account's
+// resolution which contains the time of the run, and when st is a storage.PostLedger, the ones of the periods missed
+// since the previous run that haven't ended yet.
+// The accounts with a reminder get a job checking every minute for the events about to start, which needs a ledger.
+func postJobs(st storage.Loader, creds map[string]post.LoginCredentials, accounts map[string]config.Account, status *post.Status) ([]schedule.Job, error) {
+	ledger, _ := st.(storage.PostLedger)
+	names := make([]string, 0, len(accounts))
+	for name := range accounts {
+		if _, ok := creds[name]; !ok && name != AllAccounts {
+			return nil, fmt.Errorf("no credentials found for the %s account", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	jobs := make([]schedule.Job, 0, len(accounts))
+	for _, name := range names {
+		acc := accounts[name]
+		types := calendar.GetTypes(acc.Calendars)
+
+		suffix := ":" + name
+		targets := map[string]post.LoginCredentials{name: creds[name]}
+		if name == AllAccounts {
+			suffix = ""
+			targets = make(map[string]post.LoginCredentials)
+			for account, cred := range creds {
+				if _, own := accounts[account]; !own {
+					targets[account] = cred
+				}
+			}
+		}
+		if acc.Schedule != "" {
+			sched, err := schedule.Parse(acc.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("invalid post schedule for %s: %w", name, err)
+			}
+			resolution := time.Duration(acc.Resolution)
+			if resolution == 0 {
+				resolution = ResolutionDay
+			}
+			job := "post" + suffix
+			jobs = append(jobs, schedule.Job{
+				Name:     job,
+				Schedule: sched,
+				Run: func(ctx context.Context) error {
+					start := time.Now().UTC().Truncate(resolution)
+					return postPeriod(ctx, st, ledger, job, targets, types, start, resolution, status)
+				},
+			})
+		}
+		if acc.Reminder > 0 {
+			if ledger == nil {
+				return nil, fmt.Errorf("the reminders for %s need a storage that keeps a posting ledger", name)
+			}
+			var quiet *schedule.Hours
+			if acc.QuietHours != "" {
+				h, err := schedule.ParseHours(acc.QuietHours)
+				if err != nil {
+					return nil, fmt.Errorf("invalid quiet hours for %s: %w", name, err)
+				}
+				quiet = &h
+			}
+			lead := time.Duration(acc.Reminder)
+			job := "remind" + suffix
+			jobs = append(jobs, schedule.Job{
+				Name:     job,
+				Schedule: schedule.Every(reminderInterval),
+				Run: func(ctx context.Context) error {
+					return remindEvents(ctx, st, ledger, job, targets, types, lead, quiet, status, time.Now())
+				},
+			})
+		}
+	}
+	return jobs, nil
+}
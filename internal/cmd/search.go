@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+var SearchCmd = cli.Command{
+	Name:      "search",
+	Usage:     "Searches saved calendar events",
+	ArgsUsage: "QUERY",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "calendar",
+			Usage: "Which calendars to search",
+			Value: (*cli.StringSlice)(&calendar.DefaultCalendars),
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Date at which to start",
+			Value: defaultStartTime.Format("2006-01-02"),
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "Date at which to end, by default one year after the start",
+		},
+	},
+	Action: searchEvents,
+}
+
+func searchEvents(c *cli.Context) error {
+	query := strings.Join(c.Args(), " ")
+	if len(strings.TrimSpace(query)) == 0 {
+		return fmt.Errorf("no search query has been passed")
+	}
+	types := calendar.GetTypes(stringSliceValues(c, "calendar"))
+
+	from := defaultStartTime
+	if sf := c.String("from"); len(sf) > 0 {
+		sfp, err := time.Parse("2006-01-02", sf)
+		if err != nil {
+			return fmt.Errorf("invalid start date %q", sf)
+		}
+		from = sfp
+	}
+	to := from.Add(ResolutionYearish)
+	if sf := c.String("to"); len(sf) > 0 {
+		sfp, err := time.Parse("2006-01-02", sf)
+		if err != nil {
+			return fmt.Errorf("invalid end date %q", sf)
+		}
+		to = sfp
+	}
+
+	f, err := New(true, types...)
+	if err != nil {
+		return err
+	}
+	events, err := storage.Search(Storage(c), query, storage.Cursor(from, to.Sub(from)), types...)
+	if err != nil {
+		return fmt.Errorf("unable to search events: %w", err)
+	}
+	if len(events) == 0 {
+		fmt.Printf("nothing found\n")
+		return nil
+	}
+	for _, e := range events {
+		f.log("%s", e)
+		if e.Content != "" {
+			f.log("%v", e.Content)
+		}
+	}
+	return nil
+}
@@ -3,13 +3,32 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/urfave/cli"
 
+	"git.sr.ht/~mariusor/othrys/api"
+	"git.sr.ht/~mariusor/othrys/caldav"
+	"git.sr.ht/~mariusor/othrys/feed"
 	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/admin"
+	"git.sr.ht/~mariusor/othrys/internal/config"
+	"git.sr.ht/~mariusor/othrys/internal/health"
+	"git.sr.ht/~mariusor/othrys/internal/listen"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
+	"git.sr.ht/~mariusor/othrys/internal/middleware"
+	"git.sr.ht/~mariusor/othrys/internal/post"
+	"git.sr.ht/~mariusor/othrys/internal/schedule"
+	"git.sr.ht/~mariusor/othrys/savedfeed"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/web"
 	w "git.sr.ht/~mariusor/wrapper"
 )
 
@@ -21,6 +40,27 @@ var Server = cli.Command{
 			Name:  "debug",
 			Usage: "Output debug messages",
 		},
+		&cli.StringFlag{
+			Name:   "config",
+			Usage:  "The JSON configuration file, its values override the ones of the flags, it's read again on SIGHUP",
+			EnvVar: "OTHRYS_CONFIG",
+		},
+		&cli.StringFlag{
+			Name:  "socket",
+			Usage: "Listen on the Unix domain socket at this path, instead of the host and port",
+		},
+		&cli.StringFlag{
+			Name:  "socket-mode",
+			Usage: "The permissions of the Unix domain socket, in octal, eg: 0660",
+		},
+		&cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "The TLS certificate file, it's read again on SIGHUP",
+		},
+		&cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "The TLS key file, it's read again on SIGHUP",
+		},
 		&cli.StringFlag{
 			Name:  "host",
 			Usage: "Set hostname on which to listen to",
@@ -31,12 +71,70 @@ var Server = cli.Command{
 			Usage: "Set hostname on which to listen to",
 			Value: 9999,
 		},
+		&cli.DurationFlag{
+			Name:  "upcoming-past",
+			Usage: "How far in the past the upcoming calendars reach",
+			Value: ical.DefaultUpcomingPast,
+		},
+		&cli.DurationFlag{
+			Name:  "upcoming-future",
+			Usage: "How far in the future the upcoming calendars reach",
+			Value: ical.DefaultUpcomingFuture,
+		},
+		&cli.StringSliceFlag{
+			Name:  "alarm",
+			Usage: "Default reminders for the events in the calendars, as time before the start, eg: 15m,1h",
+		},
+		&cli.StringSliceFlag{
+			Name: "fetch-schedule",
+			Usage: "When to fetch the calendars of a provider, as the provider and a crontab(5) expression in UTC, " +
+				"a descriptor like @daily, or an interval like @every 6h, eg: tl=0 */6 * * *",
+		},
+		&cli.StringSliceFlag{
+			Name: "post-schedule",
+			Usage: "When to post the events to an account, as the name of the account's credentials and a schedule, " +
+				"use " + AllAccounts + " for all the accounts that don't have their own, nothing gets posted without it, eg: " + AllAccounts + "=@daily",
+		},
+		&cli.StringSliceFlag{
+			Name:  "post-calendars",
+			Usage: "Which calendars to post to an account, all of them by default, eg: " + AllAccounts + "=sc2+lol",
+		},
+		&cli.StringSliceFlag{
+			Name:  "post-resolution",
+			Usage: "The length of the period whose events get posted to an account, a day by default, eg: " + AllAccounts + "=12h",
+		},
+		&cli.StringSliceFlag{
+			Name: "post-reminder",
+			Usage: "How long before the start of each event a reminder gets posted to an account, " +
+				"no reminders get posted without it, eg: " + AllAccounts + "=15m",
+		},
+		&cli.StringSliceFlag{
+			Name:  "post-quiet-hours",
+			Usage: "When, in UTC, no reminders get posted to an account, eg: " + AllAccounts + "=23:00-07:00",
+		},
+		&cli.DurationFlag{
+			Name:  "schedule-jitter",
+			Usage: "The maximum random delay added to the scheduled runs",
+		},
+		&cli.StringFlag{
+			Name:   "admin-token",
+			Usage:  "The token for authenticating to the admin endpoints, which are disabled without it, including the status of the posts",
+			EnvVar: "OTHRYS_ADMIN_TOKEN",
+		},
+		&cli.StringSliceFlag{
+			Name: "fetch-max-age",
+			Usage: "How old the last fetch can be for the server to be ready, for all the providers that have been fetched, eg: 36h, " +
+				"or for a provider that is required to have been fetched, eg: tl=24h",
+		},
 	},
 	Action: serverStart,
 }
 
 var wait = 100 * time.Millisecond
 
+// jobsWait is how long stopping the scheduler waits for the cancelled jobs to return
+var jobsWait = 30 * time.Second
+
 var info = func(s string, args ...interface{}) {
 	fmt.Printf(s+"\n", args...)
 }
@@ -46,19 +144,41 @@ var errFn = func(s string, args ...interface{}) {
 }
 
 func serverStart(c *cli.Context) error {
-	listen := fmt.Sprintf("%s:%d", c.String("host"), c.Int("port"))
-	info("Listening on %s", listen)
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	st := configStorage(cfg.Storage)
+	if fs, ok := st.(storage.FetchStore); ok {
+		metrics.LastFetch(fs, errFn)
+	}
+	srv := &server{st: st, posts: new(post.Status)}
+	if cfg.TLS.Enabled() {
+		srv.cert = new(listen.Certificate)
+	}
+	if err = srv.apply(cfg); err != nil {
+		return err
+	}
 
-	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), wait)
-	defer cancel()
+	listeners, err := openListeners(cfg.Listen, srv.cert)
+	if err != nil {
+		srv.stop()
+		return err
+	}
+	for _, l := range listeners {
+		info("Listening on %s %s", l.Addr().Network(), l.Addr())
+	}
 
-	path := c.GlobalString("path")
 	// Get start/stop functions for the http server
-	srvRun, srvStop := w.HttpServer(w.Handler(ical.Routes(path)), w.OnTCP(listen))
-	w.RegisterSignalHandlers(w.SignalHandlers{
+	srvRun, srvStop := listen.Server(middleware.Compress(srv), listeners...)
+	code := w.RegisterSignalHandlers(w.SignalHandlers{
 		syscall.SIGHUP: func(_ chan int) {
 			info("SIGHUP received, reloading configuration")
+			if err := srv.reload(c); err != nil {
+				errFn("Unable to reload configuration, the current one stays in use: %s", err)
+				return
+			}
+			info("Configuration reloaded")
 		},
 		syscall.SIGINT: func(exit chan int) {
 			info("SIGINT received, stopping")
@@ -73,27 +193,381 @@ func serverStart(c *cli.Context) error {
 			exit <- 0
 		},
 	}).Exec(func() error {
-		go func() {
-			for {
-				time.Sleep(5 * time.Minute)
-				if err := PostEverything(DataPath(), 5*time.Minute); err != nil {
-					errFn("Unable to post: %s", err)
-				}
-			}
-		}()
 		if err := srvRun(); err != nil {
 			errFn("Error: %s", err)
 			return err
 		}
-		var err error
-		// Doesn't block if no connections, but will otherwise wait until the timeout deadline.
-		go func(e error) {
-			if err = srvStop(ctx); err != nil {
-				errFn("Error: %s", err)
-			}
-		}(err)
-		return err
+		return nil
 	})
 
+	srv.stop()
+	// Create a deadline to wait for.
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	// Doesn't block if no connections, but will otherwise wait until the timeout deadline.
+	if err := srvStop(ctx); err != nil {
+		errFn("Error: %s", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("server stopped with exit code %d", code)
+	}
+	return nil
+}
+
+// configFromFlags builds the configuration of the server from the command line flags
+func configFromFlags(c *cli.Context) (config.Config, error) {
+	cfg := config.Config{
+		Listen: config.Listen{
+			Host:       c.String("host"),
+			Port:       c.Int("port"),
+			Socket:     c.String("socket"),
+			SocketMode: c.String("socket-mode"),
+		},
+		TLS:     config.TLS{Cert: c.String("tls-cert"), Key: c.String("tls-key")},
+		Storage: config.Storage{Path: c.GlobalString("path"), Ephemeral: c.GlobalBool("ephemeral")},
+		Calendars: config.Calendars{
+			UpcomingPast:   config.Duration(c.Duration("upcoming-past")),
+			UpcomingFuture: config.Duration(c.Duration("upcoming-future")),
+			Alarms:         c.StringSlice("alarm"),
+		},
+		Feeds:      config.Feeds{Saved: true},
+		Jitter:     config.Duration(c.Duration("schedule-jitter")),
+		AdminToken: c.String("admin-token"),
+		Debug:      c.Bool("debug"),
+	}
+	var err error
+	if cfg.Fetch.Schedules, err = parsePairs(c.StringSlice("fetch-schedule")); err != nil {
+		return cfg, err
+	}
+	if cfg.Post.Accounts, err = postAccounts(c); err != nil {
+		return cfg, err
+	}
+	if cfg.Fetch.MaxAge, err = parseFetchAge(c.StringSlice("fetch-max-age")); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// postAccounts builds the posting settings of the accounts from the post flags
+func postAccounts(c *cli.Context) (map[string]config.Account, error) {
+	schedules, err := parsePairs(c.StringSlice("post-schedule"))
+	if err != nil {
+		return nil, err
+	}
+	calendars, err := parsePairs(c.StringSlice("post-calendars"))
+	if err != nil {
+		return nil, err
+	}
+	resolutions, err := parsePairs(c.StringSlice("post-resolution"))
+	if err != nil {
+		return nil, err
+	}
+	reminders, err := parsePairs(c.StringSlice("post-reminder"))
+	if err != nil {
+		return nil, err
+	}
+	quiet, err := parsePairs(c.StringSlice("post-quiet-hours"))
+	if err != nil {
+		return nil, err
+	}
+	accounts := make(map[string]config.Account, len(schedules))
+	for name, expr := range schedules {
+		accounts[name] = config.Account{Schedule: expr}
+	}
+	for name, raw := range reminders {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post reminder %q for %s", raw, name)
+		}
+		acc := accounts[name]
+		acc.Reminder = config.Duration(d)
+		accounts[name] = acc
+	}
+	for name, types := range calendars {
+		acc, ok := accounts[name]
+		if !ok {
+			return nil, fmt.Errorf("no post schedule or reminder for the calendars of %s", name)
+		}
+		acc.Calendars = strings.Split(types, "+")
+		accounts[name] = acc
+	}
+	for name, raw := range resolutions {
+		acc, ok := accounts[name]
+		if !ok || acc.Schedule == "" {
+			return nil, fmt.Errorf("no post schedule for the resolution of %s", name)
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post resolution %q for %s", raw, name)
+		}
+		acc.Resolution = config.Duration(d)
+		accounts[name] = acc
+	}
+	for name, hours := range quiet {
+		acc, ok := accounts[name]
+		if !ok || acc.Reminder == 0 {
+			return nil, fmt.Errorf("no post reminder for the quiet hours of %s", name)
+		}
+		acc.QuietHours = hours
+		accounts[name] = acc
+	}
+	return accounts, nil
+}
+
+// loadConfig returns the configuration from the flags, overridden by the values in the file of the "config" flag
+func loadConfig(c *cli.Context) (config.Config, error) {
+	cfg, err := configFromFlags(c)
+	if err != nil {
+		return cfg, err
+	}
+	if p := c.String("config"); p != "" {
+		if cfg, err = config.Load(p, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if err = cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// openListeners returns the sockets passed by systemd socket activation,
+// or otherwise the Unix domain socket or the TCP address of l, all of them using TLS when cert is not nil.
+func openListeners(l config.Listen, cert *listen.Certificate) ([]net.Listener, error) {
+	listeners, err := listen.Systemd()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) == 0 {
+		var sock net.Listener
+		if l.Socket != "" {
+			// Validate has already checked it
+			mode, _ := l.Mode()
+			sock, err = listen.Unix(l.Socket, mode)
+		} else {
+			sock, err = listen.TCP(l.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, sock)
+	}
+	if cert != nil {
+		for i, sock := range listeners {
+			listeners[i] = listen.TLS(sock, cert)
+		}
+	}
+	return listeners, nil
+}
+
+// parseFetchAge parses the values of the fetch-max-age flag, which are either a duration applying to all providers,
+// or a provider and duration pair, separated by "="
+func parseFetchAge(values []string) (map[string]config.Duration, error) {
+	ages := make(map[string]config.Duration)
+	for _, v := range values {
+		provider, raw, ok := strings.Cut(strings.TrimSpace(v), "=")
+		if !ok {
+			provider, raw = config.Any, provider
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fetch max age %q", v)
+		}
+		ages[provider] = config.Duration(d)
+	}
+	return ages, nil
+}
+
+func fetchAge(ages map[string]config.Duration) health.FetchAge {
+	age := health.FetchAge{Providers: make(map[string]time.Duration)}
+	for provider, d := range ages {
+		if provider == config.Any {
+			age.Default = time.Duration(d)
+			continue
+		}
+		age.Providers[provider] = time.Duration(d)
+	}
+	return age
+}
+
+// server holds the parts that get replaced when the configuration is reloaded:
+// the routes, which are swapped atomically, the scheduler of the fetch and post jobs, and the TLS certificate.
+type server struct {
+	st      storage.Store
+	cert    *listen.Certificate
+	posts   *post.Status
+	handler atomic.Pointer[http.Handler]
+
+	m     sync.Mutex
+	cfg   config.Config
+	sched *schedule.Scheduler
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
+
+// apply builds the routes and the jobs for cfg, and only if that succeeds it replaces the current ones with them
+func (s *server) apply(cfg config.Config) error {
+	creds, err := postCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	sched, err := s.scheduler(cfg, creds)
+	if err != nil {
+		return err
+	}
+	routes := s.routes(cfg, sched)
+	if s.cert != nil {
+		if err = s.cert.Load(cfg.TLS.Cert, cfg.TLS.Key); err != nil {
+			return err
+		}
+	}
+
+	if len(cfg.Post.Accounts) > 0 && cfg.AdminToken == "" {
+		errFn("Posting is enabled without an admin token, the status of the posts at %s/posts is not served", admin.Prefix)
+	}
+
+	s.m.Lock()
+	prev := s.sched
+	s.cfg = cfg
+	s.sched = sched
+	s.m.Unlock()
+	if prev != nil {
+		// this waits for the running jobs, so they don't overlap with the ones of the new scheduler,
+		// a stop received in the meantime stops the new scheduler before it starts.
+		stopScheduler(prev)
+	}
+	// the routes can trigger the jobs, so the scheduler needs to run before they get published
+	sched.Start()
+	s.handler.Store(&routes)
 	return nil
 }
+
+// postCredentials loads the credentials of the accounts from the storage path, when posting is enabled
+func postCredentials(cfg config.Config) (map[string]post.LoginCredentials, error) {
+	if len(cfg.Post.Accounts) == 0 {
+		return nil, nil
+	}
+	creds, err := post.LoadCredentials(cfg.Storage.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// reload reads the configuration again, the settings that need a restart keep their current values
+func (s *server) reload(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	s.m.Lock()
+	current := s.cfg
+	s.m.Unlock()
+	if changed := config.RequiresRestart(current, cfg); len(changed) > 0 {
+		errFn("Changes to %s require a restart, they are ignored", strings.Join(changed, ", "))
+		cfg.Listen, cfg.Storage = current.Listen, current.Storage
+		if cfg.TLS.Enabled() != current.TLS.Enabled() {
+			cfg.TLS = current.TLS
+		}
+	}
+	return s.apply(cfg)
+}
+
+func (s *server) stop() {
+	s.m.Lock()
+	sched := s.sched
+	s.m.Unlock()
+	if sched != nil {
+		stopScheduler(sched)
+	}
+}
+
+// stopScheduler cancels the jobs of sched and waits for them to return for at most jobsWait
+func stopScheduler(sched *schedule.Scheduler) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobsWait)
+	defer cancel()
+	if err := sched.Stop(ctx); err != nil {
+		errFn("Stopped waiting for the running jobs to return: %s", err)
+	}
+}
+
+func (s *server) scheduler(cfg config.Config, creds map[string]post.LoginCredentials) (*schedule.Scheduler, error) {
+	fetchSchedules, err := parseSchedules(cfg.Fetch.Schedules)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := fetchJobs(s.st, creds, fetchSchedules, cfg.Debug)
+	if err != nil {
+		return nil, err
+	}
+	posting, err := postJobs(s.st, creds, cfg.Post.Accounts, s.posts)
+	if err != nil {
+		return nil, err
+	}
+	jobs = append(jobs, posting...)
+	opts := []schedule.OptionFn{schedule.WithJitter(time.Duration(cfg.Jitter)), schedule.WithLogger(info, errFn)}
+	if js, ok := s.st.(storage.JobStore); ok {
+		opts = append(opts, schedule.WithStore(js))
+	}
+	return schedule.New(jobs, opts...)
+}
+
+func (s *server) routes(cfg config.Config, sched *schedule.Scheduler) http.Handler {
+	// Validate has already checked them
+	alarms, _ := ical.ParseAlarms(cfg.Calendars.Alarms)
+	past, future := time.Duration(cfg.Calendars.UpcomingPast), time.Duration(cfg.Calendars.UpcomingFuture)
+
+	// the read only routes get the instrumented storage, the capabilities of st are checked on the original
+	loader := metrics.Loader(s.st)
+	routes := http.NewServeMux()
+	routes.Handle("/metrics", metrics.Route("metrics", metrics.Handler()))
+	routes.Handle("/healthz", metrics.Route("health", health.Live()))
+	routes.Handle("/readyz", metrics.Route("health", health.Ready(readinessChecks(s.st, cfg, fetchAge(cfg.Fetch.MaxAge))...)))
+	if cfg.AdminToken != "" {
+		routes.Handle(admin.Prefix+"/", metrics.Route("admin", admin.Routes(cfg.AdminToken, sched, s.posts)))
+	}
+	routes.Handle(api.Prefix+"/", metrics.Route("api", api.Routes(loader, api.WithUpcomingWindow(past, future))))
+	davRoutes := metrics.Route("caldav", caldav.Routes(loader))
+	routes.Handle(caldav.Prefix+"/", davRoutes)
+	routes.Handle(caldav.WellKnownPath, davRoutes)
+	routes.Handle(feed.Prefix+"/", metrics.Route("feed", feed.Routes(loader, feed.WithUpcomingWindow(past, future))))
+	if saved, ok := s.st.(storage.SavedFeedStore); ok && cfg.Feeds.Saved {
+		savedRoutes := metrics.Route("saved", savedfeed.Routes(saved, routes,
+			savedfeed.WithMaxFeeds(cfg.Feeds.MaxSaved),
+			savedfeed.WithCreateLimit(cfg.Feeds.SavedPerHour, time.Hour),
+		))
+		routes.Handle(savedfeed.Prefix+"/", savedRoutes)
+		routes.Handle(savedfeed.Prefix, savedRoutes)
+	}
+	routes.Handle("/", metrics.Route("ical", ical.Routes(loader,
+		ical.WithUpcomingWindow(past, future),
+		ical.WithAlarms(alarms...),
+		ical.WithHTMLView(web.NewHandler(loader, web.WithUpcomingWindow(past, future))),
+	)))
+	return routes
+}
+
+// readinessChecks returns the conditions for the server to be ready: the storage can be loaded,
+// the events have been fetched recently enough, and when posting is enabled, the credentials can be loaded.
+func readinessChecks(st storage.Store, cfg config.Config, age health.FetchAge) []health.Check {
+	checks := []health.Check{health.Storage(st)}
+	if fs, ok := st.(storage.FetchStore); ok && age.Enabled() {
+		checks = append(checks, health.Fetch(fs, age))
+	}
+	if len(cfg.Post.Accounts) == 0 {
+		return checks
+	}
+	checks = append(checks, health.Check{
+		Name: "credentials",
+		Fn: func(_ context.Context) (any, error) {
+			creds, err := postCredentials(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int{"accounts": len(creds)}, nil
+		},
+	})
+	return checks
+}
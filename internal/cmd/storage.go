@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"path"
+
+	"github.com/urfave/cli"
+
+	"git.sr.ht/~mariusor/othrys/internal/config"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/boltdb"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+var EphemeralFlag = &cli.BoolFlag{
+	Name:  "ephemeral",
+	Usage: "Use an in memory storage that is discarded at exit, useful for dry runs",
+}
+
+// Storage returns the storage for the "path" flag, or an in memory one when running with "ephemeral"
+func Storage(c *cli.Context) storage.Store {
+	if c.GlobalBool("ephemeral") {
+		return memory.New()
+	}
+	return loadStorage(c.GlobalString("path"), nil, errFn)
+}
+
+// configStorage returns the storage for the storage section of the server configuration
+func configStorage(s config.Storage) storage.Store {
+	if s.Ephemeral {
+		return memory.New()
+	}
+	return loadStorage(s.Path, nil, errFn)
+}
+
+func loadStorage(p string, infFn, errFn logFn) storage.Store {
+	return boltdb.New(boltdb.Config{
+		Path:  path.Join(p, boltdb.DefaultFile),
+		LogFn: boltdb.LoggerFn(infFn),
+		ErrFn: boltdb.LoggerFn(errFn),
+	})
+}
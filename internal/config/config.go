@@ -0,0 +1,296 @@
+// Package config is the configuration model of the server, which can be loaded from a JSON file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/schedule"
+)
+
+// Any is the key of the maps by provider or account, for the values that apply to all the ones without their own
+const Any = "*"
+
+// Duration is a time.Duration that gets encoded in JSON as a string, eg: "36h"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, it needs to be a string, eg: \"36h\"", raw)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Listen is the address the server accepts connections on.
+// When the server is started by systemd socket activation, the sockets it receives are used instead.
+type Listen struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Socket is the path of a Unix domain socket to listen on, instead of the TCP address
+	Socket string `json:"socket,omitempty"`
+	// SocketMode are the permissions of the socket, in octal, eg: "0660"
+	SocketMode string `json:"socket_mode,omitempty"`
+}
+
+func (l Listen) String() string {
+	return fmt.Sprintf("%s:%d", l.Host, l.Port)
+}
+
+// Mode returns the permissions of the socket, 0 if they're not set
+func (l Listen) Mode() (os.FileMode, error) {
+	if l.SocketMode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q, it needs to be octal permissions, eg: 0660", l.SocketMode)
+	}
+	return os.FileMode(m), nil
+}
+
+// TLS are the certificate and key files for serving over TLS, they're loaded again on configuration reloads
+type TLS struct {
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// Enabled returns if the server uses TLS
+func (t TLS) Enabled() bool {
+	return t.Cert != "" || t.Key != ""
+}
+
+// Storage is where the events, and the credentials of the accounts, are stored
+type Storage struct {
+	Path      string `json:"path"`
+	Ephemeral bool   `json:"ephemeral,omitempty"`
+}
+
+// Calendars are the settings for the calendars served by all the routes
+type Calendars struct {
+	UpcomingPast   Duration `json:"upcoming_past"`
+	UpcomingFuture Duration `json:"upcoming_future"`
+	// Alarms are the default reminders of the iCal routes, eg: "15m"
+	Alarms []string `json:"alarms,omitempty"`
+}
+
+// Feeds are the settings for the feeds
+type Feeds struct {
+	// Saved enables the saved feeds, served under their secret URLs
+	Saved bool `json:"saved"`
+	// MaxSaved is the number of saved feeds after which the form stops creating new ones, 10000 when it's not set
+	MaxSaved int `json:"max_saved,omitempty"`
+	// SavedPerHour is the number of feeds each client can create from the form in an hour, 10 when it's not set
+	SavedPerHour int `json:"saved_per_hour,omitempty"`
+}
+
+// Fetch are the settings for fetching the calendars of the providers
+type Fetch struct {
+	// Schedules maps the providers to the schedules for fetching their calendars
+	Schedules map[string]string `json:"schedules,omitempty"`
+	// MaxAge maps the providers to the maximum age of their last fetch for the server to be ready,
+	// the Any key applies to all the other providers that have been fetched at least once.
+	MaxAge map[string]Duration `json:"max_age,omitempty"`
+}
+
+// Account are the settings for posting the events to an account
+type Account struct {
+	// Schedule is when to post, as a crontab(5) expression in UTC, a descriptor like @daily, or an interval like @every 6h,
+	// only the reminders get posted when it's empty
+	Schedule string `json:"schedule,omitempty"`
+	// Calendars are the types of the calendars to post, all of them when empty
+	Calendars []string `json:"calendars,omitempty"`
+	// Resolution is the length of the period, starting with the current one, whose events get posted, a day when empty
+	Resolution Duration `json:"resolution,omitempty"`
+	// Reminder is how long before the start of each event a reminder for it gets posted, eg: "15m",
+	// no reminders get posted when it's empty
+	Reminder Duration `json:"reminder,omitempty"`
+	// QuietHours is the interval of each day, in UTC, when no reminders get posted, eg: "23:00-07:00"
+	QuietHours string `json:"quiet_hours,omitempty"`
+}
+
+// Post are the settings for posting the events to the accounts, nothing gets posted unless some accounts are set.
+// The results of the last posts are served at /admin/posts, which needs the admin token.
+type Post struct {
+	// Accounts maps the names of the accounts' credentials to their settings,
+	// the Any key applies to all the other accounts that have credentials
+	Accounts map[string]Account `json:"accounts,omitempty"`
+}
+
+// Config is the configuration of the server
+type Config struct {
+	Listen    Listen    `json:"listen"`
+	TLS       TLS       `json:"tls"`
+	Storage   Storage   `json:"storage"`
+	Calendars Calendars `json:"calendars"`
+	Feeds     Feeds     `json:"feeds"`
+	Fetch     Fetch     `json:"fetch"`
+	Post      Post      `json:"post"`
+	// Jitter is the maximum random delay added to the scheduled runs
+	Jitter Duration `json:"schedule_jitter,omitempty"`
+	// AdminToken authenticates the requests to the admin endpoints, which are disabled without it.
+	// The status of the posts to the accounts is one of them, so it needs to be set to see it.
+	AdminToken string `json:"admin_token,omitempty"`
+	Debug      bool   `json:"debug,omitempty"`
+}
+
+func cloneMap[V any](m map[string]V) map[string]V {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Clone returns a deep copy of c
+func (c Config) Clone() Config {
+	n := c
+	n.Calendars.Alarms = append([]string(nil), c.Calendars.Alarms...)
+	n.Fetch.Schedules = cloneMap(c.Fetch.Schedules)
+	n.Fetch.MaxAge = cloneMap(c.Fetch.MaxAge)
+	n.Post.Accounts = cloneMap(c.Post.Accounts)
+	for name, acc := range n.Post.Accounts {
+		acc.Calendars = append([]string(nil), acc.Calendars...)
+		n.Post.Accounts[name] = acc
+	}
+	return n
+}
+
+// Load reads the JSON file at path over a copy of base, the values in the file replace the ones in base,
+// except for the maps, which get the keys in the file added to the ones in base.
+func Load(path string, base Config) (Config, error) {
+	c := base.Clone()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("unable to read configuration: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func validProvider(p string) bool {
+	for _, provider := range calendar.Providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns all the errors in the configuration
+func (c Config) Validate() error {
+	errs := make([]error, 0)
+	if c.Listen.Port < 0 || c.Listen.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port %d", c.Listen.Port))
+	}
+	if _, err := c.Listen.Mode(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.TLS.Enabled() && (c.TLS.Cert == "" || c.TLS.Key == "") {
+		errs = append(errs, errors.New("TLS needs both the certificate and the key files"))
+	}
+	if !c.Storage.Ephemeral && c.Storage.Path == "" {
+		errs = append(errs, errors.New("missing storage path"))
+	}
+	if c.Calendars.UpcomingPast < 0 {
+		errs = append(errs, fmt.Errorf("invalid upcoming past %s, it can't be negative", time.Duration(c.Calendars.UpcomingPast)))
+	}
+	if c.Calendars.UpcomingFuture <= 0 {
+		errs = append(errs, fmt.Errorf("invalid upcoming future %s, it needs to be positive", time.Duration(c.Calendars.UpcomingFuture)))
+	}
+	if _, err := ical.ParseAlarms(c.Calendars.Alarms); err != nil {
+		errs = append(errs, err)
+	}
+	for provider, expr := range c.Fetch.Schedules {
+		if !validProvider(provider) {
+			errs = append(errs, fmt.Errorf("invalid fetch provider %q, valid ones are: %s", provider, strings.Join(calendar.Providers, ", ")))
+		}
+		if _, err := schedule.Parse(expr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid fetch schedule for %s: %w", provider, err))
+		}
+	}
+	for provider, age := range c.Fetch.MaxAge {
+		if provider != Any && !validProvider(provider) {
+			errs = append(errs, fmt.Errorf("invalid max age provider %q, valid ones are: %s", provider, strings.Join(calendar.Providers, ", ")))
+		}
+		if age <= 0 {
+			errs = append(errs, fmt.Errorf("invalid max age %s for %s, it needs to be positive", time.Duration(age), provider))
+		}
+	}
+	for account, acc := range c.Post.Accounts {
+		if acc.Schedule == "" && acc.Reminder == 0 {
+			errs = append(errs, fmt.Errorf("nothing to post to %s, it needs a schedule or a reminder", account))
+		}
+		if acc.Schedule != "" {
+			if _, err := schedule.Parse(acc.Schedule); err != nil {
+				errs = append(errs, fmt.Errorf("invalid post schedule for %s: %w", account, err))
+			}
+		}
+		for _, typ := range acc.Calendars {
+			if len(calendar.GetTypes([]string{typ})) == 0 {
+				errs = append(errs, fmt.Errorf("invalid calendar %q to post to %s", typ, account))
+			}
+		}
+		if acc.Resolution < 0 {
+			errs = append(errs, fmt.Errorf("invalid post resolution %s for %s, it can't be negative", time.Duration(acc.Resolution), account))
+		}
+		if acc.Reminder < 0 {
+			errs = append(errs, fmt.Errorf("invalid reminder %s for %s, it can't be negative", time.Duration(acc.Reminder), account))
+		}
+		if acc.QuietHours != "" {
+			if _, err := schedule.ParseHours(acc.QuietHours); err != nil {
+				errs = append(errs, fmt.Errorf("invalid quiet hours for %s: %w", account, err))
+			}
+		}
+	}
+	if c.Feeds.MaxSaved < 0 {
+		errs = append(errs, fmt.Errorf("invalid max saved feeds %d, it can't be negative", c.Feeds.MaxSaved))
+	}
+	if c.Feeds.SavedPerHour < 0 {
+		errs = append(errs, fmt.Errorf("invalid saved feeds per hour %d, it can't be negative", c.Feeds.SavedPerHour))
+	}
+	if c.Jitter < 0 {
+		errs = append(errs, fmt.Errorf("invalid schedule jitter %s, it can't be negative", time.Duration(c.Jitter)))
+	}
+	return errors.Join(errs...)
+}
+
+// RequiresRestart returns the settings that differ between the previous and the next configuration,
+// and can't be changed while the server is running
+func RequiresRestart(prev, next Config) []string {
+	changed := make([]string, 0)
+	if prev.Listen != next.Listen {
+		changed = append(changed, "listen")
+	}
+	if prev.TLS.Enabled() != next.TLS.Enabled() {
+		changed = append(changed, "tls")
+	}
+	if prev.Storage != next.Storage {
+		changed = append(changed, "storage")
+	}
+	return changed
+}
@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// Storage checks that the events in st can be loaded, or when it implements storage.Checker,
+// that it can be opened before the check times out.
+func Storage(st storage.Loader) Check {
+	return Check{
+		Name: "storage",
+		Fn: func(ctx context.Context) (any, error) {
+			if c, ok := st.(storage.Checker); ok {
+				return nil, c.Check(ctx)
+			}
+			_, err := st.LoadEvents(storage.Cursor(time.Now().UTC(), time.Second))
+			return nil, err
+		},
+	}
+}
+
+// FetchAge is the freshness requirement for the events of the calendar providers
+type FetchAge struct {
+	// Providers maps the providers that are required to have been fetched to the maximum age of their last fetch
+	Providers map[string]time.Duration
+	// Default is the maximum age for the other providers that have been fetched at least once, zero disables it
+	Default time.Duration
+}
+
+// Enabled returns true when the requirement checks anything
+func (a FetchAge) Enabled() bool {
+	return a.Default > 0 || len(a.Providers) > 0
+}
+
+// Fetch checks that the last successful fetch of every provider in st is within the age requirement
+func Fetch(st storage.FetchStore, age FetchAge) Check {
+	return Check{
+		Name: "fetch",
+		Fn: func(_ context.Context) (any, error) {
+			fetches, err := st.LoadFetches()
+			if err != nil {
+				return nil, err
+			}
+			now := time.Now().UTC()
+			details := make(map[string]time.Time, len(fetches))
+			stale := make([]string, 0)
+			for provider := range age.Providers {
+				if _, ok := fetches[provider]; !ok {
+					stale = append(stale, fmt.Sprintf("%s has never been fetched", provider))
+				}
+			}
+			for provider, t := range fetches {
+				details[provider] = t
+				maxAge, ok := age.Providers[provider]
+				if !ok {
+					maxAge = age.Default
+				}
+				if maxAge > 0 && now.Sub(t) > maxAge {
+					stale = append(stale, fmt.Sprintf("%s was last fetched %s ago", provider, now.Sub(t).Truncate(time.Second)))
+				}
+			}
+			if len(stale) > 0 {
+				sort.Strings(stale)
+				return details, errors.New(strings.Join(stale, ", "))
+			}
+			return details, nil
+		},
+	}
+}
@@ -0,0 +1,110 @@
+// Package health serves the liveness and readiness endpoints of the server.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	// Timeout is the time every readiness check gets to complete
+	Timeout = 5 * time.Second
+)
+
+// Check is a named condition the server needs to fulfill to be ready,
+// Fn returns details about the state it checked, and an error when the condition is not fulfilled.
+type Check struct {
+	Name string
+	Fn   func(context.Context) (any, error)
+}
+
+// Result is the outcome of a single Check
+type Result struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Report is the body of the responses of the health endpoints
+type Report struct {
+	Status  string            `json:"status"`
+	Started time.Time         `json:"started"`
+	Uptime  string            `json:"uptime"`
+	Checks  map[string]Result `json:"checks,omitempty"`
+}
+
+var started = time.Now().UTC()
+
+func newReport() Report {
+	return Report{
+		Status:  StatusOK,
+		Started: started,
+		Uptime:  time.Since(started).Truncate(time.Second).String(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// Live responds successfully for as long as the process is able to serve requests
+func Live() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, newReport())
+	})
+}
+
+// Ready runs the checks and responds with 503 Service Unavailable if any of them fails
+func Ready(checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := newReport()
+		rep.Checks = make(map[string]Result, len(checks))
+		for _, c := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), Timeout)
+			rep.Checks[c.Name] = run(ctx, c)
+			cancel()
+			if rep.Checks[c.Name].Status != StatusOK {
+				rep.Status = StatusFail
+			}
+		}
+		status := http.StatusOK
+		if rep.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, rep)
+	})
+}
+
+// run executes the check, giving up on it when ctx expires
+func run(ctx context.Context, c Check) Result {
+	type outcome struct {
+		details any
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := c.Fn(ctx)
+		done <- outcome{details: details, err: err}
+	}()
+	select {
+	case o := <-done:
+		res := Result{Status: StatusOK, Details: o.details}
+		if o.err != nil {
+			res.Status = StatusFail
+			res.Error = o.err.Error()
+		}
+		return res
+	case <-ctx.Done():
+		return Result{Status: StatusFail, Error: ctx.Err().Error()}
+	}
+}
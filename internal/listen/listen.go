@@ -0,0 +1,119 @@
+// Package listen creates the listeners of the server: TCP addresses, Unix domain sockets,
+// or the sockets passed by systemd, optionally wrapped in TLS.
+package listen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// TCP listens on the addr TCP address
+func TCP(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// Unix listens on the Unix domain socket at path, and sets mode as its permissions when it's not 0.
+// A socket left over at path by a previous run gets removed.
+func Unix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unable to listen on %s, it exists and it's not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode == 0 {
+		return l, nil
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("unable to set the permissions of %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// listenFdsStart is the first file descriptor passed by systemd, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// Systemd returns the listeners for the sockets passed by systemd socket activation,
+// or no listeners if the process hasn't been socket activated.
+func Systemd() ([]net.Listener, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	// the variables are meant for us alone, not for the processes we might start
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "systemd socket "+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("unable to use the systemd socket %d: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// Server returns the functions for starting and stopping a http server for h on all the listeners.
+// The start function blocks until the server stops, and returns the first error of a listener.
+func Server(h http.Handler, listeners ...net.Listener) (func() error, func(context.Context) error) {
+	servers := make([]*http.Server, 0, len(listeners))
+	for range listeners {
+		servers = append(servers, &http.Server{Handler: h})
+	}
+	var once sync.Once
+	start := func() error {
+		if len(listeners) == 0 {
+			return errors.New("no listeners have been configured")
+		}
+		errs := make(chan error, len(listeners))
+		for i, l := range listeners {
+			go func(srv *http.Server, l net.Listener) {
+				errs <- srv.Serve(l)
+			}(servers[i], l)
+		}
+		for range listeners {
+			if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+		}
+		return nil
+	}
+	stop := func(ctx context.Context) error {
+		var err error
+		once.Do(func() {
+			errs := make([]error, 0)
+			for _, srv := range servers {
+				if err := srv.Shutdown(ctx); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			err = errors.Join(errs...)
+		})
+		return err
+	}
+	return start, stop
+}
@@ -0,0 +1,47 @@
+package listen
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Certificate is the TLS certificate of the server, which can be loaded again from its files
+// without restarting the listeners that use it.
+type Certificate struct {
+	m    sync.RWMutex
+	cert *tls.Certificate
+}
+
+// Load reads the certificate and key files, the current certificate is kept if they are not valid
+func (c *Certificate) Load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load the TLS certificate: %w", err)
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// GetCertificate is the tls.Config.GetCertificate function returning the current certificate
+func (c *Certificate) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	if c.cert == nil {
+		return nil, errors.New("no TLS certificate has been loaded")
+	}
+	return c.cert, nil
+}
+
+// TLS wraps l to accept TLS connections using the cert certificate
+func TLS(l net.Listener, cert *Certificate) net.Listener {
+	return tls.NewListener(l, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: cert.GetCertificate,
+	})
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "othrys_http_requests_total",
+		Help: "Number of HTTP requests, by route, response format and status code.",
+	}, []string{"route", "format", "code"})
+	requestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "othrys_http_request_duration_seconds",
+		Help:    "Time spent serving the HTTP requests, by route and response format.",
+		Buckets: DefaultBuckets,
+	}, []string{"route", "format"})
+	eventsServed = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "othrys_events_served_total",
+		Help: "Number of events included in the responses, by route and format.",
+	}, []string{"route", "format"})
+)
+
+// formats maps the media types of the responses to the values of the format label
+var formats = map[string]string{
+	"text/calendar":             "ics",
+	"application/calendar+json": "jcal",
+	"application/calendar+xml":  "xcal",
+	"text/html":                 "html",
+	"text/plain":                "text",
+	"application/json":          "json",
+	"application/feed+json":     "jsonfeed",
+	"application/atom+xml":      "atom",
+	"application/rss+xml":       "rss",
+	"application/xml":           "xml",
+	"text/xml":                  "xml",
+}
+
+// Format returns the value of the format label for the contentType of a response
+func Format(contentType string) string {
+	if contentType == "" {
+		return "none"
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "other"
+	}
+	if f, ok := formats[mt]; ok {
+		return f
+	}
+	return "other"
+}
+
+type statsKey struct{}
+
+type requestStats struct {
+	events int
+}
+
+// CountEvents adds n to the number of events served in the response to r
+func CountEvents(r *http.Request, n int) {
+	if stats, ok := r.Context().Value(statsKey{}).(*requestStats); ok {
+		stats.events += n
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Route instruments the requests served by next under the name route.
+// Requests that already went through an instrumented route, like the saved feeds which are served by the other routes,
+// are only counted once, for the first one.
+func Route(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(statsKey{}).(*requestStats); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		stats := new(requestStats)
+		sw := &statusWriter{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), statsKey{}, stats)))
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		format := Format(sw.Header().Get("Content-Type"))
+		requests.WithLabelValues(route, format, strconv.Itoa(sw.status)).Inc()
+		requestDuration.WithLabelValues(route, format).Observe(time.Since(start).Seconds())
+		if stats.events > 0 {
+			eventsServed.WithLabelValues(route, format).Add(float64(stats.events))
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fetchStore struct {
+	fetches map[string]time.Time
+	err     error
+}
+
+func (f fetchStore) SaveFetch(string, time.Time) error {
+	return nil
+}
+
+func (f fetchStore) LoadFetches() (map[string]time.Time, error) {
+	return f.fetches, f.err
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, expected %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	Posted("test@example.com", "digest", nil)
+	Posted("test@example.com", "digest", errors.New("unreachable"))
+	Posted("test@example.com", "reminder", nil)
+
+	logged := make([]string, 0)
+	logFn := func(s string, args ...interface{}) { logged = append(logged, fmt.Sprintf(s, args...)) }
+	fetched := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name   string
+		st     fetchStore
+		want   []string
+		logged int
+	}{
+		{
+			name: "last fetch",
+			st:   fetchStore{fetches: map[string]time.Time{"liquid": fetched}},
+			want: []string{
+				`othrys_last_fetch_timestamp_seconds{provider="liquid"} 1.7e+09`,
+				`othrys_posts_total{account="test@example.com",kind="digest",outcome="success"} 1`,
+				`othrys_posts_total{account="test@example.com",kind="digest",outcome="error"} 1`,
+				`othrys_posts_total{account="test@example.com",kind="reminder",outcome="success"} 1`,
+			},
+		},
+		{
+			name: "failing last fetch",
+			st:   fetchStore{err: errors.New("locked")},
+			want: []string{
+				`othrys_posts_total{account="test@example.com",kind="digest",outcome="success"} 1`,
+			},
+			logged: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged = logged[:0]
+			LastFetch(tt.st, logFn)
+			body := scrape(t)
+			for _, line := range tt.want {
+				if !strings.Contains(body, line) {
+					t.Errorf("missing %s in:\n%s", line, body)
+				}
+			}
+			if tt.st.err != nil && strings.Contains(body, "othrys_last_fetch_timestamp_seconds{") {
+				t.Errorf("unexpected last fetch samples")
+			}
+			if len(logged) != tt.logged {
+				t.Errorf("logged %d errors, expected %d", len(logged), tt.logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var posts = factory.NewCounterVec(prometheus.CounterOpts{
+	Name: "othrys_posts_total",
+	Help: "Number of runs posting the events to an account, by account, kind of posts: digest or reminder, and outcome: success or error.",
+}, []string{"account", "kind", "outcome"})
+
+// Posted records the outcome of a run posting the kind of posts to the account
+func Posted(account, kind string, err error) {
+	if err != nil {
+		posts.WithLabelValues(account, kind, "error").Inc()
+		return
+	}
+	posts.WithLabelValues(account, kind, "success").Inc()
+}
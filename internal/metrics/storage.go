@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+var (
+	queryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "othrys_storage_query_duration_seconds",
+		Help:    "Time spent loading events from the storage, by operation.",
+		Buckets: DefaultBuckets,
+	}, []string{"operation"})
+	queryErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "othrys_storage_query_errors_total",
+		Help: "Number of failed storage queries, by operation.",
+	}, []string{"operation"})
+	lastFetchDesc = prometheus.NewDesc("othrys_last_fetch_timestamp_seconds",
+		"Unix time of the last successful fetch, by calendar provider.", []string{"provider"}, nil)
+	lastFetch = new(fetchCollector)
+)
+
+func init() {
+	registry.MustRegister(lastFetch)
+}
+
+func observeQuery(op string, start time.Time, err error) {
+	queryDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		queryErrors.WithLabelValues(op).Inc()
+	}
+}
+
+type loader struct {
+	st storage.Loader
+}
+
+type searcher struct {
+	loader
+	s storage.Searcher
+}
+
+// Loader wraps st to record the timings of its queries, the wrapper keeps implementing storage.Searcher if st does.
+// It always implements storage.Finder, as storage.FindEvent falls back to loading the events when st doesn't.
+func Loader(st storage.Loader) storage.Loader {
+	l := loader{st: st}
+	if s, ok := st.(storage.Searcher); ok {
+		return searcher{loader: l, s: s}
+	}
+	return l
+}
+
+func (l loader) LoadEvents(c storage.DateCursor, types ...string) (calendar.Events, error) {
+	start := time.Now()
+	events, err := l.st.LoadEvents(c, types...)
+	observeQuery("load_events", start, err)
+	return events, err
+}
+
+func (l loader) LoadEvent(typ string, date time.Time, id int64) calendar.Event {
+	start := time.Now()
+	ev := l.st.LoadEvent(typ, date, id)
+	observeQuery("load_event", start, nil)
+	return ev
+}
+
+func (l loader) FindEvent(typ string, id int64) (calendar.Event, error) {
+	start := time.Now()
+	ev, err := storage.FindEvent(l.st, typ, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		observeQuery("find_event", start, nil)
+	} else {
+		observeQuery("find_event", start, err)
+	}
+	return ev, err
+}
+
+func (s searcher) SearchEvents(q string, c storage.DateCursor, types ...string) (calendar.Events, error) {
+	start := time.Now()
+	events, err := s.s.SearchEvents(q, c, types...)
+	observeQuery("search_events", start, err)
+	return events, err
+}
+
+// fetchCollector loads the times of the last fetches every time the metrics are collected
+type fetchCollector struct {
+	m     sync.Mutex
+	st    storage.FetchStore
+	errFn func(string, ...interface{})
+}
+
+func (f *fetchCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastFetchDesc
+}
+
+// Collect skips the samples when the fetches can't be loaded, so the rest of the metrics still get served
+func (f *fetchCollector) Collect(ch chan<- prometheus.Metric) {
+	f.m.Lock()
+	st, errFn := f.st, f.errFn
+	f.m.Unlock()
+	if st == nil {
+		return
+	}
+	fetches, err := st.LoadFetches()
+	if err != nil {
+		errFn("unable to collect the last fetch times: %s", err)
+		return
+	}
+	for provider, t := range fetches {
+		ch <- prometheus.MustNewConstMetric(lastFetchDesc, prometheus.GaugeValue, float64(t.Unix()), provider)
+	}
+}
+
+// LastFetch exposes the times of the last successful fetch of each provider, as they are persisted in st.
+// The errors of loading them get reported to errFn.
+func LastFetch(st storage.FetchStore, errFn func(string, ...interface{})) {
+	lastFetch.m.Lock()
+	defer lastFetch.m.Unlock()
+	lastFetch.st = st
+	lastFetch.errFn = errFn
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// acceptedEncoding picks the encoding for the response from the Accept-Encoding header, preferring brotli over gzip
+func acceptedEncoding(r *http.Request) string {
+	accepted := make(map[string]float64)
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		q := 1.0
+		if val, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[strings.ToLower(name)] = q
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range []string{encodingBrotli, encodingGzip} {
+		if q, ok := accepted[enc]; ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	h := c.Header()
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		switch c.encoding {
+		case encodingBrotli:
+			c.enc = brotli.NewWriter(c.ResponseWriter)
+		case encodingGzip:
+			c.enc = gzip.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.enc == nil {
+		return c.ResponseWriter.Write(b)
+	}
+	return c.enc.Write(b)
+}
+
+func (c *compressWriter) Close() error {
+	if c.enc == nil {
+		return nil
+	}
+	return c.enc.Close()
+}
+
+// Compress encodes the responses of the next handler with brotli or gzip, depending on what the client accepts.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
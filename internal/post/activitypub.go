@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -33,6 +34,8 @@ import (
 
 const eventTitleTpl = `{{ if gt (len .Event.Category) 0}}{{.Event.Category}}: {{ end }}{{ .Event.Stage }}`
 const eventContentTpl = `{{ if gt (len .Event.Content) 0}}{{ .Event.Content | Markdown }}{{ end }}`
+const reminderContentTpl = `<p>Starting soon: {{ .Event | sanitize }}</p>
+{{- if gt (len .Event.Links) 0 }}<p>{{ range $link := .Event.Links }}<a href="{{ $link }}">{{ $link }}</a><br/>{{ end }}</p>{{ end }}`
 
 var (
 	defaultRenderOptions = render.Options{
@@ -63,6 +66,11 @@ var (
 			"commonTags": commonTags,
 		}).Parse(eventContentTpl))
 
+	reminderHTMLTemplate = template.Must(template.New("reminder-ToActivityPub").
+				Funcs(template.FuncMap{
+			"sanitize": sanitize,
+		}).Parse(reminderContentTpl))
+
 	titleHTMLTemplate = template.Must(template.New("daily-ToActivityPub-title").
 				Funcs(template.FuncMap{
 			"sanitize": sanitize,
@@ -210,6 +218,19 @@ func renderEventContent(rel calendar.Event, tags vocab.ItemCollection) (string,
 	return contBuff.String(), nil
 }
 
+// RenderEvent renders the title and the HTML content of the post for a single event
+func RenderEvent(ev calendar.Event) (string, string, error) {
+	title, err := renderEventTitle(ev)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := renderEventContent(ev, nil)
+	if err != nil {
+		return "", "", err
+	}
+	return title, content, nil
+}
+
 func loadTagsToEvent(rel calendar.Event, tags vocab.ItemCollection) (calendar.Event, vocab.ItemCollection) {
 	remainingTags := make(vocab.ItemCollection, 0)
 
@@ -311,17 +332,30 @@ func (cl *APClient) Valid(c *cli.Context) bool {
 	return true
 }
 
+func (cl *APClient) Accepts(typ string) bool {
+	return stringsContain(cl.Types, typ)
+}
+
 func (cl *APClient) Post() PosterFn {
 	return ToActivityPub(cl)
 }
 
-func ToActivityPub(cl *APClient) PosterFn {
+// apSession is the connection of the client to the ActivityPub server of its actor
+type apSession struct {
+	cl    *APClient
+	ap    *client.C
+	oauth *http.Client
+	tok   string
+	actor *vocab.Actor
+}
+
+func (cl *APClient) connect() (*apSession, error) {
 	logger := lw.Dev()
 
-	tok := cl.Tok.AccessToken
-	oauth := cl.Conf.Client(context.Background(), cl.Tok)
-	ap := client.New(
-		client.WithHTTPClient(oauth),
+	s := apSession{cl: cl, tok: cl.Tok.AccessToken}
+	s.oauth = cl.Conf.Client(context.Background(), cl.Tok)
+	s.ap = client.New(
+		client.WithHTTPClient(s.oauth),
 		client.WithLogger(logger),
 	)
 
@@ -331,108 +365,248 @@ func ToActivityPub(cl *APClient) PosterFn {
 	c, cancelFn := context.WithTimeout(context.Background(), time.Second)
 	defer cancelFn()
 
-	actor, err := ap.Actor(c, cl.ID)
+	var err error
+	if s.actor, err = s.ap.Actor(c, cl.ID); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// eventObject builds the object for the event, posted in the group of the gd day,
+// and returns it with the tags that don't exist on the server yet.
+func (s *apSession) eventObject(ctx context.Context, gd time.Time, event calendar.Event) (*vocab.Event, vocab.ItemCollection, error) {
+	var globalTags vocab.ItemCollection
+
+	ob := new(vocab.Event)
+	ob.Type = vocab.EventType
+
+	ob.StartTime = event.StartTime
+	ob.EndTime = event.StartTime.Add(event.Duration)
+	ob.Duration = event.Duration
+	ob.Updated = event.LastModified
+	if len(event.Links) > 0 {
+		urls := make(vocab.ItemCollection, len(event.Links))
+		for i, link := range event.Links {
+			urls[i] = vocab.IRI(link)
+		}
+		ob.URL = urls
+		if urls.Count() == 1 {
+			ob.URL = urls.First()
+		}
+	}
+
+	tags := append(defaultActivityPubTags(event.StartTime, s.actor.ID), apTags(event, s.actor.ID)...)
+	toCreateTags, err := removeExistingTags(ctx, s.ap, s.actor, tags)
+	if err != nil {
+		infFn("Error when loading tags from server: %s", err)
+	}
+
+	event, globalTags = loadTagsToEvent(event, tags)
+
+	content, err := renderEventContent(event, globalTags)
 	if err != nil {
-		errFn("%s, falling back to just printing", err)
-		return ToStdout
+		return nil, toCreateTags, fmt.Errorf("unable to render HTML object: %w", err)
 	}
 
-	if err := acceptFollows(actor, ap); err != nil {
+	if len(content) > 0 {
+		ob.Content = othrys.NL(content)
+	}
+	ob.Tag = tags
+
+	title, err := renderEventTitle(event)
+	if err == nil {
+		ob.Name = othrys.NL(title)
+	}
+	if source, err := renderPosts(gd, calendar.Events{event}); err == nil {
+		ob.Source = vocab.Source{
+			MediaType: "text/markdown",
+			Content:   othrys.NL(source),
+		}
+	}
+
+	ob.To = vocab.ItemCollection{vocab.PublicNS}
+	ob.CC = vocab.ItemCollection{vocab.Followers.Of(s.actor)}
+	return ob, toCreateTags, nil
+}
+
+// saveToken saves the credentials of the client if its OAuth2 token has been refreshed
+func (s *apSession) saveToken() {
+	tr, ok := s.oauth.Transport.(*oauth2.Transport)
+	if !ok {
+		return
+	}
+	var err error
+	cl := s.cl
+	cl.Tok, err = tr.Source.Token()
+	if cl.Tok.AccessToken == s.tok {
+		return
+	}
+	if err != nil {
+		errFn("Unable to refresh OAuth2 token: %s", err)
+		return
+	}
+	if err := saveCredentials(cl, filepath.Join(cl.Type, InstanceName(cl.ID.String()))); err != nil {
+		errFn("Unable to save new credentials for %s: %s", cl.ID, err)
+	}
+	infFn("Refreshed OAuth2 credentials %s", cl.ID)
+}
+
+// ToActivityPub returns the function posting the events to the outbox of the client's actor,
+// when the client can't connect, the function returns the error without posting anything.
+func ToActivityPub(cl *APClient) PosterFn {
+	s, err := cl.connect()
+	if err != nil {
+		return func(map[time.Time]calendar.Events) (Posted, error) {
+			return nil, err
+		}
+	}
+
+	if err := acceptFollows(s.actor, s.ap); err != nil {
 		errFn("failed to accept follows for actor: %s", err)
 	}
 
 	ctx := context.Background()
 
-	return func(group map[time.Time]calendar.Events) error {
+	return func(group map[time.Time]calendar.Events) (Posted, error) {
 		activities := make([]vocab.Activity, 0)
+		// activityEvents holds the events of the objects of each of the activities
+		activityEvents := make([]calendar.Events, 0)
 		for gd, events := range group {
 			object := make(vocab.ItemCollection, 0)
+			objectEvents := make(calendar.Events, 0)
 			for _, event := range events {
-				if !stringsContain(cl.Types, event.Type) {
+				if !cl.Accepts(event.Type) {
 					continue
 				}
-				var globalTags vocab.ItemCollection
-
-				ob := new(vocab.Event)
-				ob.Type = vocab.EventType
-
-				ob.StartTime = event.StartTime
-				ob.EndTime = event.StartTime.Add(event.Duration)
-				ob.Duration = event.Duration
-				ob.Updated = event.LastModified
-				if len(event.Links) > 0 {
-					urls := make(vocab.ItemCollection, len(event.Links))
-					for i, link := range event.Links {
-						urls[i] = vocab.IRI(link)
-					}
-					ob.URL = urls
-					if urls.Count() == 1 {
-						ob.URL = urls.First()
-					}
-				}
-
-				tags := append(defaultActivityPubTags(event.StartTime, actor.ID), apTags(event, actor.ID)...)
-				toCreateTags, err := removeExistingTags(ctx, ap, actor, tags)
-				if err != nil {
-					infFn("Error when loading tags from server: %s", err)
-				}
+				ob, toCreateTags, err := s.eventObject(ctx, gd, event)
 				if len(toCreateTags) > 0 {
-					activities = append(activities, othrys.WrapObjectInCreate(*actor, toCreateTags))
+					activities = append(activities, othrys.WrapObjectInCreate(*s.actor, toCreateTags))
+					activityEvents = append(activityEvents, nil)
 				}
-
-				event, globalTags = loadTagsToEvent(event, tags)
-
-				content, err := renderEventContent(event, globalTags)
 				if err != nil {
-					errFn("Unable to render HTML object: %s", err)
+					errFn("%s", err)
 					continue
 				}
-
-				if len(content) > 0 {
-					ob.Content = othrys.NL(content)
-				}
-				ob.Tag = tags
-
-				title, err := renderEventTitle(event)
-				if err == nil {
-					ob.Name = othrys.NL(title)
-				}
-				if source, err := renderPosts(gd, calendar.Events{event}); err == nil {
-					ob.Source = vocab.Source{
-						MediaType: "text/markdown",
-						Content:   othrys.NL(source),
-					}
-				}
-
-				ob.To = vocab.ItemCollection{vocab.PublicNS}
-				ob.CC = vocab.ItemCollection{vocab.Followers.Of(actor)}
-
 				object = append(object, ob)
+				objectEvents = append(objectEvents, event)
 			}
 			if len(object) > 0 {
-				activities = append(activities, othrys.WrapObjectInCreate(*actor, object))
+				activities = append(activities, othrys.WrapObjectInCreate(*s.actor, object))
+				activityEvents = append(activityEvents, objectEvents)
 			}
 		}
-		if len(activities) > 0 {
-			(OperationsBatch{AP: ap, Ops: activities}).Send()
+		posted := make(Posted)
+		errs := make([]error, 0)
+		for i, act := range activities {
+			created, err := sendActivity(ctx, s.ap, act)
+			if err != nil {
+				errFn("%+s", err)
+				errs = append(errs, err)
+				continue
+			}
+			events := activityEvents[i]
+			if len(created) == len(events) {
+				// the objects are created in the order they have been sent, one for each event
+				for j, ev := range events {
+					posted.Add(created[j].String(), ev)
+				}
+				continue
+			}
+			// without knowing which object holds which event, the objects can't be changed later
+			posted.Sent(events...)
 		}
+		s.saveToken()
+		return posted, errors.Join(errs...)
+	}
+}
 
-		if tr, ok := oauth.Transport.(*oauth2.Transport); ok {
-			cl.Tok, err = tr.Source.Token()
-			if cl.Tok.AccessToken == tok {
-				return nil
+// Update changes the objects that have been posted for the events, the objects whose event has been canceled get deleted.
+// Each of the objects is for a single event, the ones holding more than one get skipped,
+// as changing them for one of their events would overwrite the others.
+func (cl *APClient) Update(objects map[string]Object) (Updated, error) {
+	s, err := cl.connect()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	updated := make(Updated)
+	errs := make([]error, 0)
+	for _, id := range sortedIDs(objects) {
+		ob := objects[id]
+		events := ob.Events
+		if len(events) == 0 {
+			continue
+		}
+		if len(events) > 1 {
+			infFn("Skipping the update of %s, it holds %d events", id, len(events))
+			continue
+		}
+		event := events[0]
+		act := othrys.WrapObjectInDelete(*s.actor, vocab.IRI(id))
+		if !event.Canceled {
+			ob, toCreateTags, err := s.eventObject(ctx, ob.Day, event)
+			if len(toCreateTags) > 0 {
+				if _, err := sendActivity(ctx, s.ap, othrys.WrapObjectInCreate(*s.actor, toCreateTags)); err != nil {
+					errFn("%+s", err)
+				}
 			}
 			if err != nil {
-				errFn("Unable to refresh OAuth2 token: %s", err)
-			} else {
-				if err := saveCredentials(cl, filepath.Join(cl.Type, InstanceName(cl.ID.String()))); err != nil {
-					errFn("Unable to save new credentials for %s: %s", cl.ID, err)
-				}
-				infFn("Refreshed OAuth2 credentials %s", cl.ID)
+				errs = append(errs, fmt.Errorf("%s: %w", id, err))
+				continue
 			}
+			ob.ID = vocab.IRI(id)
+			act = othrys.WrapObjectInUpdate(*s.actor, ob)
 		}
-		return nil
+		if _, err := sendActivity(ctx, s.ap, act); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		infFn("%s object: %s", act.Type, id)
+		updated[id] = event.Canceled
 	}
+	s.saveToken()
+	return updated, errors.Join(errs...)
+}
+
+// Remind posts a note reminding of the event, as a reply to the replyTo object of the event when it's not empty
+func (cl *APClient) Remind(event calendar.Event, replyTo string) (string, error) {
+	if !stringsContain(cl.Types, event.Type) {
+		return "", nil
+	}
+	content := bytes.NewBuffer(nil)
+	if err := reminderHTMLTemplate.Execute(content, apContent{Event: event}); err != nil {
+		return "", fmt.Errorf("unable to render reminder: %w", err)
+	}
+	s, err := cl.connect()
+	if err != nil {
+		return "", err
+	}
+	defer s.saveToken()
+
+	ob := new(vocab.Object)
+	ob.Type = vocab.NoteType
+	ob.Content = othrys.NL(content.String())
+	if text, err := RenderReminder(event); err == nil {
+		ob.Source = vocab.Source{
+			MediaType: "text/plain",
+			Content:   othrys.NL(text),
+		}
+	}
+	if replyTo != "" {
+		ob.InReplyTo = vocab.IRI(replyTo)
+	}
+	ob.To = vocab.ItemCollection{vocab.PublicNS}
+	ob.CC = vocab.ItemCollection{vocab.Followers.Of(s.actor)}
+
+	created, err := sendActivity(context.Background(), s.ap, othrys.WrapObjectInCreate(*s.actor, ob))
+	if err != nil {
+		return "", err
+	}
+	if len(created) == 0 {
+		return "", errors.New("the server didn't return the created reminder")
+	}
+	return created[0].String(), nil
 }
 
 type APClient struct {
@@ -483,22 +657,32 @@ type OperationsBatch struct {
 
 func (b OperationsBatch) Send() {
 	for _, act := range b.Ops {
-		_, created, err := b.AP.ToOutbox(context.Background(), act)
-		if err != nil {
+		if _, err := sendActivity(context.Background(), b.AP, act); err != nil {
 			errFn("%+s", err)
-		} else {
-			if vocab.IsItemCollection(created) {
-				vocab.OnItemCollection(created, func(col *vocab.ItemCollection) error {
-					for _, created := range *col {
-						infFn("Created object: %s", created.GetLink())
-					}
-					return nil
-				})
-			} else {
+		}
+	}
+}
+
+// sendActivity submits the activity to the outbox, and returns the IDs of the objects it created
+func sendActivity(ctx context.Context, ap client.PubSubmitter, act vocab.Activity) ([]vocab.IRI, error) {
+	_, created, err := ap.ToOutbox(ctx, act)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]vocab.IRI, 0)
+	if vocab.IsItemCollection(created) {
+		vocab.OnItemCollection(created, func(col *vocab.ItemCollection) error {
+			for _, created := range *col {
 				infFn("Created object: %s", created.GetLink())
+				ids = append(ids, created.GetLink())
 			}
-		}
+			return nil
+		})
+	} else if !vocab.IsNil(created) {
+		infFn("Created object: %s", created.GetLink())
+		ids = append(ids, created.GetLink())
 	}
+	return ids, nil
 }
 
 func saveCredentials(cl any, path string) error {
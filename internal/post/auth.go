@@ -4,5 +4,7 @@ import "github.com/urfave/cli"
 
 type LoginCredentials interface {
 	Valid(c *cli.Context) bool
+	// Accepts returns true when the events of the calendar type typ get posted to the account
+	Accepts(typ string) bool
 	Post() PosterFn
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -19,7 +20,7 @@ import (
 const maxPostSize = 500
 const mastodonTitleTpl = `Events for {{ .Format "Monday, 02 Jan 2006" -}}`
 const mastodonContentTpl = `{{- range $event := .Events }}
-{{ $event | sanitize }} {{ renderTags $event.TagNames "#" }}
+{{ if $event.Canceled }}Canceled: {{ end }}{{ $event | sanitize }} {{ renderTags $event.TagNames "#" }}
 {{ end }}
 #{{ .Date.Month.String | lower }} {{range $typ := .Types }} #{{ $typ}}{{ end }} #esports #calendar`
 
@@ -103,6 +104,7 @@ func (c postContent) Tags() []string {
 
 type postModel struct {
 	title, content string
+	events         calendar.Events
 }
 
 func renderTitle(gd time.Time, rel calendar.Events) (string, error) {
@@ -123,9 +125,49 @@ func renderPosts(d time.Time, rel calendar.Events) (string, error) {
 	return contBuff.String(), nil
 }
 
+// RenderDigest renders the title and the text content of the daily post for the events of date
+func RenderDigest(date time.Time, events calendar.Events) (string, string, error) {
+	// the tags get rewritten in place by the template, so we work on copies
+	rel := make(calendar.Events, len(events))
+	for i, ev := range events {
+		ev.TagNames = append([]string(nil), ev.TagNames...)
+		rel[i] = ev
+	}
+	title, err := renderTitle(date, rel)
+	if err != nil {
+		return "", "", err
+	}
+	content, err := renderPosts(date, rel)
+	if err != nil {
+		return "", "", err
+	}
+	return title, content, nil
+}
+
 const unlisted = "unlisted"
 
-type PosterFn func(events map[time.Time]calendar.Events) error
+// Posted maps the identities of the posted events to the IDs of the remote objects, or statuses, created for them
+type Posted map[string][]string
+
+// Add records id as created for all the events
+func (p Posted) Add(id string, events ...calendar.Event) {
+	for _, ev := range events {
+		p[calendar.EventID(ev)] = append(p[calendar.EventID(ev)], id)
+	}
+}
+
+// Sent records the events as posted, without the IDs of the remote objects holding them
+func (p Posted) Sent(events ...calendar.Event) {
+	for _, ev := range events {
+		if _, ok := p[calendar.EventID(ev)]; !ok {
+			p[calendar.EventID(ev)] = nil
+		}
+	}
+}
+
+// PosterFn posts the events grouped by day, and returns the ones that have been posted,
+// which, when an error occurs, are the ones posted before it.
+type PosterFn func(events map[time.Time]calendar.Events) (Posted, error)
 
 type MastodonClient struct {
 	*madon.Client
@@ -195,6 +237,10 @@ func (m *MastodonClient) Valid(c *cli.Context) bool {
 	return !typeIsAllowed(types, typeMastodon) || !shouldPostToInstance(instances, m.InstanceURL)
 }
 
+func (m *MastodonClient) Accepts(typ string) bool {
+	return stringsContain(m.Types, typ)
+}
+
 func (m *MastodonClient) Post() PosterFn {
 	return ToMastodon(m)
 }
@@ -203,16 +249,20 @@ func ToMastodon(client *MastodonClient) PosterFn {
 	if client == nil {
 		return ToStdout
 	}
-	return func(group map[time.Time]calendar.Events) error {
+	return func(group map[time.Time]calendar.Events) (Posted, error) {
 		var inReplyTo int64 = 0
 		posts := make([]postModel, 0)
 
-		for d, events := range group {
-			for i, event := range events {
-				if !stringsContain(client.Types, event.Type) {
-					events = append(events[:i], events[i+1:]...)
+		for d, all := range group {
+			events := make(calendar.Events, 0, len(all))
+			for _, event := range all {
+				if client.Accepts(event.Type) {
+					events = append(events, event)
 				}
 			}
+			if len(events) == 0 {
+				continue
+			}
 
 			title, err := renderTitle(d, events)
 			if err != nil {
@@ -232,15 +282,17 @@ func ToMastodon(client *MastodonClient) PosterFn {
 
 			for {
 				var content string
-				_, events = cleaveSlice(events, cleaveFn(d, &content))
+				var chunk calendar.Events
+				chunk, events = cleaveSlice(events, cleaveFn(d, &content))
 
-				posts = append(posts, postModel{title: title, content: content})
+				posts = append(posts, postModel{title: title, content: content, events: chunk})
 				if events == nil {
 					break
 				}
 			}
 		}
 
+		posted := make(Posted)
 		for i, model := range posts {
 			if len(posts) > 1 {
 				model.title = fmt.Sprintf("%s: %d/%d", model.title, i+1, len(posts))
@@ -250,13 +302,14 @@ func ToMastodon(client *MastodonClient) PosterFn {
 			}
 			s, err := client.PostStatus(model.content, inReplyTo, nil, len(model.title) > 0, model.title, unlisted)
 			if err != nil {
-				return fmt.Errorf("%s: %w", client.InstanceURL, err)
+				return posted, fmt.Errorf("%s: %w", client.InstanceURL, err)
 			} else {
 				infFn("Post at: %s", s.URI)
 			}
+			posted.Add(strconv.FormatInt(s.ID, 10), model.events...)
 		}
 
-		return nil
+		return posted, nil
 	}
 }
 
@@ -9,7 +9,7 @@ import (
 
 const dateFmt = "2006-01-02 15:04"
 
-func ToStdout(groups map[time.Time]calendar.Events) error {
+func ToStdout(groups map[time.Time]calendar.Events) (Posted, error) {
 	f := log.Flags()
 	log.SetFlags(0)
 	for date, releases := range groups {
@@ -19,5 +19,5 @@ func ToStdout(groups map[time.Time]calendar.Events) error {
 		}
 	}
 	log.SetFlags(f)
-	return nil
+	return nil, nil
 }
@@ -0,0 +1,69 @@
+package post
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/template"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+const mastodonReminderTpl = `Starting soon: {{ .Event | sanitize }} {{ renderTags .Event.TagNames "#" }}
+{{- range $link := .Event.Links }}
+{{ $link }}
+{{- end }}
+
+#{{ .Event.Type }} #esports`
+
+var reminderTemplate = template.Must(template.New("reminder-PostToMastodon").
+	Funcs(template.FuncMap{
+		"sanitize":   sanitize,
+		"renderTags": renderTagsText,
+	}).Parse(mastodonReminderTpl))
+
+type reminderContent struct {
+	Event calendar.Event
+}
+
+// Reminder is implemented by the credentials of the accounts that can post reminders for the events about to start
+type Reminder interface {
+	// Remind posts the reminder for the event, as a reply to the replyTo remote object when it's not empty,
+	// and returns the ID of the new remote object, which is empty when the event is not posted to the account
+	Remind(event calendar.Event, replyTo string) (string, error)
+}
+
+// RenderReminder renders the text content of the reminder for the event
+func RenderReminder(event calendar.Event) (string, error) {
+	// the tags get rewritten in place by the template, so we work on a copy
+	event.TagNames = append([]string(nil), event.TagNames...)
+	buf := bytes.NewBuffer(nil)
+	if err := reminderTemplate.Execute(buf, reminderContent{Event: event}); err != nil {
+		return "", fmt.Errorf("unable to render reminder: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Remind posts the reminder for the event as a reply to the replyTo status of the daily post
+func (m *MastodonClient) Remind(event calendar.Event, replyTo string) (string, error) {
+	if !stringsContain(m.Types, event.Type) {
+		return "", nil
+	}
+	content, err := RenderReminder(event)
+	if err != nil {
+		return "", err
+	}
+	var inReplyTo int64
+	if replyTo != "" {
+		if inReplyTo, err = strconv.ParseInt(replyTo, 10, 64); err != nil {
+			errFn("Invalid status id %q to reply to, posting the reminder on its own", replyTo)
+			inReplyTo = 0
+		}
+	}
+	s, err := m.PostStatus(content, inReplyTo, nil, false, "", unlisted)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", m.InstanceURL, err)
+	}
+	infFn("Reminder at: %s", s.URI)
+	return strconv.FormatInt(s.ID, 10), nil
+}
@@ -0,0 +1,56 @@
+package post
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of posting a kind of posts for the events of a period to an account
+type Result struct {
+	Account    string    `json:"account"`
+	Kind       string    `json:"kind"`
+	Job        string    `json:"job"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Period     time.Time `json:"period"`
+	Resolution string    `json:"resolution"`
+	Calendars  []string  `json:"calendars"`
+	// Events is the number of events posted, Skipped the number of the ones that had already been posted
+	Events  int    `json:"events"`
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Status keeps the last Result of each account and kind
+type Status struct {
+	m       sync.RWMutex
+	results map[string]Result
+}
+
+// Record saves r as the last result of its account and kind
+func (s *Status) Record(r Result) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.results == nil {
+		s.results = make(map[string]Result)
+	}
+	s.results[r.Account+"/"+r.Kind] = r
+}
+
+// Results returns the last results of all the accounts, sorted by account and kind
+func (s *Status) Results() []Result {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	results := make([]Result, 0, len(s.results))
+	for _, r := range s.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Account != results[j].Account {
+			return results[i].Account < results[j].Account
+		}
+		return results[i].Kind < results[j].Kind
+	})
+	return results
+}
@@ -0,0 +1,136 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// Updated maps the IDs of the remote objects that have been changed to whether they have been deleted
+type Updated map[string]bool
+
+// Object is a remote object, or status, that has been posted, with the events it holds
+type Object struct {
+	// Day is the day the events have been posted under
+	Day    time.Time
+	Events calendar.Events
+}
+
+// Updater is implemented by the credentials of the accounts whose posts can be changed after they have been posted
+type Updater interface {
+	// Update changes the remote objects, mapped by their IDs, to show the current version of their events,
+	// the objects for canceled events get deleted
+	Update(objects map[string]Object) (Updated, error)
+}
+
+func sortedIDs(objects map[string]Object) []string {
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func allCanceled(events calendar.Events) bool {
+	for _, ev := range events {
+		if !ev.Canceled {
+			return false
+		}
+	}
+	return true
+}
+
+// Update edits the statuses to show the current version of their events,
+// the statuses whose events have all been canceled get deleted.
+func (m *MastodonClient) Update(objects map[string]Object) (Updated, error) {
+	updated := make(Updated)
+	errs := make([]error, 0)
+	for _, id := range sortedIDs(objects) {
+		ob := objects[id]
+		if len(ob.Events) == 0 {
+			continue
+		}
+		statusID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid status id %q", id))
+			continue
+		}
+		if allCanceled(ob.Events) {
+			if err := m.DeleteStatus(statusID); err != nil {
+				errs = append(errs, fmt.Errorf("%s: unable to delete status %s: %w", m.InstanceURL, id, err))
+				continue
+			}
+			infFn("Deleted status: %s", id)
+			updated[id] = true
+			continue
+		}
+		title, content, err := m.renderEdit(statusID, ob)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: unable to edit status %s: %w", m.InstanceURL, id, err))
+			continue
+		}
+		if err := m.editStatus(id, content, title); err != nil {
+			errs = append(errs, fmt.Errorf("%s: unable to edit status %s: %w", m.InstanceURL, id, err))
+			continue
+		}
+		infFn("Edited status: %s", id)
+		updated[id] = false
+	}
+	return updated, errors.Join(errs...)
+}
+
+// partSuffix matches the part number that ToMastodon adds to the titles of the digests split in several statuses
+var partSuffix = regexp.MustCompile(`: \d+/\d+$`)
+
+// renderEdit renders the title and the content of the status for the events of the object,
+// keeping the part number of its current title, and the content under the size limit used when posting.
+func (m *MastodonClient) renderEdit(statusID int64, ob Object) (string, string, error) {
+	s, err := m.GetStatus(statusID)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to load status: %w", err)
+	}
+	title, content, err := RenderDigest(ob.Day, ob.Events)
+	if err != nil {
+		return "", "", err
+	}
+	if len(content) >= maxPostSize {
+		return "", "", fmt.Errorf("the content is %d characters long, more than the %d a status can hold", len(content), maxPostSize)
+	}
+	return title + partSuffix.FindString(s.SpoilerText), content, nil
+}
+
+// editStatus replaces the text of the status, the library we use predates the edit endpoint of the Mastodon API
+func (m *MastodonClient) editStatus(id, text, spoilerText string) error {
+	form := url.Values{}
+	form.Set("status", text)
+	if spoilerText != "" {
+		form.Set("spoiler_text", spoilerText)
+		form.Set("sensitive", "true")
+	}
+	req, err := http.NewRequest(http.MethodPut, m.APIBase+"/statuses/"+url.PathEscape(id), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if m.UserToken != nil {
+		req.Header.Set("Authorization", "Bearer "+m.UserToken.AccessToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package post
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/McKael/madon"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// testInstance serves the statuses of a Mastodon instance, and records the edits and deletions it receives
+type testInstance struct {
+	spoiler string
+	edits   map[string]url.Values
+	deleted []string
+}
+
+func (i *testInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/statuses/")
+	switch r.Method {
+	case http.MethodGet:
+		fmt.Fprintf(w, `{"id":"%s","spoiler_text":%q}`, id, i.spoiler)
+	case http.MethodPut:
+		_ = r.ParseForm()
+		i.edits[id] = r.PostForm
+		fmt.Fprintf(w, `{"id":"%s"}`, id)
+	case http.MethodDelete:
+		i.deleted = append(i.deleted, id)
+		fmt.Fprint(w, `{}`)
+	}
+}
+
+func TestMastodonUpdate(t *testing.T) {
+	day := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	event := func(id int64, start time.Time) calendar.Event {
+		return calendar.Event{CalID: id, Type: "sc2", StartTime: start, Duration: time.Hour, Category: "Test Cup", Stage: "Group A"}
+	}
+	moved := event(1, day.Add(34*time.Hour))
+	canceled := event(2, day.Add(10*time.Hour))
+	canceled.Canceled = true
+	many := make(calendar.Events, 0)
+	for i := int64(1); i <= 20; i++ {
+		many = append(many, event(i, day.Add(time.Duration(i)*time.Minute)))
+	}
+
+	tests := []struct {
+		name      string
+		spoiler   string
+		object    Object
+		wantTitle string
+		deleted   bool
+		err       bool
+	}{
+		{
+			name:      "keeps the day it was posted under",
+			spoiler:   "Events for Monday, 04 Mar 2024",
+			object:    Object{Day: day, Events: calendar.Events{moved}},
+			wantTitle: "Events for Monday, 04 Mar 2024",
+		},
+		{
+			name:      "keeps the part of the digest",
+			spoiler:   "Events for Monday, 04 Mar 2024: 2/3",
+			object:    Object{Day: day, Events: calendar.Events{moved}},
+			wantTitle: "Events for Monday, 04 Mar 2024: 2/3",
+		},
+		{
+			name:    "deletes the canceled",
+			object:  Object{Day: day, Events: calendar.Events{canceled}},
+			deleted: true,
+		},
+		{
+			name:   "too long",
+			object: Object{Day: day, Events: many},
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := &testInstance{spoiler: tt.spoiler, edits: make(map[string]url.Values)}
+			srv := httptest.NewServer(inst)
+			defer srv.Close()
+			m := &MastodonClient{Client: &madon.Client{InstanceURL: srv.URL, APIBase: srv.URL + "/api/v1"}}
+
+			updated, err := m.Update(map[string]Object{"12": tt.object})
+			if (err != nil) != tt.err {
+				t.Fatalf("Update returned error %v, expected error %t", err, tt.err)
+			}
+			if tt.err {
+				if len(updated) > 0 || len(inst.edits) > 0 {
+					t.Errorf("edited the status %v, expected it unchanged", inst.edits)
+				}
+				return
+			}
+			if deleted, ok := updated["12"]; !ok || deleted != tt.deleted {
+				t.Errorf("updated %v, expected the status deleted %t", updated, tt.deleted)
+			}
+			if tt.deleted {
+				if len(inst.deleted) != 1 || len(inst.edits) > 0 {
+					t.Errorf("deleted %v and edited %v, expected only the deletion", inst.deleted, inst.edits)
+				}
+				return
+			}
+			edit, ok := inst.edits["12"]
+			if !ok {
+				t.Fatalf("the status hasn't been edited")
+			}
+			if title := edit.Get("spoiler_text"); title != tt.wantTitle {
+				t.Errorf("title %q, expected %q", title, tt.wantTitle)
+			}
+			if content := edit.Get("status"); len(content) >= maxPostSize || !strings.Contains(content, "#march") {
+				t.Errorf("content %q, expected the events of the day under %d characters", content, maxPostSize)
+			}
+		})
+	}
+}
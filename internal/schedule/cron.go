@@ -0,0 +1,205 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next time a job needs to run after t
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every runs a job at a fixed interval
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// Cron is a schedule in the format of the crontab(5) lines: minute, hour, day of month, month and day of week,
+// the times are matched in UTC.
+type Cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+func (c Cron) String() string {
+	return c.expr
+}
+
+type field struct {
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField    = field{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a crontab(5) expression, one of the @yearly, @monthly, @weekly, @daily and @hourly descriptors,
+// or an "@every <duration>" interval, eg: @every 5m.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every < time.Minute {
+			return nil, fmt.Errorf("invalid interval %q, it needs to be at least one minute", d)
+		}
+		return Every(every), nil
+	}
+	spec := expr
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		spec = d
+	}
+	pieces := strings.Fields(spec)
+	if len(pieces) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q, it needs five fields: minute, hour, day of month, month and day of week", expr)
+	}
+	c := Cron{expr: expr}
+	var err error
+	if c.minute, err = minuteField.parse(pieces[0]); err != nil {
+		return nil, fmt.Errorf("invalid minute in schedule %q: %w", expr, err)
+	}
+	if c.hour, err = hourField.parse(pieces[1]); err != nil {
+		return nil, fmt.Errorf("invalid hour in schedule %q: %w", expr, err)
+	}
+	if c.dom, err = domField.parse(pieces[2]); err != nil {
+		return nil, fmt.Errorf("invalid day of month in schedule %q: %w", expr, err)
+	}
+	if c.month, err = monthField.parse(pieces[3]); err != nil {
+		return nil, fmt.Errorf("invalid month in schedule %q: %w", expr, err)
+	}
+	if c.dow, err = dowField.parse(pieces[4]); err != nil {
+		return nil, fmt.Errorf("invalid day of week in schedule %q: %w", expr, err)
+	}
+	// Sunday can be written both as 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domRestricted = pieces[2] != "*"
+	c.dowRestricted = pieces[4] != "*"
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q, it never matches", expr)
+	}
+	return c, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, n := range f.names {
+		if strings.ToLower(s) == n {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q is not between %d and %d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// parse returns the bit set of the values matched by the comma separated list of ranges in s
+func (f field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			from, to, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(to); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// maxSearch bounds the search for the next matching time, for expressions that can never match, like Feb 30th
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first time after t that matches the expression, or the zero time if there's none
+func (c Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(c.hour, t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Hours is an interval of the hours of each day, in UTC, which can go over midnight, eg: 23:00-07:00
+type Hours struct {
+	from, to time.Duration
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, it needs to be in the format HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseHours parses an interval of hours in the format HH:MM-HH:MM
+func ParseHours(s string) (Hours, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return Hours{}, fmt.Errorf("invalid hours %q, they need to be in the format HH:MM-HH:MM", s)
+	}
+	h := Hours{}
+	var err error
+	if h.from, err = parseClock(from); err != nil {
+		return Hours{}, err
+	}
+	if h.to, err = parseClock(to); err != nil {
+		return Hours{}, err
+	}
+	if h.from == h.to {
+		return Hours{}, fmt.Errorf("invalid hours %q, they can't start and end at the same time", s)
+	}
+	return h, nil
+}
+
+// Contains returns whether the time of day of t is in the interval, the start is included and the end is not
+func (h Hours) Contains(t time.Time) bool {
+	t = t.UTC()
+	d := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	if h.from < h.to {
+		return d >= h.from && d < h.to
+	}
+	return d >= h.from || d < h.to
+}
+
+func (h Hours) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(h.from) + "-" + clock(h.to)
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoursContains(t *testing.T) {
+	day := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		hours string
+		at    time.Duration
+		want  bool
+	}{
+		{hours: "09:00-17:00", at: 9 * time.Hour, want: true},
+		{hours: "09:00-17:00", at: 16*time.Hour + 59*time.Minute, want: true},
+		{hours: "09:00-17:00", at: 17 * time.Hour, want: false},
+		{hours: "09:00-17:00", at: 8 * time.Hour, want: false},
+		{hours: "23:00-07:00", at: 22*time.Hour + 59*time.Minute, want: false},
+		{hours: "23:00-07:00", at: 23 * time.Hour, want: true},
+		{hours: "23:00-07:00", at: 0, want: true},
+		{hours: "23:00-07:00", at: 6*time.Hour + 59*time.Minute, want: true},
+		{hours: "23:00-07:00", at: 7 * time.Hour, want: false},
+		{hours: "23:00-07:00", at: 12 * time.Hour, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hours+"/"+tt.at.String(), func(t *testing.T) {
+			h, err := ParseHours(tt.hours)
+			if err != nil {
+				t.Fatalf("ParseHours returned error: %s", err)
+			}
+			if got := h.Contains(day.Add(tt.at)); got != tt.want {
+				t.Errorf("Contains returned %t, expected %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHours(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{in: "23:00-07:00", ok: true},
+		{in: " 09:30 - 17:45 ", ok: true},
+		{in: "07:00-07:00", ok: false},
+		{in: "23:00", ok: false},
+		{in: "25:00-07:00", ok: false},
+		{in: "11pm-7am", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			h, err := ParseHours(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v, expected valid %t", err, tt.ok)
+			}
+			if tt.ok {
+				if again, err := ParseHours(h.String()); err != nil || again != h {
+					t.Errorf("%s doesn't parse back to the same hours", h)
+				}
+			}
+		})
+	}
+}
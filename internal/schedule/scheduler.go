@@ -0,0 +1,302 @@
+// Package schedule runs the periodic jobs of the server, like fetching the calendars and posting the events.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrRunning    = errors.New("job is already running")
+)
+
+// Job is a named function that runs on a schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(context.Context) error
+}
+
+// Run is the outcome of the last run of a job, as reported by the admin endpoint
+type Run struct {
+	Trigger  string    `json:"trigger"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Status is the state of a job, as reported by the admin endpoint
+type Status struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Running  bool      `json:"running"`
+	Next     time.Time `json:"next,omitempty"`
+	Last     *Run      `json:"last,omitempty"`
+}
+
+type job struct {
+	Job
+	m       sync.Mutex
+	running bool
+	next    time.Time
+	// skipped is the time of the last scheduled run that has been skipped because the job was still running
+	skipped time.Time
+	last    storage.JobRun
+}
+
+type logFn func(string, ...interface{})
+
+// Scheduler runs each of its jobs on their schedule, a job never runs in parallel with itself
+type Scheduler struct {
+	jobs   map[string]*job
+	jitter time.Duration
+	st     storage.JobStore
+	errFn  logFn
+	infFn  logFn
+
+	// m guards the context of the jobs, and the additions to wg against Stop waiting for it
+	m       sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type OptionFn func(*Scheduler)
+
+// WithJitter delays every scheduled run by a random duration up to d,
+// so the jobs of multiple instances don't hit the sources at the same time
+func WithJitter(d time.Duration) OptionFn {
+	return func(s *Scheduler) {
+		if d > 0 {
+			s.jitter = d
+		}
+	}
+}
+
+// WithStore persists the state of the last run of each job in st,
+// it's used to compute the next run after a restart, and to catch up on the runs missed while stopped
+func WithStore(st storage.JobStore) OptionFn {
+	return func(s *Scheduler) {
+		s.st = st
+	}
+}
+
+// WithLogger sets the functions for logging the runs of the jobs and their errors
+func WithLogger(infFn, errFn logFn) OptionFn {
+	return func(s *Scheduler) {
+		s.infFn = infFn
+		s.errFn = errFn
+	}
+}
+
+// New returns a scheduler for the jobs, the names of the jobs need to be unique
+func New(jobs []Job, opts ...OptionFn) (*Scheduler, error) {
+	s := &Scheduler{
+		jobs:  make(map[string]*job, len(jobs)),
+		infFn: func(string, ...interface{}) {},
+		errFn: func(string, ...interface{}) {},
+	}
+	for _, fn := range opts {
+		fn(s)
+	}
+	for _, j := range jobs {
+		if _, ok := s.jobs[j.Name]; ok {
+			return nil, fmt.Errorf("duplicate job %q", j.Name)
+		}
+		s.jobs[j.Name] = &job{Job: j}
+	}
+	if s.st != nil {
+		runs, err := s.st.LoadJobRuns()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the state of the jobs: %w", err)
+		}
+		for name, run := range runs {
+			if j, ok := s.jobs[name]; ok {
+				j.last = run
+			}
+		}
+	}
+	return s, nil
+}
+
+// Start runs the jobs on their schedules until Stop is called, a scheduler that has been stopped can't be started again
+func (s *Scheduler) Start() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.ctx != nil || s.stopped {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(s.ctx, j)
+	}
+}
+
+// Stop cancels the context of the running jobs and waits for them to return, or for ctx to expire
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.m.Lock()
+	s.stopped = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.m.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nextRun returns the time of the next scheduled run of j, runs that have been missed get scheduled right away
+func (s *Scheduler) nextRun(j *job, now time.Time) time.Time {
+	j.m.Lock()
+	defer j.m.Unlock()
+	base := j.last.Started
+	if j.skipped.After(base) {
+		base = j.skipped
+	}
+	if base.IsZero() {
+		base = now
+	}
+	next := j.Schedule.Next(base)
+	if next.IsZero() {
+		return next
+	}
+	if next.Before(now) {
+		next = now
+	}
+	if s.jitter > 0 {
+		next = next.Add(rand.N(s.jitter))
+	}
+	j.next = next
+	return next
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+	for {
+		next := s.nextRun(j, time.Now().UTC())
+		if next.IsZero() {
+			s.errFn("Job %s will never run with schedule %s", j.Name, j.Schedule)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !s.start(j) {
+			s.infFn("Skipping the scheduled run of %s, the previous one is still running", j.Name)
+			j.m.Lock()
+			j.skipped = next
+			j.m.Unlock()
+			continue
+		}
+		s.run(ctx, j, TriggerSchedule)
+	}
+}
+
+// start marks j as running, it returns false if it already was
+func (s *Scheduler) start(j *job) bool {
+	j.m.Lock()
+	defer j.m.Unlock()
+	if j.running {
+		return false
+	}
+	j.running = true
+	return true
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job, trigger string) {
+	run := storage.JobRun{Job: j.Name, Trigger: trigger, Started: time.Now().UTC()}
+	s.infFn("Running %s, triggered by %s", j.Name, trigger)
+	err := j.Run(ctx)
+	run.Finished = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+		s.errFn("Job %s failed: %s", j.Name, err)
+	}
+
+	j.m.Lock()
+	j.running = false
+	j.last = run
+	j.m.Unlock()
+	if s.st != nil {
+		if err := s.st.SaveJobRun(run); err != nil {
+			s.errFn("Unable to save the state of job %s: %s", j.Name, err)
+		}
+	}
+}
+
+// Trigger starts a run of the job named name outside its schedule,
+// it returns ErrRunning if the job is already running.
+func (s *Scheduler) Trigger(name string) error {
+	j, ok := s.jobs[name]
+	if !ok {
+		return ErrUnknownJob
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.ctx == nil || s.stopped {
+		return errors.New("the scheduler is not running")
+	}
+	if !s.start(j) {
+		return ErrRunning
+	}
+	s.wg.Add(1)
+	go func(ctx context.Context) {
+		defer s.wg.Done()
+		s.run(ctx, j, TriggerManual)
+	}(s.ctx)
+	return nil
+}
+
+// Status returns the state of the jobs, sorted by name
+func (s *Scheduler) Status() []Status {
+	result := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.m.Lock()
+		st := Status{
+			Name:     j.Name,
+			Schedule: fmt.Sprint(j.Schedule),
+			Running:  j.running,
+			Next:     j.next,
+		}
+		if !j.last.Started.IsZero() {
+			st.Last = &Run{
+				Trigger:  j.last.Trigger,
+				Started:  j.last.Started,
+				Finished: j.last.Finished,
+				Error:    j.last.Error,
+			}
+		}
+		j.m.Unlock()
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, k int) bool { return result[i].Name < result[k].Name })
+	return result
+}
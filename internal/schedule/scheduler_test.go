@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTriggerWhileStarting(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	job := Job{
+		Name:     "test",
+		Schedule: Every(time.Hour),
+		Run: func(ctx context.Context) error {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	s, err := New([]Job{job})
+	if err != nil {
+		t.Fatalf("New returned error: %s", err)
+	}
+	if err = s.Trigger("test"); err == nil {
+		t.Errorf("Trigger succeeded before the scheduler was started")
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.Start()
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.Trigger("test")
+		}
+	}()
+	wg.Wait()
+
+	if err = s.Trigger("test"); err != nil && err != ErrRunning {
+		t.Errorf("Trigger returned error %v, expected nil or %v", err, ErrRunning)
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Errorf("the triggered job didn't run")
+	}
+	if err = s.Stop(context.Background()); err != nil {
+		t.Errorf("Stop returned error: %s", err)
+	}
+	if err = s.Trigger("test"); err == nil {
+		t.Errorf("Trigger succeeded after the scheduler was stopped")
+	}
+	s.Start()
+	if err = s.Trigger("test"); err == nil {
+		t.Errorf("Trigger succeeded after restarting a stopped scheduler")
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	job := Job{
+		Name:     "stuck",
+		Schedule: Every(time.Hour),
+		Run: func(context.Context) error {
+			// ignores the cancellation, like a job stuck on a request without a timeout
+			<-release
+			return nil
+		},
+	}
+	s, err := New([]Job{job})
+	if err != nil {
+		t.Fatalf("New returned error: %s", err)
+	}
+	s.Start()
+	if err = s.Trigger("stuck"); err != nil {
+		t.Fatalf("Trigger returned error: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = s.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Stop took %s, expected it to give up after the timeout", took)
+	}
+}
@@ -0,0 +1,260 @@
+package savedfeed
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mariusor/render"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/web"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// listParams are the form fields that can hold multiple comma separated values
+var listParams = []string{"category", "stage", "participant"}
+
+type handler struct {
+	st       storage.SavedFeedStore
+	next     http.Handler
+	ren      *render.Render
+	maxFeeds int
+	limit    *limiter
+	// m serializes the creations, so the number of feeds can't go over maxFeeds
+	m sync.Mutex
+}
+
+type OptionFn func(*handler)
+
+// WithMaxFeeds sets the number of saved feeds after which the form stops creating new ones
+func WithMaxFeeds(n int) OptionFn {
+	return func(h *handler) {
+		if n > 0 {
+			h.maxFeeds = n
+		}
+	}
+}
+
+// WithCreateLimit sets the number of feeds each client can create from the form in the interval per
+func WithCreateLimit(n int, per time.Duration) OptionFn {
+	return func(h *handler) {
+		if n > 0 && per > 0 {
+			h.limit = newLimiter(n, per)
+		}
+	}
+}
+
+// NewHandler returns the handler for the saved feeds, which get served by rewriting the requests to the routes of next,
+// and for the form that creates them.
+func NewHandler(st storage.SavedFeedStore, next http.Handler, opts ...OptionFn) *handler {
+	h := &handler{
+		st:       st,
+		next:     next,
+		maxFeeds: DefaultMaxFeeds,
+		limit:    newLimiter(DefaultCreateLimit, DefaultCreateInterval),
+		ren: render.New(render.Options{
+			Directory:                 "templates",
+			FileSystem:                templateFS,
+			Layout:                    "main",
+			Extensions:                []string{".html"},
+			Funcs:                     []template.FuncMap{{"join": strings.Join}},
+			Delims:                    render.Delims{Left: "{{", Right: "}}"},
+			Charset:                   "UTF-8",
+			HTMLContentType:           "text/html",
+			DisableHTTPErrorRendering: true,
+		}),
+	}
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+// privateWriter makes sure the responses for the secret URLs don't get stored in shared caches
+type privateWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (p *privateWriter) WriteHeader(status int) {
+	if !p.wroteHeader {
+		h := p.Header()
+		if cc := h.Get("Cache-Control"); cc != "" {
+			h.Set("Cache-Control", strings.Replace(cc, "public", "private", 1))
+		}
+		h.Set("X-Robots-Tag", "noindex")
+		p.wroteHeader = true
+	}
+	p.ResponseWriter.WriteHeader(status)
+}
+
+func (p *privateWriter) Write(b []byte) (int, error) {
+	if !p.wroteHeader {
+		p.WriteHeader(http.StatusOK)
+	}
+	return p.ResponseWriter.Write(b)
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rel := strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/")
+	if rel == "" {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.form(w, formModel{Values: make(url.Values)})
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	ext := path.Ext(rel)
+	token := strings.TrimSuffix(rel, ext)
+	if strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := h.st.LoadFeed(token)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	u, ok := target(f, ext)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	req := r.Clone(r.Context())
+	req.URL = u
+	req.RequestURI = u.RequestURI()
+	h.next.ServeHTTP(&privateWriter{ResponseWriter: w}, req)
+}
+
+type option struct {
+	ID, Label string
+	Checked   bool
+}
+
+type link struct {
+	Label string
+	URL   string
+}
+
+type formModel struct {
+	Calendars []option
+	Zones     []string
+	Values    url.Values
+	Name      string
+	Error     string
+	Feed      *storage.SavedFeed
+	Links     []link
+	// Webcal is built by us from the request, so it's safe to bypass the html/template URL scheme check
+	Webcal template.URL
+}
+
+func (h *handler) form(w http.ResponseWriter, m formModel) {
+	status := http.StatusOK
+	if m.Error != "" {
+		status = http.StatusBadRequest
+	}
+	checked := m.Values["calendar"]
+	seen := make([]string, 0)
+	for _, typ := range calendar.GetTypes(nil) {
+		if inStringList(typ, seen) {
+			continue
+		}
+		seen = append(seen, typ)
+		m.Calendars = append(m.Calendars, option{ID: typ, Label: calendar.Labels[typ], Checked: inStringList(typ, checked)})
+	}
+	m.Zones = web.Zones
+	if err := h.ren.HTML(w, status, "form", m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// save stores f, unless there are already maxFeeds saved feeds
+func (h *handler) save(f storage.SavedFeed) error {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	feeds, err := h.st.LoadFeeds()
+	if err != nil {
+		return err
+	}
+	if len(feeds) >= h.maxFeeds {
+		return fmt.Errorf("unable to save the feed, the limit of %d saved feeds has been reached", h.maxFeeds)
+	}
+	return h.st.SaveFeed(f)
+}
+
+func (h *handler) create(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := make(url.Values)
+	for _, p := range Params {
+		for _, v := range r.PostForm[p] {
+			if !inStringList(p, listParams) {
+				values.Add(p, v)
+				continue
+			}
+			for _, el := range strings.Split(v, ",") {
+				values.Add(p, el)
+			}
+		}
+	}
+	name := r.PostForm.Get("name")
+	f, err := New(name, r.PostForm["calendar"], values)
+	if err != nil {
+		values["calendar"] = r.PostForm["calendar"]
+		h.form(w, formModel{Name: name, Values: values, Error: err.Error()})
+		return
+	}
+	if wait, ok := h.limit.allow(clientAddr(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		http.Error(w, "too many saved feeds created, try again later", http.StatusTooManyRequests)
+		return
+	}
+	if err = h.save(f); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	base := url.URL{Scheme: "https", Host: r.Host}
+	m := formModel{Feed: &f}
+	exts := make([]string, 0, len(Formats))
+	for ext := range Formats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		base.Path = Path(f, ext)
+		m.Links = append(m.Links, link{Label: Formats[ext], URL: base.String()})
+	}
+	base.Scheme = "webcal"
+	base.Path = Path(f, ".ics")
+	m.Webcal = template.URL(base.String())
+	if err = h.ren.HTML(w, http.StatusCreated, "created", m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,95 @@
+package savedfeed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+func createRequest(remote string) *http.Request {
+	form := url.Values{"name": {"Test feed"}, "calendar": {"sc2"}}
+	r := httptest.NewRequest(http.MethodPost, Prefix+"/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = remote
+	return r
+}
+
+func TestCreateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []OptionFn
+		remotes []string
+		want    []int
+		saved   int
+	}{
+		{
+			name:    "under the limits",
+			remotes: []string{"192.0.2.1:1234", "192.0.2.1:1235"},
+			want:    []int{http.StatusCreated, http.StatusCreated},
+			saved:   2,
+		},
+		{
+			name:    "rate limited client",
+			opts:    []OptionFn{WithCreateLimit(2, time.Hour)},
+			remotes: []string{"192.0.2.1:1234", "192.0.2.1:1235", "192.0.2.1:1236", "192.0.2.2:1234"},
+			want:    []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests, http.StatusCreated},
+			saved:   3,
+		},
+		{
+			name:    "max feeds",
+			opts:    []OptionFn{WithMaxFeeds(2)},
+			remotes: []string{"192.0.2.1:1234", "192.0.2.2:1234", "192.0.2.3:1234"},
+			want:    []int{http.StatusCreated, http.StatusCreated, http.StatusServiceUnavailable},
+			saved:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.New()
+			h := NewHandler(st, http.NotFoundHandler(), tt.opts...)
+			for i, remote := range tt.remotes {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, createRequest(remote))
+				if w.Code != tt.want[i] {
+					t.Errorf("status %d for request %d, expected %d: %s", w.Code, i, tt.want[i], w.Body.String())
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Errorf("missing Retry-After header")
+				}
+			}
+			feeds, err := st.LoadFeeds()
+			if err != nil {
+				t.Fatalf("unable to load feeds: %s", err)
+			}
+			if len(feeds) != tt.saved {
+				t.Errorf("saved %d feeds, expected %d", len(feeds), tt.saved)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1, time.Hour)
+	now := time.Now()
+	if _, ok := l.allow("a", now); !ok {
+		t.Fatalf("first creation not allowed")
+	}
+	wait, ok := l.allow("a", now.Add(time.Minute))
+	if ok {
+		t.Fatalf("second creation allowed, expected it to be limited")
+	}
+	if wait != 59*time.Minute {
+		t.Errorf("wait %s, expected %s", wait, 59*time.Minute)
+	}
+	if _, ok = l.allow("a", now.Add(time.Hour)); !ok {
+		t.Errorf("creation not allowed after the interval")
+	}
+	if len(l.clients) != 1 {
+		t.Errorf("%d clients tracked, expected the expired ones to be removed", len(l.clients))
+	}
+}
@@ -0,0 +1,65 @@
+package savedfeed
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxFeeds is the number of saved feeds after which the form stops creating new ones
+	DefaultMaxFeeds = 10000
+	// DefaultCreateLimit is the number of feeds each client can create in DefaultCreateInterval
+	DefaultCreateLimit = 10
+	// DefaultCreateInterval is the interval in which the creations of a client get counted
+	DefaultCreateInterval = time.Hour
+)
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// limiter counts the feeds created by each client in fixed intervals
+type limiter struct {
+	m       sync.Mutex
+	max     int
+	per     time.Duration
+	clients map[string]window
+}
+
+func newLimiter(max int, per time.Duration) *limiter {
+	return &limiter{max: max, per: per, clients: make(map[string]window)}
+}
+
+// allow counts a creation for client at now, and returns how long the client needs to wait when it went over the limit
+func (l *limiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for c, w := range l.clients {
+		if now.Sub(w.start) >= l.per {
+			delete(l.clients, c)
+		}
+	}
+	w, ok := l.clients[client]
+	if !ok {
+		w = window{start: now}
+	}
+	if w.count >= l.max {
+		return w.start.Add(l.per).Sub(now), false
+	}
+	w.count++
+	l.clients[client] = w
+	return 0, true
+}
+
+// clientAddr returns the address the request came from, without the port.
+// Behind a reverse proxy all the requests share the address of the proxy, so they share the limit.
+func clientAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
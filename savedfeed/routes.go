@@ -0,0 +1,15 @@
+package savedfeed
+
+import (
+	"net/http"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// Routes serves the saved feeds of st under Prefix, the feeds themselves are served by the routes of next
+func Routes(st storage.SavedFeedStore, next http.Handler, opts ...OptionFn) http.Handler {
+	r := http.NewServeMux()
+	r.Handle(Prefix+"/", NewHandler(st, next, opts...))
+	r.Handle(Prefix, http.RedirectHandler(Prefix+"/", http.StatusMovedPermanently))
+	return r
+}
@@ -0,0 +1,129 @@
+package savedfeed
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/api"
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/feed"
+	"git.sr.ht/~mariusor/othrys/filter"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// Prefix is the path under which the saved feeds are served: /saved/{token}.ics
+const Prefix = "/saved"
+
+// tokenSize is the number of random bytes in a token, which get encoded as 32 URL safe characters
+const tokenSize = 24
+
+// Params are the query parameters that can be saved with a feed
+var Params = []string{"category", "stage", "participant", "q", "kind", "canceled", "min-duration", "tz", "alarm"}
+
+// Formats maps the extensions of the saved feed URLs to a description of the format they're served in
+var Formats = map[string]string{
+	".ics":  "iCalendar",
+	".json": "JSON",
+	".atom": "Atom",
+	".rss":  "RSS",
+}
+
+// NewToken generates an unguessable token for a saved feed
+func NewToken() (string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// New validates the selection and the query parameters, and returns a new saved feed with a fresh token
+func New(name string, types []string, values url.Values) (storage.SavedFeed, error) {
+	f := storage.SavedFeed{Name: strings.TrimSpace(name), Values: make(url.Values)}
+	if f.Name == "" {
+		return f, errors.New("the feed needs a name")
+	}
+	for _, typ := range types {
+		if valid := calendar.GetTypes([]string{typ}); len(valid) == 0 {
+			return f, fmt.Errorf("invalid calendar type %q", typ)
+		}
+		if !inStringList(typ, f.Types) {
+			f.Types = append(f.Types, typ)
+		}
+	}
+	if len(f.Types) == 0 {
+		return f, errors.New("the feed needs at least one calendar type")
+	}
+	for _, p := range Params {
+		for _, v := range values[p] {
+			if v = strings.TrimSpace(v); v != "" {
+				f.Values.Add(p, v)
+			}
+		}
+	}
+	if _, err := filter.FromValues(f.Values); err != nil {
+		return f, err
+	}
+	if _, err := ical.ParseAlarms(f.Values["alarm"]); err != nil {
+		return f, err
+	}
+	if tz := f.Values.Get("tz"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return f, fmt.Errorf("invalid timezone %q", tz)
+		}
+	}
+	var err error
+	if f.Token, err = NewToken(); err != nil {
+		return f, err
+	}
+	f.Created = time.Now().UTC()
+	return f, nil
+}
+
+func inStringList(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Path returns the path of the saved feed in the format of the ext extension
+func Path(f storage.SavedFeed, ext string) string {
+	return Prefix + "/" + f.Token + ext
+}
+
+// target returns the URL of the route that serves the saved feed in the format of the ext extension,
+// the feeds always use the upcoming window, so they don't go stale.
+func target(f storage.SavedFeed, ext string) (*url.URL, bool) {
+	selection := "/" + ical.UpcomingPath + "/" + strings.Join(f.Types, "+")
+	q := make(url.Values)
+	for k, v := range f.Values {
+		q[k] = v
+	}
+	u := url.URL{}
+	switch ext {
+	case ".ics":
+		u.Path = selection + ext
+	case ".atom", ".rss":
+		u.Path = feed.Prefix + selection + ext
+		q.Del("alarm")
+	case ".json":
+		u.Path = api.Prefix + "/events"
+		q.Set("upcoming", "true")
+		q.Set("calendar", strings.Join(f.Types, "+"))
+		q.Set("limit", fmt.Sprintf("%d", api.MaxLimit))
+		q.Del("alarm")
+	default:
+		return nil, false
+	}
+	u.RawQuery = q.Encode()
+	return &u, true
+}
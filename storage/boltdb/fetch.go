@@ -0,0 +1,55 @@
+package boltdb
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const fetchesBucket = "fetches"
+
+// SaveFetch
+func (r *repo) SaveFetch(provider string, t time.Time) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(fetchesBucket))
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s: %w", fetchesBucket, err)
+		}
+		raw, err := t.UTC().MarshalText()
+		if err != nil {
+			return fmt.Errorf("could not marshal fetch time: %w", err)
+		}
+		return b.Put([]byte(provider), raw)
+	})
+}
+
+// LoadFetches
+func (r *repo) LoadFetches() (map[string]time.Time, error) {
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	fetches := make(map[string]time.Time)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(fetchesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(key, raw []byte) error {
+			t := time.Time{}
+			if err := t.UnmarshalText(raw); err != nil {
+				return fmt.Errorf("invalid fetch time for %s: %w", key, err)
+			}
+			fetches[string(key)] = t
+			return nil
+		})
+	})
+	return fetches, err
+}
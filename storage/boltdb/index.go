@@ -0,0 +1,259 @@
+package boltdb
+
+import (
+	"bytes"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// indexBucket holds the full-text index, with keys composed of the term and the path of the event
+// separated by indexSeparator, and empty values.
+const indexBucket = "idx"
+
+var indexSeparator = []byte{0}
+
+// idsBucket maps the identity of the events, their type and CalID, to their paths
+const idsBucket = "ids"
+
+func idKey(typ string, id int64) []byte {
+	return []byte(storage.OverrideKey(typ, id))
+}
+
+func itemPath(ev calendar.Event) []byte {
+	return bytes.Join([][]byte{itemBucketPath([]byte(ev.Type), ev.StartTime), []byte(fmt.Sprintf("%d", ev.CalID))}, pathSeparator)
+}
+
+func indexKey(term string, path []byte) []byte {
+	return bytes.Join([][]byte{[]byte(term), path}, indexSeparator)
+}
+
+func indexEvent(idx *bolt.Bucket, ev calendar.Event) error {
+	path := itemPath(ev)
+	for _, term := range storage.Terms(ev) {
+		if err := idx.Put(indexKey(term, path), []byte{}); err != nil {
+			return fmt.Errorf("unable to index term %s: %w", term, err)
+		}
+	}
+	return nil
+}
+
+func unindexEvent(idx *bolt.Bucket, ev calendar.Event) error {
+	path := itemPath(ev)
+	for _, term := range storage.Terms(ev) {
+		if err := idx.Delete(indexKey(term, path)); err != nil {
+			return fmt.Errorf("unable to remove term %s from index: %w", term, err)
+		}
+	}
+	return nil
+}
+
+// buildIndex indexes all the events under the root bucket, it's used for databases created before the index existed.
+func buildIndex(root, idx *bolt.Bucket) error {
+	return walkEvents(root, func(ev calendar.Event) error {
+		return indexEvent(idx, ev)
+	})
+}
+
+// buildIDs maps the identities of all the events under the root bucket to their paths,
+// when an event has been saved at multiple start times, the latest one wins.
+func buildIDs(root, ids *bolt.Bucket) error {
+	return walkEvents(root, func(ev calendar.Event) error {
+		return ids.Put(idKey(ev.Type, ev.CalID), itemPath(ev))
+	})
+}
+
+// removeID deletes the identity of the event, if it still points to its path
+func removeID(ids *bolt.Bucket, ev calendar.Event) error {
+	key := idKey(ev.Type, ev.CalID)
+	if !bytes.Equal(ids.Get(key), itemPath(ev)) {
+		return nil
+	}
+	if err := ids.Delete(key); err != nil {
+		return fmt.Errorf("unable to remove %s from ids: %w", key, err)
+	}
+	return nil
+}
+
+// findPaths returns the paths of the events that have at least one term starting with prefix
+func findPaths(idx *bolt.Bucket, prefix string) map[string]struct{} {
+	paths := make(map[string]struct{})
+	c := idx.Cursor()
+	pref := []byte(prefix)
+	for key, _ := c.Seek(pref); key != nil && bytes.HasPrefix(key, pref); key, _ = c.Next() {
+		if _, path, ok := bytes.Cut(key, indexSeparator); ok {
+			paths[string(path)] = struct{}{}
+		}
+	}
+	return paths
+}
+
+func loadFromPath(root *bolt.Bucket, path []byte) (calendar.Event, error) {
+	pieces := bytes.Split(path, pathSeparator)
+	b := root
+	for _, name := range pieces[:len(pieces)-1] {
+		if b = b.Bucket(name); b == nil {
+			return calendar.Event{}, fmt.Errorf("unable to find bucket for %s", path)
+		}
+	}
+	return loadItem(b.Get(pieces[len(pieces)-1]))
+}
+
+// FindEvent loads the event with the typ type and id CalID through the ids bucket, with its override applied
+func (r *repo) FindEvent(typ string, id int64) (calendar.Event, error) {
+	if err := r.open(); err != nil {
+		return calendar.Event{}, err
+	}
+	defer r.close()
+
+	ev := calendar.Event{}
+	err := r.d.View(func(tx *bolt.Tx) error {
+		var err error
+		if ev, err = r.findSaved(tx, typ, id); err != nil {
+			return err
+		}
+		o, ok, err := loadOverride(tx, typ, id)
+		if err != nil || !ok {
+			return err
+		}
+		var visible bool
+		if ev, visible = o.Apply(ev); !visible {
+			return storage.ErrNotFound
+		}
+		return nil
+	})
+	return ev, err
+}
+
+// FindSavedEvent loads the event with the typ type and id CalID as it was saved, without its override
+func (r *repo) FindSavedEvent(typ string, id int64) (calendar.Event, error) {
+	if err := r.open(); err != nil {
+		return calendar.Event{}, err
+	}
+	defer r.close()
+
+	ev := calendar.Event{}
+	err := r.d.View(func(tx *bolt.Tx) error {
+		var err error
+		ev, err = r.findSaved(tx, typ, id)
+		return err
+	})
+	return ev, err
+}
+
+func (r *repo) findSaved(tx *bolt.Tx, typ string, id int64) (calendar.Event, error) {
+	root := tx.Bucket(r.root)
+	ids := tx.Bucket([]byte(idsBucket))
+	if root == nil || ids == nil {
+		return calendar.Event{}, fmt.Errorf("invalid bucket %s", r.root)
+	}
+	p := ids.Get(idKey(typ, id))
+	if p == nil {
+		return calendar.Event{}, storage.ErrNotFound
+	}
+	ev, err := loadFromPath(root, p)
+	if err != nil || !ev.IsValid() {
+		return calendar.Event{}, storage.ErrNotFound
+	}
+	return ev, nil
+}
+
+// removeFromPath deletes the event saved at path, with its index terms
+func removeFromPath(root, idx *bolt.Bucket, path []byte) error {
+	pieces := bytes.Split(path, pathSeparator)
+	b := root
+	for _, name := range pieces[:len(pieces)-1] {
+		if b = b.Bucket(name); b == nil {
+			return nil
+		}
+	}
+	key := pieces[len(pieces)-1]
+	old, err := loadItem(b.Get(key))
+	if err != nil {
+		return nil
+	}
+	if err = unindexEvent(idx, old); err != nil {
+		return err
+	}
+	if err = b.Delete(key); err != nil {
+		return fmt.Errorf("unable to remove item %s: %w", path, err)
+	}
+	return nil
+}
+
+// SearchEvents loads the events in the cursor interval that match all the terms in the query,
+// where each term can be a prefix of a word in the event.
+// The index holds the events as saved, so the overridden events are checked against the query separately.
+func (r *repo) SearchEvents(query string, cursor storage.DateCursor, types ...string) (calendar.Events, error) {
+	terms := storage.Tokenize(query)
+	if len(terms) == 0 {
+		return r.LoadEvents(cursor, types...)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	allowed := make(map[string]bool)
+	for _, typ := range types {
+		allowed[typ] = true
+	}
+
+	events := make(calendar.Events, 0)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		idx := tx.Bucket([]byte(indexBucket))
+		ids := tx.Bucket([]byte(idsBucket))
+		if root == nil || idx == nil || ids == nil {
+			return fmt.Errorf("invalid bucket %s", r.root)
+		}
+		overrides, err := loadOverrides(tx)
+		if err != nil {
+			return err
+		}
+
+		var found map[string]struct{}
+		for _, term := range terms {
+			paths := findPaths(idx, term)
+			if found == nil {
+				found = paths
+				continue
+			}
+			for p := range found {
+				if _, ok := paths[p]; !ok {
+					delete(found, p)
+				}
+			}
+		}
+		for key := range overrides {
+			if p := ids.Get([]byte(key)); p != nil {
+				found[string(p)] = struct{}{}
+			}
+		}
+		for p := range found {
+			ev, err := loadFromPath(root, []byte(p))
+			if err != nil || !ev.IsValid() || !allowed[ev.Type] {
+				continue
+			}
+			if o, ok := overrides[storage.OverrideKey(ev.Type, ev.CalID)]; ok {
+				var visible bool
+				if ev, visible = o.Apply(ev); !visible {
+					continue
+				}
+			}
+			if !cursor.Contains(ev.StartTime) || !storage.Matches(ev, query) {
+				continue
+			}
+			events = append(events, ev)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	storage.SortEvents(events, types)
+	return events, nil
+}
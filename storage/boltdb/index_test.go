@@ -0,0 +1,87 @@
+package boltdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+func testRepo(t *testing.T, events ...calendar.Event) *repo {
+	t.Helper()
+	r := New(Config{Path: filepath.Join(t.TempDir(), DefaultFile)})
+	if err := r.SaveEvents(events); err != nil {
+		t.Fatalf("unable to save events: %s", err)
+	}
+	return r
+}
+
+func TestSearchEventsWithOverrides(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+	events := calendar.Events{
+		{CalID: 1, Type: "sc2", StartTime: start, Duration: time.Hour, Category: "Test Cup", Stage: "Group A"},
+		{CalID: 2, Type: "sc2", StartTime: start.Add(time.Hour), Duration: time.Hour, Category: "Test Cup", Stage: "Group B"},
+	}
+	playoffs := "Playoffs"
+	hidden := storage.Override{Type: "sc2", CalID: 2, Hidden: true}
+	renamed := storage.Override{Type: "sc2", CalID: 1, Stage: &playoffs}
+
+	tests := []struct {
+		name      string
+		overrides []storage.Override
+		query     string
+		want      []int64
+	}{
+		{name: "saved stage", query: "group", want: []int64{1, 2}},
+		{name: "overridden stage", overrides: []storage.Override{renamed}, query: "playoffs", want: []int64{1}},
+		{name: "replaced stage", overrides: []storage.Override{renamed}, query: "group", want: []int64{2}},
+		{name: "hidden event", overrides: []storage.Override{hidden}, query: "group", want: []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRepo(t, events...)
+			for _, o := range tt.overrides {
+				if err := r.SaveOverride(o); err != nil {
+					t.Fatalf("unable to save override: %s", err)
+				}
+			}
+			found, err := r.SearchEvents(tt.query, storage.Cursor(start, calendar.Day), "sc2")
+			if err != nil {
+				t.Fatalf("SearchEvents returned error: %s", err)
+			}
+			if len(found) != len(tt.want) {
+				t.Fatalf("found %d events, expected %d", len(found), len(tt.want))
+			}
+			for i, ev := range found {
+				if ev.CalID != tt.want[i] {
+					t.Errorf("found event %d, expected %d", ev.CalID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r := testRepo(t, calendar.Event{CalID: 1, Type: "sc2", StartTime: time.Now().UTC(), Duration: time.Hour})
+	if err := r.Check(context.Background()); err != nil {
+		t.Fatalf("Check returned error: %s", err)
+	}
+
+	// hold the lock of the file, like a fetch or a compaction would
+	if err := r.open(); err != nil {
+		t.Fatalf("unable to open db: %s", err)
+	}
+	defer r.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := r.Check(ctx); err == nil {
+		t.Errorf("Check succeeded while the db was locked")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Check took %s, expected it to give up after the timeout", took)
+	}
+}
@@ -0,0 +1,57 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const jobsBucket = "jobs"
+
+// SaveJobRun
+func (r *repo) SaveJobRun(run storage.JobRun) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(jobsBucket))
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s: %w", jobsBucket, err)
+		}
+		raw, err := json.Marshal(run)
+		if err != nil {
+			return fmt.Errorf("could not marshal job run: %w", err)
+		}
+		return b.Put([]byte(run.Job), raw)
+	})
+}
+
+// LoadJobRuns
+func (r *repo) LoadJobRuns() (map[string]storage.JobRun, error) {
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	runs := make(map[string]storage.JobRun)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobsBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(key, raw []byte) error {
+			run := storage.JobRun{}
+			if err := json.Unmarshal(raw, &run); err != nil {
+				return fmt.Errorf("invalid job run %s: %w", key, err)
+			}
+			runs[string(key)] = run
+			return nil
+		})
+	})
+	return runs, err
+}
@@ -0,0 +1,177 @@
+package boltdb
+
+import (
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// compactTxSize is the size after which the compaction commits the transaction
+const compactTxSize = 64 * 1024
+
+// RemoveEvents deletes the events for which the fn function returns true, with their overrides,
+// together with the date buckets that are left empty after the removal.
+func (r *repo) RemoveEvents(fn func(calendar.Event) bool) (int, error) {
+	if err := r.open(); err != nil {
+		return 0, err
+	}
+	defer r.close()
+
+	count := 0
+	err := r.d.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return fmt.Errorf("invalid bucket %s", r.root)
+		}
+		idx := tx.Bucket([]byte(indexBucket))
+		if idx == nil {
+			return fmt.Errorf("invalid bucket %s", indexBucket)
+		}
+		removed, err := removeFromBucket(root, idx, fn)
+		count = len(removed)
+		if err != nil {
+			return err
+		}
+		if ids := tx.Bucket([]byte(idsBucket)); ids != nil {
+			for _, ev := range removed {
+				if err := removeID(ids, ev); err != nil {
+					return err
+				}
+			}
+		}
+		overrides := tx.Bucket([]byte(overridesBucket))
+		if overrides == nil {
+			return nil
+		}
+		for _, ev := range removed {
+			if err := overrides.Delete([]byte(storage.OverrideKey(ev.Type, ev.CalID))); err != nil {
+				return fmt.Errorf("unable to remove the override of %s: %w", storage.OverrideKey(ev.Type, ev.CalID), err)
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// CountEvents returns the number of events for which the fn function returns true
+func (r *repo) CountEvents(fn func(calendar.Event) bool) (int, error) {
+	if err := r.open(); err != nil {
+		return 0, err
+	}
+	defer r.close()
+
+	count := 0
+	err := r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(r.root)
+		if root == nil {
+			return fmt.Errorf("invalid bucket %s", r.root)
+		}
+		return walkEvents(root, func(ev calendar.Event) error {
+			if fn(ev) {
+				count++
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+func bucketIsEmpty(b *bolt.Bucket) bool {
+	k, _ := b.Cursor().First()
+	return k == nil
+}
+
+// removeFromBucket deletes the events under b for which fn returns true, and returns them
+func removeFromBucket(b, idx *bolt.Bucket, fn func(calendar.Event) bool) (calendar.Events, error) {
+	removed := make(calendar.Events, 0)
+	toRemove := make([][]byte, 0)
+	events := make(calendar.Events, 0)
+	emptyBuckets := make([][]byte, 0)
+
+	c := b.Cursor()
+	for key, raw := c.First(); key != nil; key, raw = c.Next() {
+		if raw == nil {
+			cb := b.Bucket(key)
+			if cb == nil {
+				continue
+			}
+			evs, err := removeFromBucket(cb, idx, fn)
+			removed = append(removed, evs...)
+			if err != nil {
+				return removed, err
+			}
+			if bucketIsEmpty(cb) {
+				emptyBuckets = append(emptyBuckets, append([]byte{}, key...))
+			}
+			continue
+		}
+		ev, err := loadItem(raw)
+		if err != nil || !fn(ev) {
+			continue
+		}
+		if err = unindexEvent(idx, ev); err != nil {
+			return removed, err
+		}
+		toRemove = append(toRemove, append([]byte{}, key...))
+		events = append(events, ev)
+	}
+	for i, key := range toRemove {
+		if err := b.Delete(key); err != nil {
+			return removed, fmt.Errorf("unable to remove item %s: %w", key, err)
+		}
+		removed = append(removed, events[i])
+	}
+	for _, key := range emptyBuckets {
+		if err := b.DeleteBucket(key); err != nil {
+			return removed, fmt.Errorf("unable to remove empty bucket %s: %w", key, err)
+		}
+	}
+	return removed, nil
+}
+
+// Compact copies the database into a fresh file and swaps it in place of the current one.
+// The lock on the current file is held for the whole operation, so concurrent users wait for it to finish.
+func (r *repo) Compact() (int64, int64, error) {
+	if err := r.open(); err != nil {
+		return 0, 0, err
+	}
+	defer r.close()
+
+	before, err := os.Stat(r.path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tmpPath := r.path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, before.Mode(), nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not open compaction db %s %w", tmpPath, err)
+	}
+	if err = bolt.Compact(dst, r.d, compactTxSize); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("unable to compact db %s: %w", r.path, err)
+	}
+	if err = dst.Sync(); err == nil {
+		err = dst.Close()
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("unable to close compaction db %s: %w", tmpPath, err)
+	}
+
+	after, err := os.Stat(tmpPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = os.Rename(tmpPath, r.path); err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("unable to replace db %s: %w", r.path, err)
+	}
+	return before.Size(), after.Size(), nil
+}
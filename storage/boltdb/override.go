@@ -0,0 +1,100 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const overridesBucket = "overrides"
+
+func loadOverrides(tx *bolt.Tx) (map[string]storage.Override, error) {
+	overrides := make(map[string]storage.Override)
+	b := tx.Bucket([]byte(overridesBucket))
+	if b == nil {
+		return overrides, nil
+	}
+	err := b.ForEach(func(key, raw []byte) error {
+		o := storage.Override{}
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return fmt.Errorf("invalid override %s: %w", key, err)
+		}
+		overrides[string(key)] = o
+		return nil
+	})
+	return overrides, err
+}
+
+// loadOverride returns the override of the event with the typ type and id CalID, if it has one
+func loadOverride(tx *bolt.Tx, typ string, id int64) (storage.Override, bool, error) {
+	o := storage.Override{}
+	b := tx.Bucket([]byte(overridesBucket))
+	if b == nil {
+		return o, false, nil
+	}
+	raw := b.Get([]byte(storage.OverrideKey(typ, id)))
+	if raw == nil {
+		return o, false, nil
+	}
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return o, false, fmt.Errorf("invalid override %s: %w", storage.OverrideKey(typ, id), err)
+	}
+	return o, true, nil
+}
+
+// LoadOverrides
+func (r *repo) LoadOverrides() ([]storage.Override, error) {
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	result := make([]storage.Override, 0)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		overrides, err := loadOverrides(tx)
+		for _, o := range overrides {
+			result = append(result, o)
+		}
+		return err
+	})
+	return result, err
+}
+
+// SaveOverride
+func (r *repo) SaveOverride(o storage.Override) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(overridesBucket))
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s: %w", overridesBucket, err)
+		}
+		raw, err := json.Marshal(o)
+		if err != nil {
+			return fmt.Errorf("could not marshal override: %w", err)
+		}
+		return b.Put([]byte(o.Key()), raw)
+	})
+}
+
+// DeleteOverride
+func (r *repo) DeleteOverride(typ string, id int64) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(overridesBucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(storage.OverrideKey(typ, id)))
+	})
+}
@@ -0,0 +1,144 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const (
+	// postsBucket holds a bucket for each account, with a bucket for each kind of post, with the records by event
+	postsBucket = "posts"
+	// postedBucket holds the posted until times, by account and kind
+	postedBucket = "posted"
+)
+
+func postedKey(account, kind string) []byte {
+	return []byte(account + "/" + kind)
+}
+
+// SavePostRecords
+func (r *repo) SavePostRecords(records ...storage.PostRecord) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(postsBucket))
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s: %w", postsBucket, err)
+		}
+		for _, rec := range records {
+			acc, err := root.CreateBucketIfNotExists([]byte(rec.Account))
+			if err != nil {
+				return fmt.Errorf("unable to create bucket %s/%s: %w", postsBucket, rec.Account, err)
+			}
+			b, err := acc.CreateBucketIfNotExists([]byte(rec.Kind))
+			if err != nil {
+				return fmt.Errorf("unable to create bucket %s/%s/%s: %w", postsBucket, rec.Account, rec.Kind, err)
+			}
+			raw, err := json.Marshal(rec)
+			if err != nil {
+				return fmt.Errorf("could not marshal post record: %w", err)
+			}
+			if err = b.Put([]byte(rec.Event), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadPostRecords
+func (r *repo) LoadPostRecords(account, kind string, events ...string) (map[string]storage.PostRecord, error) {
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	records := make(map[string]storage.PostRecord)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(postsBucket))
+		if root == nil {
+			return nil
+		}
+		acc := root.Bucket([]byte(account))
+		if acc == nil {
+			return nil
+		}
+		b := acc.Bucket([]byte(kind))
+		if b == nil {
+			return nil
+		}
+		load := func(key, raw []byte) error {
+			rec := storage.PostRecord{}
+			if err := json.Unmarshal(raw, &rec); err != nil {
+				return fmt.Errorf("invalid post record %s: %w", key, err)
+			}
+			records[string(key)] = rec
+			return nil
+		}
+		if len(events) == 0 {
+			return b.ForEach(load)
+		}
+		for _, ev := range events {
+			if raw := b.Get([]byte(ev)); raw != nil {
+				if err := load([]byte(ev), raw); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// SavePostedUntil
+func (r *repo) SavePostedUntil(account, kind string, t time.Time) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(postedBucket))
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s: %w", postedBucket, err)
+		}
+		raw, err := t.UTC().MarshalText()
+		if err != nil {
+			return fmt.Errorf("could not marshal posted until time: %w", err)
+		}
+		return b.Put(postedKey(account, kind), raw)
+	})
+}
+
+// LoadPostedUntil
+func (r *repo) LoadPostedUntil(account, kind string) (time.Time, error) {
+	if err := r.open(); err != nil {
+		return time.Time{}, err
+	}
+	defer r.close()
+
+	t := time.Time{}
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(postedBucket))
+		if b == nil {
+			return nil
+		}
+		raw := b.Get(postedKey(account, kind))
+		if raw == nil {
+			return nil
+		}
+		if err := t.UnmarshalText(raw); err != nil {
+			return fmt.Errorf("invalid posted until time for %s %s: %w", account, kind, err)
+		}
+		return nil
+	})
+	return t, err
+}
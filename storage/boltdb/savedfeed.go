@@ -0,0 +1,98 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+const feedsBucket = "feeds"
+
+// LoadFeed
+func (r *repo) LoadFeed(token string) (storage.SavedFeed, error) {
+	f := storage.SavedFeed{}
+	if err := r.open(); err != nil {
+		return f, err
+	}
+	defer r.close()
+
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(feedsBucket))
+		if b == nil {
+			return storage.ErrNotFound
+		}
+		raw := b.Get([]byte(token))
+		if raw == nil {
+			return storage.ErrNotFound
+		}
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return fmt.Errorf("invalid feed %s: %w", token, err)
+		}
+		return nil
+	})
+	return f, err
+}
+
+// LoadFeeds
+func (r *repo) LoadFeeds() ([]storage.SavedFeed, error) {
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	defer r.close()
+
+	feeds := make([]storage.SavedFeed, 0)
+	err := r.d.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(feedsBucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(key, raw []byte) error {
+			f := storage.SavedFeed{}
+			if err := json.Unmarshal(raw, &f); err != nil {
+				return fmt.Errorf("invalid feed %s: %w", key, err)
+			}
+			feeds = append(feeds, f)
+			return nil
+		})
+	})
+	return feeds, err
+}
+
+// SaveFeed
+func (r *repo) SaveFeed(f storage.SavedFeed) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(feedsBucket))
+		if err != nil {
+			return fmt.Errorf("unable to create bucket %s: %w", feedsBucket, err)
+		}
+		raw, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("could not marshal feed: %w", err)
+		}
+		return b.Put([]byte(f.Token), raw)
+	})
+}
+
+// DeleteFeed
+func (r *repo) DeleteFeed(token string) error {
+	if err := r.open(); err != nil {
+		return err
+	}
+	defer r.close()
+
+	return r.d.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(feedsBucket))
+		if b == nil || b.Get([]byte(token)) == nil {
+			return storage.ErrNotFound
+		}
+		return b.Delete([]byte(token))
+	})
+}
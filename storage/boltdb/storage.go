@@ -2,7 +2,9 @@ package boltdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
@@ -60,11 +62,29 @@ func New(c Config) *repo {
 
 func (r *repo) open() error {
 	var err error
-	r.d, err = bolt.Open(r.path, 0600, nil)
-	if err != nil {
-		return fmt.Errorf("could not open db %s %w", r.path, err)
+	for {
+		before, _ := os.Stat(r.path)
+		r.d, err = bolt.Open(r.path, 0600, nil)
+		if err != nil {
+			return fmt.Errorf("could not open db %s %w", r.path, err)
+		}
+		// a compaction might have swapped the file while we were waiting for the lock,
+		// in which case we have to open the new one.
+		after, _ := os.Stat(r.path)
+		if before == nil || after == nil || os.SameFile(before, after) {
+			break
+		}
+		r.d.Close()
 	}
-	err = r.d.Update(func(tx *bolt.Tx) error {
+	missing := false
+	r.d.View(func(tx *bolt.Tx) error {
+		missing = tx.Bucket(r.root) == nil || tx.Bucket([]byte(indexBucket)) == nil || tx.Bucket([]byte(idsBucket)) == nil
+		return nil
+	})
+	if !missing {
+		return nil
+	}
+	return r.d.Update(func(tx *bolt.Tx) error {
 		root, err := tx.CreateBucketIfNotExists(r.root)
 		if err != nil {
 			return fmt.Errorf("unable to create root bucket %s: %w", r.root, err)
@@ -72,9 +92,24 @@ func (r *repo) open() error {
 		if !root.Writable() {
 			return fmt.Errorf("non writeable root bucket %s", r.root)
 		}
+		if tx.Bucket([]byte(indexBucket)) == nil {
+			idx, err := tx.CreateBucket([]byte(indexBucket))
+			if err != nil {
+				return fmt.Errorf("unable to create index bucket %s: %w", indexBucket, err)
+			}
+			if err = buildIndex(root, idx); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket([]byte(idsBucket)) == nil {
+			ids, err := tx.CreateBucket([]byte(idsBucket))
+			if err != nil {
+				return fmt.Errorf("unable to create ids bucket %s: %w", idsBucket, err)
+			}
+			return buildIDs(root, ids)
+		}
 		return nil
 	})
-	return err
 }
 
 // Close closes the boltdb database if possible.
@@ -85,9 +120,14 @@ func (r *repo) close() error {
 	return r.d.Close()
 }
 
-// LoadEvent
+// LoadEvent loads the event as it was saved, without applying any overrides
 func (r *repo) LoadEvent(typ string, date time.Time, id int64) calendar.Event {
-	events, err := r.LoadEvents(storage.DateCursor{T: date, D: time.Hour}, typ)
+	if err := r.open(); err != nil {
+		r.err("error loading events: %s", err)
+		return calendar.Event{}
+	}
+	defer r.close()
+	events, err := loadFromBucket(r.d, r.root, storage.DateCursor{T: date, D: time.Hour}, typ)
 	if err != nil {
 		r.err("error loading events: %s", err)
 	}
@@ -99,7 +139,8 @@ func (r *repo) LoadEvent(typ string, date time.Time, id int64) calendar.Event {
 	return calendar.Event{}
 }
 
-// LoadEvents
+// LoadEvents loads the events in the cursor interval, with the overrides applied.
+// The events which have their start time overridden are checked against the interval with the new start time.
 func (r *repo) LoadEvents(cursor storage.DateCursor, types ...string) (calendar.Events, error) {
 	var err error
 	err = r.open()
@@ -107,7 +148,68 @@ func (r *repo) LoadEvents(cursor storage.DateCursor, types ...string) (calendar.
 		return nil, err
 	}
 	defer r.close()
-	return loadFromBucket(r.d, r.root, cursor, types...)
+	events, err := loadFromBucket(r.d, r.root, cursor, types...)
+	if err != nil {
+		return nil, err
+	}
+	return applyOverrides(r.d, r.root, cursor, events, types...)
+}
+
+// applyOverrides returns the events with their overrides applied, without the ones moved out of the cursor interval,
+// and with the ones moved into it.
+func applyOverrides(db *bolt.DB, rootName []byte, cursor storage.DateCursor, events calendar.Events, types ...string) (calendar.Events, error) {
+	result := make(calendar.Events, 0, len(events))
+	err := db.View(func(tx *bolt.Tx) error {
+		overrides, err := loadOverrides(tx)
+		if err != nil {
+			return err
+		}
+		loaded := make(map[string]struct{}, len(events))
+		for _, ev := range events {
+			key := storage.OverrideKey(ev.Type, ev.CalID)
+			loaded[key] = struct{}{}
+			o, ok := overrides[key]
+			if !ok {
+				result = append(result, ev)
+				continue
+			}
+			if ev, ok = o.Apply(ev); ok && (o.StartTime == nil || cursor.Contains(ev.StartTime)) {
+				result = append(result, ev)
+			}
+		}
+
+		root := tx.Bucket(rootName)
+		ids := tx.Bucket([]byte(idsBucket))
+		if root == nil || ids == nil {
+			return nil
+		}
+		allowed := make(map[string]bool, len(types))
+		for _, typ := range types {
+			allowed[typ] = true
+		}
+		for key, o := range overrides {
+			if _, ok := loaded[key]; ok || o.StartTime == nil || !allowed[o.Type] || !cursor.Contains(*o.StartTime) {
+				continue
+			}
+			p := ids.Get([]byte(key))
+			if p == nil {
+				continue
+			}
+			ev, err := loadFromPath(root, p)
+			if err != nil || !ev.IsValid() {
+				continue
+			}
+			if ev, ok := o.Apply(ev); ok {
+				result = append(result, ev)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	storage.SortEvents(result, types)
+	return result, nil
 }
 
 func loadFromBucketRecursive(b *bolt.Bucket, min, max []byte) calendar.Events {
@@ -147,6 +249,20 @@ func loadFromBucketRecursive(b *bolt.Bucket, min, max []byte) calendar.Events {
 	return events
 }
 
+// walkEvents calls fn for each of the valid events under the b bucket
+func walkEvents(b *bolt.Bucket, fn func(calendar.Event) error) error {
+	return b.ForEach(func(key, raw []byte) error {
+		if raw == nil {
+			return walkEvents(b.Bucket(key), fn)
+		}
+		ev, err := loadItem(raw)
+		if err != nil || !ev.IsValid() {
+			return nil
+		}
+		return fn(ev)
+	})
+}
+
 func loadFromBucket(db *bolt.DB, root []byte, cursor storage.DateCursor, types ...string) (calendar.Events, error) {
 	events := make(calendar.Events, 0)
 
@@ -320,12 +436,34 @@ func save(r *repo, ev calendar.Event) (calendar.Event, error) {
 			return fmt.Errorf("could not marshal object: %w", err)
 		}
 		objectID := []byte(fmt.Sprintf("%d", ev.CalID))
+		idx := tx.Bucket([]byte(indexBucket))
+		if idx == nil {
+			return fmt.Errorf("invalid bucket %s", indexBucket)
+		}
+		ids := tx.Bucket([]byte(idsBucket))
+		if ids == nil {
+			return fmt.Errorf("invalid bucket %s", idsBucket)
+		}
+		// the copy saved at the previous start time of the event is replaced by this one
+		if prev := ids.Get(idKey(ev.Type, ev.CalID)); prev != nil && !bytes.Equal(prev, itemPath(ev)) {
+			if err = removeFromPath(root, idx, prev); err != nil {
+				return err
+			}
+		}
+		if old, err := loadItem(b.Get(objectID)); err == nil {
+			if err = unindexEvent(idx, old); err != nil {
+				return err
+			}
+		}
 		err = b.Put(objectID[:], entryBytes)
 		if err != nil {
 			return fmt.Errorf("could not store encoded object: %w", err)
 		}
+		if err = ids.Put(idKey(ev.Type, ev.CalID), itemPath(ev)); err != nil {
+			return fmt.Errorf("could not store the path of %s: %w", idKey(ev.Type, ev.CalID), err)
+		}
 
-		return nil
+		return indexEvent(idx, ev)
 	})
 
 	return ev, err
@@ -357,3 +495,23 @@ func mkDirIfNotExists(p string) (string, error) {
 	}
 	return path.Join(fullPath, path.Base(p)), nil
 }
+
+// Check opens the db read only, giving up on waiting for the lock of the file when ctx expires,
+// so the checks don't pile up while a fetch or a compaction holds it.
+func (r *repo) Check(ctx context.Context) error {
+	timeout := time.Duration(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return ctx.Err()
+		}
+	}
+	if _, err := os.Stat(r.path); errors.Is(err, os.ErrNotExist) {
+		// the db gets created with the first write
+		return nil
+	}
+	db, err := bolt.Open(r.path, 0600, &bolt.Options{ReadOnly: true, Timeout: timeout})
+	if err != nil {
+		return fmt.Errorf("could not open db %s %w", r.path, err)
+	}
+	return db.Close()
+}
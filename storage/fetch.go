@@ -0,0 +1,9 @@
+package storage
+
+import "time"
+
+// FetchStore is implemented by storage backends that keep track of the last successful fetch of each calendar provider
+type FetchStore interface {
+	SaveFetch(provider string, t time.Time) error
+	LoadFetches() (map[string]time.Time, error)
+}
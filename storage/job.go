@@ -0,0 +1,18 @@
+package storage
+
+import "time"
+
+// JobRun is the state of the last run of a scheduled job
+type JobRun struct {
+	Job      string
+	Trigger  string
+	Started  time.Time
+	Finished time.Time `json:",omitempty"`
+	Error    string    `json:",omitempty"`
+}
+
+// JobStore is implemented by storage backends that can persist the state of the scheduled jobs between restarts
+type JobStore interface {
+	SaveJobRun(JobRun) error
+	LoadJobRuns() (map[string]JobRun, error)
+}
@@ -0,0 +1,331 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+// key mirrors the way the boltdb storage identifies events: type, start time with minute precision and ID
+type key struct {
+	typ   string
+	start int64
+	id    int64
+}
+
+func keyOf(e calendar.Event) key {
+	return key{typ: e.Type, start: e.StartTime.Truncate(time.Minute).Unix(), id: e.CalID}
+}
+
+type repo struct {
+	m         sync.RWMutex
+	events    map[key]calendar.Event
+	overrides map[string]storage.Override
+	feeds     map[string]storage.SavedFeed
+	fetches   map[string]time.Time
+	jobs      map[string]storage.JobRun
+	posts     map[postKey]storage.PostRecord
+	until     map[postKey]time.Time
+}
+
+// postKey identifies the records of the posting ledger, the event is empty for the posted until times
+type postKey struct {
+	account, kind, event string
+}
+
+// New returns a new in memory repository, its contents are lost when the process stops
+func New() *repo {
+	return &repo{
+		events:    make(map[key]calendar.Event),
+		overrides: make(map[string]storage.Override),
+		feeds:     make(map[string]storage.SavedFeed),
+		fetches:   make(map[string]time.Time),
+		jobs:      make(map[string]storage.JobRun),
+		posts:     make(map[postKey]storage.PostRecord),
+		until:     make(map[postKey]time.Time),
+	}
+}
+
+// LoadEvent loads the event as it was saved, without applying any overrides
+func (r *repo) LoadEvent(typ string, date time.Time, id int64) calendar.Event {
+	cursor := storage.Cursor(date, time.Hour)
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for k, ev := range r.events {
+		if k.typ == typ && k.id == id && cursor.Contains(ev.StartTime) {
+			return ev
+		}
+	}
+	return calendar.Event{}
+}
+
+// LoadEvents loads the events in the cursor interval, with the overrides applied.
+// The interval is checked against the overridden start times.
+func (r *repo) LoadEvents(cursor storage.DateCursor, types ...string) (calendar.Events, error) {
+	events := make(calendar.Events, 0)
+	r.m.RLock()
+	for _, typ := range types {
+		for k, ev := range r.events {
+			if k.typ != typ {
+				continue
+			}
+			if o, ok := r.overrides[storage.OverrideKey(ev.Type, ev.CalID)]; ok {
+				var visible bool
+				if ev, visible = o.Apply(ev); !visible {
+					continue
+				}
+			}
+			if cursor.Contains(ev.StartTime) {
+				events = append(events, ev)
+			}
+		}
+	}
+	r.m.RUnlock()
+
+	storage.SortEvents(events, types)
+	return events, nil
+}
+
+// FindEvent loads the event with the typ type and id CalID, with its override applied
+func (r *repo) FindEvent(typ string, id int64) (calendar.Event, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for k, ev := range r.events {
+		if k.typ != typ || k.id != id {
+			continue
+		}
+		if o, ok := r.overrides[storage.OverrideKey(typ, id)]; ok {
+			var visible bool
+			if ev, visible = o.Apply(ev); !visible {
+				return calendar.Event{}, storage.ErrNotFound
+			}
+		}
+		return ev, nil
+	}
+	return calendar.Event{}, storage.ErrNotFound
+}
+
+// FindSavedEvent loads the event with the typ type and id CalID as it was saved, without its override
+func (r *repo) FindSavedEvent(typ string, id int64) (calendar.Event, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for k, ev := range r.events {
+		if k.typ == typ && k.id == id {
+			return ev, nil
+		}
+	}
+	return calendar.Event{}, storage.ErrNotFound
+}
+
+// SaveEvents
+func (r *repo) SaveEvents(events calendar.Events) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, ev := range events {
+		r.save(ev)
+	}
+	return nil
+}
+
+// SaveEvent
+func (r *repo) SaveEvent(ev calendar.Event) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.save(ev)
+	return nil
+}
+
+// save replaces the copies of ev saved at its previous start times
+func (r *repo) save(ev calendar.Event) {
+	key := keyOf(ev)
+	for k := range r.events {
+		if k.typ == ev.Type && k.id == ev.CalID && k != key {
+			delete(r.events, k)
+		}
+	}
+	r.events[key] = ev
+}
+
+// RemoveEvents deletes the events for which the fn function returns true, with their overrides.
+func (r *repo) RemoveEvents(fn func(calendar.Event) bool) (int, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	removed := 0
+	for k, ev := range r.events {
+		if fn(ev) {
+			delete(r.events, k)
+			delete(r.overrides, storage.OverrideKey(ev.Type, ev.CalID))
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// CountEvents returns the number of events for which the fn function returns true
+func (r *repo) CountEvents(fn func(calendar.Event) bool) (int, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	count := 0
+	for _, ev := range r.events {
+		if fn(ev) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// LoadOverrides
+func (r *repo) LoadOverrides() ([]storage.Override, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	overrides := make([]storage.Override, 0, len(r.overrides))
+	for _, o := range r.overrides {
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// SaveOverride
+func (r *repo) SaveOverride(o storage.Override) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.overrides[o.Key()] = o
+	return nil
+}
+
+// DeleteOverride
+func (r *repo) DeleteOverride(typ string, id int64) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.overrides, storage.OverrideKey(typ, id))
+	return nil
+}
+
+// LoadFeed
+func (r *repo) LoadFeed(token string) (storage.SavedFeed, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	f, ok := r.feeds[token]
+	if !ok {
+		return f, storage.ErrNotFound
+	}
+	return f, nil
+}
+
+// LoadFeeds
+func (r *repo) LoadFeeds() ([]storage.SavedFeed, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	feeds := make([]storage.SavedFeed, 0, len(r.feeds))
+	for _, f := range r.feeds {
+		feeds = append(feeds, f)
+	}
+	return feeds, nil
+}
+
+// SaveFeed
+func (r *repo) SaveFeed(f storage.SavedFeed) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.feeds[f.Token] = f
+	return nil
+}
+
+// DeleteFeed
+func (r *repo) DeleteFeed(token string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.feeds[token]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(r.feeds, token)
+	return nil
+}
+
+// SaveFetch
+func (r *repo) SaveFetch(provider string, t time.Time) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.fetches[provider] = t.UTC()
+	return nil
+}
+
+// LoadFetches
+func (r *repo) LoadFetches() (map[string]time.Time, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	fetches := make(map[string]time.Time, len(r.fetches))
+	for p, t := range r.fetches {
+		fetches[p] = t
+	}
+	return fetches, nil
+}
+
+// SaveJobRun
+func (r *repo) SaveJobRun(run storage.JobRun) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.jobs[run.Job] = run
+	return nil
+}
+
+// LoadJobRuns
+func (r *repo) LoadJobRuns() (map[string]storage.JobRun, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	runs := make(map[string]storage.JobRun, len(r.jobs))
+	for name, run := range r.jobs {
+		runs[name] = run
+	}
+	return runs, nil
+}
+
+// SavePostRecords
+func (r *repo) SavePostRecords(records ...storage.PostRecord) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, rec := range records {
+		rec.IDs = append([]string(nil), rec.IDs...)
+		r.posts[postKey{account: rec.Account, kind: rec.Kind, event: rec.Event}] = rec
+	}
+	return nil
+}
+
+// LoadPostRecords
+func (r *repo) LoadPostRecords(account, kind string, events ...string) (map[string]storage.PostRecord, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	records := make(map[string]storage.PostRecord)
+	if len(events) == 0 {
+		for k, rec := range r.posts {
+			if k.account == account && k.kind == kind {
+				records[k.event] = rec
+			}
+		}
+		return records, nil
+	}
+	for _, ev := range events {
+		if rec, ok := r.posts[postKey{account: account, kind: kind, event: ev}]; ok {
+			records[ev] = rec
+		}
+	}
+	return records, nil
+}
+
+// SavePostedUntil
+func (r *repo) SavePostedUntil(account, kind string, t time.Time) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.until[postKey{account: account, kind: kind}] = t.UTC()
+	return nil
+}
+
+// LoadPostedUntil
+func (r *repo) LoadPostedUntil(account, kind string) (time.Time, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.until[postKey{account: account, kind: kind}], nil
+}
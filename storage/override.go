@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// Override holds the manual changes to an event that need to survive it being fetched again.
+// The event is identified by its type and CalID, and only the non nil fields replace the fetched values.
+type Override struct {
+	Type      string
+	CalID     int64
+	Hidden    bool           `json:",omitempty"`
+	StartTime *time.Time     `json:",omitempty"`
+	Duration  *time.Duration `json:",omitempty"`
+	Category  *string        `json:",omitempty"`
+	Stage     *string        `json:",omitempty"`
+	Content   *string        `json:",omitempty"`
+	Canceled  *bool          `json:",omitempty"`
+	Links     []string       `json:",omitempty"`
+}
+
+// OverrideStore is implemented by storage backends that persist overrides
+type OverrideStore interface {
+	SaveOverride(Override) error
+	DeleteOverride(string, int64) error
+	LoadOverrides() ([]Override, error)
+}
+
+// OverrideKey returns the identity of an event as used for overrides
+func OverrideKey(typ string, id int64) string {
+	return fmt.Sprintf("%s/%d", typ, id)
+}
+
+func (o Override) Key() string {
+	return OverrideKey(o.Type, o.CalID)
+}
+
+// Apply returns the event with the pinned fields replaced, and false if the event is hidden
+func (o Override) Apply(e calendar.Event) (calendar.Event, bool) {
+	if o.StartTime != nil {
+		e.StartTime = *o.StartTime
+	}
+	if o.Duration != nil {
+		e.Duration = *o.Duration
+	}
+	if o.Category != nil {
+		e.Category = *o.Category
+	}
+	if o.Stage != nil {
+		e.Stage = *o.Stage
+	}
+	if o.Content != nil {
+		e.Content = *o.Content
+	}
+	if o.Canceled != nil {
+		e.Canceled = *o.Canceled
+	}
+	if o.Links != nil {
+		e.Links = o.Links
+	}
+	return e, !o.Hidden
+}
+
+// SortEvents sorts the events in the order of their types, and by start time for each type
+func SortEvents(events calendar.Events, types []string) {
+	typeOrder := make(map[string]int, len(types))
+	for i, typ := range types {
+		typeOrder[typ] = i
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Type != events[j].Type {
+			return typeOrder[events[i].Type] < typeOrder[events[j].Type]
+		}
+		return events[i].StartTime.Before(events[j].StartTime)
+	})
+}
@@ -0,0 +1,199 @@
+package storage_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/storage"
+	"git.sr.ht/~mariusor/othrys/storage/boltdb"
+	"git.sr.ht/~mariusor/othrys/storage/memory"
+)
+
+type overrideStore interface {
+	storage.Store
+	storage.OverrideStore
+}
+
+func backends(t *testing.T) map[string]overrideStore {
+	return map[string]overrideStore{
+		"memory": memory.New(),
+		"boltdb": boltdb.New(boltdb.Config{Path: filepath.Join(t.TempDir(), boltdb.DefaultFile)}),
+	}
+}
+
+func TestLoadEventsWithOverrides(t *testing.T) {
+	day := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	events := calendar.Events{
+		{CalID: 1, Type: "sc2", StartTime: day.Add(18 * time.Hour), Duration: time.Hour, Category: "Test Cup"},
+		{CalID: 2, Type: "sc2", StartTime: day.Add(20 * time.Hour), Duration: time.Hour, Category: "Test Cup"},
+		{CalID: 3, Type: "sc2", StartTime: day.Add(42 * time.Hour), Duration: time.Hour, Category: "Test Cup"},
+	}
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name      string
+		overrides []storage.Override
+		want      []int64
+	}{
+		{
+			name: "no overrides",
+			want: []int64{1, 2},
+		},
+		{
+			name:      "hidden",
+			overrides: []storage.Override{{Type: "sc2", CalID: 1, Hidden: true}},
+			want:      []int64{2},
+		},
+		{
+			name:      "moved into the interval",
+			overrides: []storage.Override{{Type: "sc2", CalID: 3, StartTime: at(day.Add(19 * time.Hour))}},
+			want:      []int64{1, 3, 2},
+		},
+		{
+			name:      "moved out of the interval",
+			overrides: []storage.Override{{Type: "sc2", CalID: 1, StartTime: at(day.Add(40 * time.Hour))}},
+			want:      []int64{2},
+		},
+		{
+			name:      "moved inside the interval",
+			overrides: []storage.Override{{Type: "sc2", CalID: 1, StartTime: at(day.Add(21 * time.Hour))}},
+			want:      []int64{2, 1},
+		},
+		{
+			name:      "moved into the interval and hidden",
+			overrides: []storage.Override{{Type: "sc2", CalID: 3, StartTime: at(day.Add(19 * time.Hour)), Hidden: true}},
+			want:      []int64{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		for name, st := range backends(t) {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				if err := st.SaveEvents(events); err != nil {
+					t.Fatalf("unable to save events: %s", err)
+				}
+				for _, o := range tt.overrides {
+					if err := st.SaveOverride(o); err != nil {
+						t.Fatalf("unable to save override: %s", err)
+					}
+				}
+				loaded, err := st.LoadEvents(storage.Cursor(day, calendar.Day-time.Second), "sc2")
+				if err != nil {
+					t.Fatalf("LoadEvents returned error: %s", err)
+				}
+				if len(loaded) != len(tt.want) {
+					t.Fatalf("loaded %d events, expected %d", len(loaded), len(tt.want))
+				}
+				for i, ev := range loaded {
+					if ev.CalID != tt.want[i] {
+						t.Errorf("loaded event %d at position %d, expected %d", ev.CalID, i, tt.want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFindEvent(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+	saved := calendar.Event{CalID: 1, Type: "sc2", StartTime: start, Duration: time.Hour, Category: "Test Cup", Stage: "Group A"}
+	playoffs := "Playoffs"
+	moved := start.Add(48 * time.Hour)
+
+	tests := []struct {
+		name      string
+		overrides []storage.Override
+		typ       string
+		id        int64
+		want      calendar.Event
+		err       error
+	}{
+		{name: "saved", typ: "sc2", id: 1, want: saved},
+		{name: "unknown id", typ: "sc2", id: 2, err: storage.ErrNotFound},
+		{name: "unknown type", typ: "dota", id: 1, err: storage.ErrNotFound},
+		{
+			name:      "overridden",
+			overrides: []storage.Override{{Type: "sc2", CalID: 1, Stage: &playoffs, StartTime: &moved}},
+			typ:       "sc2",
+			id:        1,
+			want:      calendar.Event{CalID: 1, Type: "sc2", StartTime: moved, Duration: time.Hour, Category: "Test Cup", Stage: "Playoffs"},
+		},
+		{
+			name:      "hidden",
+			overrides: []storage.Override{{Type: "sc2", CalID: 1, Hidden: true}},
+			typ:       "sc2",
+			id:        1,
+			err:       storage.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		for name, st := range backends(t) {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				if err := st.SaveEvent(saved); err != nil {
+					t.Fatalf("unable to save event: %s", err)
+				}
+				for _, o := range tt.overrides {
+					if err := st.SaveOverride(o); err != nil {
+						t.Fatalf("unable to save override: %s", err)
+					}
+				}
+				if _, ok := st.(storage.Finder); !ok {
+					t.Fatalf("%s doesn't implement storage.Finder", name)
+				}
+				ev, err := storage.FindEvent(st, tt.typ, tt.id)
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error %v, expected %v", err, tt.err)
+				}
+				if err == nil && (!ev.Equals(tt.want) || !ev.StartTime.Equal(tt.want.StartTime)) {
+					t.Errorf("found %v, expected %v", ev, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestSaveRescheduledEvent(t *testing.T) {
+	start := time.Date(2024, time.March, 4, 18, 0, 0, 0, time.UTC)
+	saved := calendar.Event{CalID: 1, Type: "sc2", StartTime: start, Duration: time.Hour, Category: "Test Cup", Stage: "Group A"}
+	rescheduled := saved
+	rescheduled.StartTime = start.Add(50 * time.Hour)
+
+	for name, st := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := st.SaveEvent(saved); err != nil {
+				t.Fatalf("unable to save event: %s", err)
+			}
+			if err := st.SaveEvent(rescheduled); err != nil {
+				t.Fatalf("unable to save event: %s", err)
+			}
+			loaded, err := st.LoadEvents(storage.AllTime, "sc2")
+			if err != nil {
+				t.Fatalf("LoadEvents returned error: %s", err)
+			}
+			if len(loaded) != 1 {
+				t.Fatalf("loaded %d events, expected only the rescheduled one", len(loaded))
+			}
+			if !loaded[0].StartTime.Equal(rescheduled.StartTime) {
+				t.Errorf("loaded the event at %s, expected %s", loaded[0].StartTime, rescheduled.StartTime)
+			}
+			found, err := storage.FindSavedEvent(st, calendar.Event{Type: "sc2", CalID: 1, StartTime: start})
+			if err != nil {
+				t.Fatalf("FindSavedEvent returned error: %s", err)
+			}
+			if !found.StartTime.Equal(rescheduled.StartTime) {
+				t.Errorf("found the event at %s, expected %s", found.StartTime, rescheduled.StartTime)
+			}
+			if s, ok := st.(storage.Searcher); ok {
+				matches, err := s.SearchEvents("group", storage.AllTime, "sc2")
+				if err != nil {
+					t.Fatalf("SearchEvents returned error: %s", err)
+				}
+				if len(matches) != 1 {
+					t.Errorf("found %d events, expected only the rescheduled one", len(matches))
+				}
+			}
+		})
+	}
+}
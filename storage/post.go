@@ -0,0 +1,38 @@
+package storage
+
+import "time"
+
+const (
+	// PostKindDigest is the kind of the posts that group the events of a day
+	PostKindDigest = "digest"
+	// PostKindReminder is the kind of the posts for a single event, shortly before it starts
+	PostKindReminder = "reminder"
+)
+
+// PostRecord is the entry of the posting ledger for an event that has been posted to an account
+type PostRecord struct {
+	Account string
+	Kind    string
+	// Event is the identity of the event, its type and CalID, eg: sc2-1234
+	Event  string
+	Start  time.Time
+	Posted time.Time
+	// Day is the day the event has been posted under, which doesn't follow Start when the event gets moved
+	Day time.Time `json:",omitempty"`
+	// Modified is the last modification time of the event when it was posted
+	Modified time.Time `json:",omitempty"`
+	// IDs are the remote objects, or statuses, that have been created for the event
+	IDs []string
+}
+
+// PostLedger is implemented by storage backends that keep the records of the events posted to each account,
+// and how far the posting of each kind of post has reached
+type PostLedger interface {
+	SavePostRecords(...PostRecord) error
+	// LoadPostRecords returns the records of the account and kind for the events, or all of them when there are no events,
+	// mapped by event
+	LoadPostRecords(account, kind string, events ...string) (map[string]PostRecord, error)
+	SavePostedUntil(account, kind string, t time.Time) error
+	// LoadPostedUntil returns the end of the last period posted to the account, the zero time if nothing has been posted
+	LoadPostedUntil(account, kind string) (time.Time, error)
+}
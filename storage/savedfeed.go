@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"net/url"
+	"time"
+)
+
+// SavedFeed is a named selection of calendar types and filters, which is served under the URL containing its secret token
+type SavedFeed struct {
+	Token string
+	Name  string
+	Types []string
+	// Values are the query parameters for the filters, timezone and alarms, as accepted by the iCal routes
+	Values  url.Values `json:",omitempty"`
+	Created time.Time
+}
+
+// SavedFeedStore is implemented by storage backends that can persist the saved feeds,
+// LoadFeed returns ErrNotFound for tokens that don't exist, or have been revoked.
+type SavedFeedStore interface {
+	SaveFeed(SavedFeed) error
+	LoadFeed(token string) (SavedFeed, error)
+	LoadFeeds() ([]SavedFeed, error)
+	DeleteFeed(token string) error
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+)
+
+// Searcher is implemented by storage backends that maintain a full-text index of the events
+type Searcher interface {
+	SearchEvents(string, DateCursor, ...string) (calendar.Events, error)
+}
+
+// Normalize lowercases the received string and strips the diacritics from it.
+func Normalize(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if n, _, err := transform.String(t, s); err == nil {
+		s = n
+	}
+	return strings.ToLower(s)
+}
+
+// Tokenize splits the normalized string in words
+func Tokenize(s string) []string {
+	words := strings.FieldsFunc(Normalize(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if !stringsContain(terms, w) {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// Terms returns the searchable terms of an event: the words in its category, stage, content and participants.
+func Terms(e calendar.Event) []string {
+	fields := []string{e.Category, e.Stage, e.Content}
+	fields = append(fields, e.TagNames...)
+	return Tokenize(strings.Join(fields, " "))
+}
+
+// Matches returns true if every term of the query is a prefix of one of the event's terms.
+func Matches(e calendar.Event, query string) bool {
+	terms := Terms(e)
+	for _, q := range Tokenize(query) {
+		found := false
+		for _, t := range terms {
+			if strings.HasPrefix(t, q) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Search loads the events matching query, using the full-text index of the storage if it has one.
+func Search(st Loader, query string, cursor DateCursor, types ...string) (calendar.Events, error) {
+	if s, ok := st.(Searcher); ok {
+		return s.SearchEvents(query, cursor, types...)
+	}
+	events, err := st.LoadEvents(cursor, types...)
+	if err != nil {
+		return nil, err
+	}
+	found := make(calendar.Events, 0)
+	for _, e := range events {
+		if Matches(e, query) {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+func stringsContain(sl []string, v string) bool {
+	for _, vs := range sl {
+		if vs == v {
+			return true
+		}
+	}
+	return false
+}
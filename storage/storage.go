@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"git.sr.ht/~mariusor/othrys/calendar"
@@ -18,11 +20,99 @@ func Cursor(st time.Time, d time.Duration) DateCursor {
 	}
 }
 
+// Contains returns true if t is inside the cursor interval
+func (c DateCursor) Contains(t time.Time) bool {
+	start, end := c.T, c.T.Add(c.D)
+	if c.D < 0 {
+		start, end = end, start
+	}
+	return !t.Before(start) && !t.After(end)
+}
+
+// ErrNotFound is returned when looking up an event that doesn't exist in the storage
+var ErrNotFound = errors.New("not found")
+
+var (
+	epoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// AllTime is the cursor that covers every event the storage backends can hold
+	AllTime = Cursor(epoch, time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC).Sub(epoch)-time.Second)
+)
+
+// Finder is implemented by storage backends that can look up events by their type and CalID
+type Finder interface {
+	// FindEvent returns the event with its override applied, or ErrNotFound if it doesn't exist or it's hidden
+	FindEvent(typ string, id int64) (calendar.Event, error)
+}
+
+// FindEvent looks up an event by its type and CalID, when its start time is not known.
+// For the backends that don't implement Finder it loads all the events of the type.
+func FindEvent(st Loader, typ string, id int64) (calendar.Event, error) {
+	if f, ok := st.(Finder); ok {
+		return f.FindEvent(typ, id)
+	}
+	events, err := st.LoadEvents(AllTime, typ)
+	if err != nil {
+		return calendar.Event{}, err
+	}
+	for _, ev := range events {
+		if ev.CalID == id {
+			return ev, nil
+		}
+	}
+	return calendar.Event{}, ErrNotFound
+}
+
+// SavedFinder is implemented by storage backends that can look up the events as they have been saved by their type and CalID
+type SavedFinder interface {
+	// FindSavedEvent returns the event without its override, or ErrNotFound if it doesn't exist
+	FindSavedEvent(typ string, id int64) (calendar.Event, error)
+}
+
+// FindSavedEvent looks up the saved copy of ev by its type and CalID, so it's found after its start time changed.
+// For the backends that don't implement SavedFinder it's looked up at the start time of ev.
+func FindSavedEvent(st Loader, ev calendar.Event) (calendar.Event, error) {
+	if f, ok := st.(SavedFinder); ok {
+		return f.FindSavedEvent(ev.Type, ev.CalID)
+	}
+	if saved := st.LoadEvent(ev.Type, ev.StartTime, ev.CalID); saved.IsValid() {
+		return saved, nil
+	}
+	return calendar.Event{}, ErrNotFound
+}
+
 type Saver interface {
-	SaveEvents(...calendar.Events) error
+	SaveEvents(calendar.Events) error
+	SaveEvent(calendar.Event) error
 }
 
 type Loader interface {
 	LoadEvents(DateCursor, ...string) (calendar.Events, error)
 	LoadEvent(string, time.Time, int64) calendar.Event
 }
+
+// Store is the minimal interface a storage backend needs to implement
+type Store interface {
+	Saver
+	Loader
+}
+
+// Pruner is implemented by storage backends that can remove events in bulk,
+// the received function returns true for the events that need to be removed.
+// The functions receive the events as they have been saved, without their overrides.
+type Pruner interface {
+	// RemoveEvents deletes the events together with their overrides, and returns how many have been deleted
+	RemoveEvents(func(calendar.Event) bool) (int, error)
+	// CountEvents returns how many events RemoveEvents would delete
+	CountEvents(func(calendar.Event) bool) (int, error)
+}
+
+// Compacter is implemented by storage backends that can reclaim the space freed by removed events.
+type Compacter interface {
+	Compact() (before int64, after int64, err error)
+}
+
+// Checker is implemented by storage backends that can check they are usable without waiting past the deadline of ctx,
+// when the other operations would wait for as long as it takes to get a hold of them.
+type Checker interface {
+	Check(ctx context.Context) error
+}
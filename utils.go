@@ -48,3 +48,15 @@ func WrapObjectInCreate(actor vocab.Actor, p vocab.Item) vocab.Activity {
 		Object:       p,
 	}
 }
+
+func WrapObjectInUpdate(actor vocab.Actor, p vocab.Item) vocab.Activity {
+	act := WrapObjectInCreate(actor, p)
+	act.Type = vocab.UpdateType
+	return act
+}
+
+func WrapObjectInDelete(actor vocab.Actor, p vocab.Item) vocab.Activity {
+	act := WrapObjectInCreate(actor, p)
+	act.Type = vocab.DeleteType
+	return act
+}
@@ -0,0 +1,403 @@
+package web
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mariusor/render"
+
+	"git.sr.ht/~mariusor/othrys/calendar"
+	"git.sr.ht/~mariusor/othrys/filter"
+	"git.sr.ht/~mariusor/othrys/ical"
+	"git.sr.ht/~mariusor/othrys/internal/metrics"
+	"git.sr.ht/~mariusor/othrys/storage"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// The views we can render for a calendar selection
+const (
+	ViewMonth  = "month"
+	ViewWeek   = "week"
+	ViewAgenda = "agenda"
+)
+
+const dateFmt = "2006-01-02"
+
+// Zones are the timezones offered in the selection form, the one of the request gets added if it's not in the list
+var Zones = []string{
+	"UTC",
+	"Europe/London", "Europe/Paris", "Europe/Berlin", "Europe/Stockholm", "Europe/Kyiv", "Europe/Moscow",
+	"America/New_York", "America/Chicago", "America/Denver", "America/Los_Angeles", "America/Sao_Paulo",
+	"Asia/Seoul", "Asia/Shanghai", "Asia/Tokyo", "Australia/Sydney",
+}
+
+type handler struct {
+	UpcomingPast   time.Duration
+	UpcomingFuture time.Duration
+	st             storage.Loader
+	ren            *render.Render
+}
+
+type OptionFn func(*handler)
+
+// WithUpcomingWindow sets the window shown in the agenda of the "upcoming" selections, relative to the time of the request
+func WithUpcomingWindow(past, future time.Duration) OptionFn {
+	return func(h *handler) {
+		if past >= 0 {
+			h.UpcomingPast = past
+		}
+		if future > 0 {
+			h.UpcomingFuture = future
+		}
+	}
+}
+
+func NewHandler(st storage.Loader, opts ...OptionFn) *handler {
+	h := new(handler)
+	h.st = st
+	h.UpcomingPast = ical.DefaultUpcomingPast
+	h.UpcomingFuture = ical.DefaultUpcomingFuture
+	h.ren = render.New(render.Options{
+		Directory:  "templates",
+		FileSystem: templateFS,
+		Layout:     "main",
+		Extensions: []string{".html"},
+		Funcs: []template.FuncMap{{
+			"fmtDate": func(t time.Time, layout string) string { return t.Format(layout) },
+		}},
+		Delims:                    render.Delims{Left: "{{", Right: "}}"},
+		Charset:                   "UTF-8",
+		HTMLContentType:           "text/html",
+		DisableHTTPErrorRendering: true,
+	})
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+type link struct {
+	Label   string
+	URL     string
+	Current bool
+}
+
+type param struct {
+	Name, Value string
+}
+
+type subscribe struct {
+	ICS, Google, Outlook string
+	// Webcal is built by us from the request, so it's safe to bypass the html/template URL scheme check
+	Webcal template.URL
+}
+
+type eventView struct {
+	Time      string
+	Title     string
+	Calendar  string
+	Content   string
+	Links     []string
+	Canceled  bool
+	Continued bool
+}
+
+type dayView struct {
+	Date    time.Time
+	Other   bool
+	Today   bool
+	Events  []eventView
+	Anchor  string
+	Weekday string
+}
+
+type page struct {
+	Title     string
+	Heading   string
+	View      string
+	Views     []link
+	Prev      string
+	Next      string
+	Today     string
+	WeekDays  []string
+	Weeks     [][]dayView
+	Days      []dayView
+	Sources   []link
+	Subscribe subscribe
+	TZ        string
+	Zones     []string
+	Hidden    []param
+}
+
+func badRequest(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(err.Error()))
+}
+
+// withQuery returns the request URI of u with the values in set replaced
+func withQuery(u *url.URL, set ...param) string {
+	q := u.Query()
+	for _, p := range set {
+		if p.Value == "" {
+			q.Del(p.Name)
+		} else {
+			q.Set(p.Name, p.Value)
+		}
+	}
+	res := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return res.RequestURI()
+}
+
+// subscribeLinks builds the links for subscribing to the iCalendar version of the selection,
+// the plain years selections get replaced with the upcoming window, so the subscriptions don't go stale.
+func subscribeLinks(r *http.Request, title string) subscribe {
+	p := strings.TrimSuffix(r.URL.Path, path.Ext(r.URL.Path))
+	pieces := strings.Split(strings.Trim(p, "/"), "/")
+	if _, _, ok := ical.ParseYears(pieces[0]); ok || pieces[0] == "" {
+		pieces[0] = ical.UpcomingPath
+	}
+	calURL := url.URL{Host: r.Host, Path: "/" + path.Join(pieces...) + ".ics", RawQuery: r.URL.Query().Encode()}
+	q := calURL.Query()
+	q.Del("view")
+	q.Del("date")
+	calURL.RawQuery = q.Encode()
+
+	calURL.Scheme = "https"
+	ics := calURL.String()
+	calURL.Scheme = "webcal"
+	webcal := calURL.String()
+
+	return subscribe{
+		ICS:     ics,
+		Webcal:  template.URL(webcal),
+		Google:  "https://calendar.google.com/calendar/r?cid=" + url.QueryEscape(webcal),
+		Outlook: fmt.Sprintf("https://outlook.live.com/calendar/0/addfromweb?url=%s&name=%s", url.QueryEscape(ics), url.QueryEscape(title)),
+	}
+}
+
+func inStringList(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func pageTitle(types []string) string {
+	labels := make([]string, 0, len(types))
+	for _, typ := range types {
+		if label, ok := calendar.Labels[typ]; ok {
+			labels = append(labels, label)
+		}
+	}
+	return fmt.Sprintf("Events for %s", strings.Join(labels, ", "))
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the Monday of the week of t
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
+
+func overlaps(ev calendar.Event, day time.Time) bool {
+	next := day.AddDate(0, 0, 1)
+	end := ev.StartTime.Add(ev.Duration)
+	if ev.Duration <= 0 {
+		return !ev.StartTime.Before(day) && ev.StartTime.Before(next)
+	}
+	return ev.StartTime.Before(next) && end.After(day)
+}
+
+func newEventView(ev calendar.Event, day time.Time, loc *time.Location) eventView {
+	st := ev.StartTime.In(loc)
+	e := eventView{
+		Time:      st.Format("15:04"),
+		Title:     strings.TrimSuffix(strings.TrimSpace(strings.Join([]string{ev.Category, ev.Stage}, ": ")), ":"),
+		Calendar:  calendar.Labels[ev.Type],
+		Content:   ev.Content,
+		Links:     ev.Links,
+		Canceled:  ev.Canceled,
+		Continued: st.Before(day),
+	}
+	if ev.Duration >= calendar.Day && st.Equal(startOfDay(st)) {
+		e.Time = "all day"
+	}
+	return e
+}
+
+// buildDays groups the events by the days between start and end, for the agenda the events show only on the day
+// they start and the days without events are skipped.
+func buildDays(events calendar.Events, start, end, today time.Time, loc *time.Location, month time.Month, agenda bool) []dayView {
+	days := make([]dayView, 0)
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		day := dayView{
+			Date:    d,
+			Other:   month != 0 && d.Month() != month,
+			Today:   d.Equal(today),
+			Anchor:  d.Format(dateFmt),
+			Weekday: d.Weekday().String(),
+		}
+		for _, ev := range events {
+			if agenda && startOfDay(ev.StartTime.In(loc)).Equal(d) || !agenda && overlaps(ev, d) {
+				day.Events = append(day.Events, newEventView(ev, d, loc))
+			}
+		}
+		if agenda && len(day.Events) == 0 {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	types, in := ical.ParsePath(r.URL)
+
+	q := r.URL.Query()
+	f, err := filter.FromValues(q)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			badRequest(w, fmt.Errorf("invalid timezone %q", tz))
+			return
+		}
+	}
+	now := time.Now().In(loc)
+	today := startOfDay(now)
+
+	view := q.Get("view")
+	switch view {
+	case ViewMonth, ViewWeek, ViewAgenda:
+	case "":
+		view = ViewMonth
+		if in.Upcoming {
+			view = ViewAgenda
+		}
+	default:
+		badRequest(w, fmt.Errorf("invalid view value %q", view))
+		return
+	}
+	date := today
+	if !in.Upcoming && (now.Year() < in.From || now.Year() > in.To) {
+		date = time.Date(in.From, time.January, 1, 0, 0, 0, 0, loc)
+	}
+	if d := q.Get("date"); d != "" {
+		if date, err = time.ParseInLocation(dateFmt, d, loc); err != nil {
+			badRequest(w, fmt.Errorf("invalid date value %q", d))
+			return
+		}
+	}
+
+	p := page{
+		Title:    pageTitle(types),
+		View:     view,
+		WeekDays: []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"},
+		TZ:       loc.String(),
+		Zones:    Zones,
+		Today:    withQuery(r.URL, param{Name: "date"}),
+	}
+	p.Subscribe = subscribeLinks(r, p.Title)
+	for _, v := range []string{ViewMonth, ViewWeek, ViewAgenda} {
+		p.Views = append(p.Views, link{Label: v, URL: withQuery(r.URL, param{"view", v}), Current: v == view})
+	}
+	if !inStringList(p.TZ, Zones) {
+		p.Zones = append([]string{p.TZ}, Zones...)
+	}
+	for name, values := range q {
+		if name == "tz" {
+			continue
+		}
+		for _, v := range values {
+			p.Hidden = append(p.Hidden, param{Name: name, Value: v})
+		}
+	}
+	sort.Slice(p.Hidden, func(i, j int) bool { return p.Hidden[i].Name < p.Hidden[j].Name })
+
+	var start, end time.Time
+	var cursor storage.DateCursor
+	switch view {
+	case ViewMonth:
+		first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, loc)
+		start = startOfWeek(first)
+		end = startOfWeek(first.AddDate(0, 1, -1)).AddDate(0, 0, 7)
+		p.Heading = first.Format("January 2006")
+		p.Prev = withQuery(r.URL, param{"date", first.AddDate(0, -1, 0).Format(dateFmt)})
+		p.Next = withQuery(r.URL, param{"date", first.AddDate(0, 1, 0).Format(dateFmt)})
+	case ViewWeek:
+		start = startOfWeek(date)
+		end = start.AddDate(0, 0, 7)
+		p.Heading = fmt.Sprintf("Week of %s", start.Format("02 January 2006"))
+		p.Prev = withQuery(r.URL, param{"date", start.AddDate(0, 0, -7).Format(dateFmt)})
+		p.Next = withQuery(r.URL, param{"date", end.Format(dateFmt)})
+	case ViewAgenda:
+		cursor = in.Cursor(time.Now().UTC(), filter.Filters{Past: h.UpcomingPast, Future: h.UpcomingFuture}, f)
+		start, end = startOfDay(cursor.T.In(loc)), cursor.T.Add(cursor.D).In(loc)
+		p.Heading = "Upcoming events"
+		if !in.Upcoming && !f.HasWindow() {
+			p.Heading = fmt.Sprintf("Events in %d", in.From)
+			if in.To > in.From {
+				p.Heading = fmt.Sprintf("Events between %d and %d", in.From, in.To)
+			}
+		}
+	}
+	if view != ViewAgenda {
+		// we look back a bit, for the tournaments that started before the first day, but are still running
+		cursor = storage.Cursor(start.Add(-4*calendar.Week).UTC(), end.Sub(start)+4*calendar.Week-time.Second)
+	}
+	for _, typ := range types {
+		if u, err := calendar.GetCalendarURL(typ, date, view == ViewWeek); err == nil {
+			p.Sources = append(p.Sources, link{Label: calendar.Labels[typ], URL: u.String()})
+		}
+	}
+
+	events, err := storage.Search(h.st, f.Text, cursor, types...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	filtered := make(calendar.Events, 0, len(events))
+	for _, ev := range events {
+		if (view != ViewAgenda || cursor.Contains(ev.StartTime)) && f.Match(ev) {
+			filtered = append(filtered, ev)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].StartTime.Before(filtered[j].StartTime) })
+
+	switch view {
+	case ViewMonth:
+		days := buildDays(filtered, start, end, today, loc, date.Month(), false)
+		for i := 0; i < len(days); i += 7 {
+			p.Weeks = append(p.Weeks, days[i:i+7])
+		}
+	case ViewWeek:
+		p.Days = buildDays(filtered, start, end, today, loc, 0, false)
+	case ViewAgenda:
+		p.Days = buildDays(filtered, start, end, today, loc, 0, true)
+	}
+
+	metrics.CountEvents(r, len(filtered))
+	if err = h.ren.HTML(w, http.StatusOK, view, p); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+	}
+}